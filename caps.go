@@ -2,7 +2,11 @@ package caps
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -18,6 +22,45 @@ type CaptionWriter interface {
 	Write(*CaptionSet) ([]byte, error)
 }
 
+// StreamReader is implemented by readers that can decode captions from an io.Reader
+// without loading the whole content in memory first.
+type StreamReader interface {
+	ReadStream(io.Reader) (*CaptionSet, error)
+}
+
+// StreamWriter is implemented by writers that can encode captions directly to an
+// io.Writer, without building the whole output in memory first.
+type StreamWriter interface {
+	WriteStream(io.Writer, *CaptionSet) error
+}
+
+// ReadStream decodes the captions read from in, streaming them when the reader
+// is a StreamReader and reading all of in otherwise.
+func ReadStream(reader CaptionReader, in io.Reader) (*CaptionSet, error) {
+	if streamReader, ok := reader.(StreamReader); ok {
+		return streamReader.ReadStream(in)
+	}
+	content, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	return reader.Read(content)
+}
+
+// WriteStream encodes the caption set to out, streaming it when the writer
+// is a StreamWriter.
+func WriteStream(writer CaptionWriter, out io.Writer, captionSet *CaptionSet) error {
+	if streamWriter, ok := writer.(StreamWriter); ok {
+		return streamWriter.WriteStream(out, captionSet)
+	}
+	content, err := writer.Write(captionSet)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(content)
+	return err
+}
+
 type CaptionContent interface {
 	Text() bool
 	Style() bool
@@ -88,6 +131,57 @@ func NewLineBreak() CaptionContent {
 	return CaptionLineBreak{isNot{}}
 }
 
+// SpanKind is the meaning of a CaptionSpan.
+type SpanKind string
+
+const (
+	// SpanVoice is text spoken by the voice named by the span's Value.
+	SpanVoice SpanKind = "voice"
+	// SpanLang is text in the language, a BCP 47 tag, of the span's Value.
+	SpanLang SpanKind = "lang"
+	// SpanRuby is base text annotated by the SpanRubyText spans it holds.
+	SpanRuby SpanKind = "ruby"
+	// SpanRubyText is the annotation of the text of its SpanRuby span.
+	SpanRubyText SpanKind = "rubyText"
+)
+
+// CaptionSpan starts or ends a span of text with a meaning other than its style,
+// like WebVTT <v>, <lang>, <ruby> and <rt> tags. Like CaptionStyle nodes, spans
+// are opened and closed by a pair of nodes.
+type CaptionSpan struct {
+	Kind SpanKind
+	// Value is the voice name or the language of the span, depending on its kind.
+	Value string
+	// Class holds the space separated classes of the span.
+	Class string
+	Start bool
+	isNot
+}
+
+func (c CaptionSpan) Content() string {
+	return ""
+}
+
+func NewCaptionSpan(start bool, kind SpanKind, value, class string) CaptionContent {
+	return CaptionSpan{kind, value, class, start, isNot{}}
+}
+
+// CaptionTimestamp marks the time the text following it is spoken, like WebVTT
+// inline timestamps, giving the timing of each word or syllable for karaoke style
+// highlighting. Time is relative to the start of the media, like the caption's.
+type CaptionTimestamp struct {
+	Time Timestamp
+	isNot
+}
+
+func (c CaptionTimestamp) Content() string {
+	return ""
+}
+
+func NewCaptionTimestamp(time Timestamp) CaptionContent {
+	return CaptionTimestamp{time, isNot{}}
+}
+
 const defaultStyleID = "default"
 
 // FIXME This is a simple placeholder for style types, this can be better represented
@@ -126,6 +220,26 @@ func (s StyleProps) String() string {
 	)
 }
 
+// Merge returns the style with the properties set by other overriding its own, the
+// ID and class being kept. Properties can't be unset: empty strings and false
+// values of other are ignored.
+func (s StyleProps) Merge(other StyleProps) StyleProps {
+	for _, value := range []struct{ to, from *string }{
+		{&s.TextAlign, &other.TextAlign},
+		{&s.FontFamily, &other.FontFamily},
+		{&s.FontSize, &other.FontSize},
+		{&s.Color, &other.Color},
+	} {
+		if *value.from != "" {
+			*value.to = *value.from
+		}
+	}
+	s.Italics = s.Italics || other.Italics
+	s.Bold = s.Bold || other.Bold
+	s.Underline = s.Underline || other.Underline
+	return s
+}
+
 func DefaultStyleProps() StyleProps {
 	return StyleProps{Color: "white", FontFamily: "monospace", FontSize: "1c"}
 }
@@ -133,12 +247,39 @@ func DefaultStyleProps() StyleProps {
 type CaptionSet struct {
 	Styles   map[string]StyleProps
 	Captions map[string][]*Caption
+	// Regions holds the regions referenced by the placement of captions, by ID.
+	Regions map[string]Region
+	// Notes holds the comments of the file, in order.
+	Notes []Note
+	// LanguageInfo holds the metadata of the languages, by language.
+	LanguageInfo map[string]LanguageInfo
+}
+
+// LanguageInfo describes the captions of a language, as SAMI classes do.
+type LanguageInfo struct {
+	// Name is the name of the language, e.g. "English".
+	Name string
+	// Class is the class of the captions in the source document, e.g. "ENCC".
+	Class string
+	// Type is the kind of captions, e.g. "CC" for closed captions.
+	Type string
+}
+
+// Note is a comment of a caption file, like a WebVTT NOTE block.
+type Note struct {
+	Text string
+	// Time places the note before the captions starting at or after it. Unset, the
+	// note comes before all captions.
+	Time Timestamp
 }
 
 func NewCaptionSet() *CaptionSet {
 	return &CaptionSet{
 		Styles:   map[string]StyleProps{},
 		Captions: map[string][]*Caption{},
+		Regions:  map[string]Region{},
+
+		LanguageInfo: map[string]LanguageInfo{},
 	}
 }
 
@@ -146,11 +287,13 @@ func (c CaptionSet) SetCaptions(lang string, captions []*Caption) {
 	c.Captions[lang] = captions
 }
 
+// Languages returns the languages of the captions, sorted.
 func (c CaptionSet) Languages() []string {
 	keys := []string{}
 	for k := range c.Captions {
 		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 	return keys
 }
 
@@ -182,14 +325,32 @@ func (c CaptionSet) GetStyle(id string) StyleProps {
 	return DefaultStyleProps()
 }
 
+// GetStyles returns the styles sorted by ID.
 func (c CaptionSet) GetStyles() []StyleProps {
 	values := []StyleProps{}
 	for _, v := range c.Styles {
 		values = append(values, v)
 	}
+	sort.Slice(values, func(i, j int) bool { return values[i].ID < values[j].ID })
 	return values
 }
 
+func (c CaptionSet) AddRegion(region Region) {
+	c.Regions[region.ID] = region
+}
+
+// GetRegions returns the regions sorted by ID.
+func (c CaptionSet) GetRegions() []Region {
+	regions := []Region{}
+	for _, region := range c.Regions {
+		regions = append(regions, region)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i].ID < regions[j].ID
+	})
+	return regions
+}
+
 func SplitLines(s string) []string {
 	var lines []string
 	scanner := bufio.NewScanner(strings.NewReader(s))
@@ -198,3 +359,36 @@ func SplitLines(s string) []string {
 	}
 	return lines
 }
+
+// NewLineScanner returns a scanner reading the lines of in, ended by "\n", "\r\n" or "\r".
+func NewLineScanner(in io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(in)
+	scanner.Split(scanLines)
+	return scanner
+}
+
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// a "\r" ending the buffer could be the start of a "\r\n"
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,42 @@
+package caps
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLineScanner(t *testing.T) {
+	scanner := NewLineScanner(strings.NewReader("first\r\nsecond\rthird\n\r\nlast"))
+	lines := []string{}
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	assert.Nil(t, scanner.Err())
+	assert.Equal(t, []string{"first", "second", "third", "", "last"}, lines)
+}
+
+// bytesOnly implements the []byte interfaces only.
+type bytesOnly struct{}
+
+func (bytesOnly) Detect([]byte) bool { return true }
+
+func (bytesOnly) Read(content []byte) (*CaptionSet, error) {
+	set := NewCaptionSet()
+	set.SetCaptions(DefaultLang, []*Caption{{Nodes: []CaptionContent{NewCaptionText(string(content))}}})
+	return set, nil
+}
+
+func (bytesOnly) Write(set *CaptionSet) ([]byte, error) {
+	return []byte(set.GetCaptions(DefaultLang)[0].Text()), nil
+}
+
+func TestStreamFallback(t *testing.T) {
+	set, err := ReadStream(bytesOnly{}, strings.NewReader("hello"))
+	assert.Nil(t, err)
+	var output bytes.Buffer
+	assert.Nil(t, WriteStream(bytesOnly{}, &output, set))
+	assert.Equal(t, "hello", output.String())
+}
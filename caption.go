@@ -2,15 +2,22 @@ package caps
 
 import (
 	"fmt"
-	"math"
 	"strings"
 )
 
 type Caption struct {
-	Start *float64
-	End   *float64
-	Nodes []CaptionContent
-	Style StyleProps
+	// ID is the identifier of the caption in the source file, like a WebVTT cue
+	// identifier, empty when it has none.
+	ID string
+	// Number is the sequence number of the caption in the source file, like an
+	// SRT index, 0 when it has none. Unlike ID, it isn't written as an identifier.
+	Number int
+	Start  Timestamp
+	End    Timestamp
+	Nodes  []CaptionContent
+	Style  StyleProps
+	// Placement is where the caption is displayed, the player's default when unset.
+	Placement Placement
 }
 
 func (c Caption) IsEmpty() bool {
@@ -32,38 +39,26 @@ func (c Caption) String() string {
 }
 
 func (c Caption) FormatStartWithSeparator(sep string) string {
-	return formatTimestamp(c.Start, sep)
+	return c.Start.Format(sep)
 }
 
 func (c Caption) FormatStart() string {
-	return formatTimestamp(c.Start, ".")
+	return c.Start.Format(".")
 }
 
 func (c Caption) FormatEndWithSeparator(sep string) string {
-	return formatTimestamp(c.End, sep)
+	return c.End.Format(sep)
 }
 
 func (c Caption) FormatEnd() string {
-	return formatTimestamp(c.End, ".")
+	return c.End.Format(".")
 }
 
-func formatTimestamp(timestamp *float64, sep string) string {
-	value := int(*timestamp / 1000)
-	seconds := math.Mod(float64(value)/1000, 60)
-	minutes := (value / (1000 * 60)) % 60
-	hours := value / (1000 * 60 * 60) % 24
-	resultTimestamp := fmt.Sprintf("%02d:%02d:%06.3f", hours, minutes, seconds)
-	if sep != "." {
-		return strings.ReplaceAll(resultTimestamp, ".", sep)
-	}
-	return resultTimestamp
-}
-
-func NewCaption(start, end *float64, nodes []CaptionContent, style StyleProps) Caption {
+func NewCaption(start, end Timestamp, nodes []CaptionContent, style StyleProps) Caption {
 	return Caption{
-		start,
-		end,
-		nodes,
-		style,
+		Start: start,
+		End:   end,
+		Nodes: nodes,
+		Style: style,
 	}
 }
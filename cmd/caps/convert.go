@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vimeo/caps"
+	"github.com/vimeo/caps/dfxp"
+	"github.com/vimeo/caps/sami"
+	"github.com/vimeo/caps/scc"
+	"github.com/vimeo/caps/srt"
+	"github.com/vimeo/caps/webvtt"
+)
+
+// extensions maps each format to the extension used for its files in batch mode.
+var extensions = map[string]string{
+	"srt":    ".srt",
+	"webvtt": ".vtt",
+	"dfxp":   ".dfxp",
+	"scc":    ".scc",
+	"sami":   ".smi",
+}
+
+type options struct {
+	from               string
+	to                 string
+	sccRollUp          bool
+	sccOffset          int
+	sccDropFrame       bool
+	ignoreTimingErrors bool
+	recovery           caps.Recovery
+	speakers           bool
+	// lang is the language of srt captions, found in the input file name
+	lang string
+	// encoding is the encoding of the input, detected from the content when "auto"
+	encoding string
+	// outputEncoding is the encoding of the output, preceded by a byte order mark when bom is set
+	outputEncoding string
+	bom            bool
+}
+
+func newReader(format string, opts options) (caps.CaptionReader, error) {
+	switch format {
+	case "srt":
+		return srt.NewLangReader(opts.lang), nil
+	case "webvtt":
+		return webvtt.NewReader(opts.ignoreTimingErrors), nil
+	case "dfxp":
+		return dfxp.NewReader(), nil
+	case "scc":
+		return scc.NewReader(opts.sccRollUp, opts.sccOffset), nil
+	case "sami":
+		return sami.NewReader(), nil
+	}
+	return nil, fmt.Errorf("unknown input format %q", format)
+}
+
+func newWriter(format string, opts options) (caps.CaptionWriter, error) {
+	writer, err := newFormatWriter(format, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.bom || (opts.outputEncoding != "" && opts.outputEncoding != caps.EncodingUTF8) {
+		return caps.NewEncodedWriter(writer, opts.outputEncoding, opts.bom)
+	}
+	return writer, nil
+}
+
+func newFormatWriter(format string, opts options) (caps.CaptionWriter, error) {
+	switch format {
+	case "srt":
+		return srt.NewWriter(), nil
+	case "webvtt":
+		return webvtt.NewWriter(), nil
+	case "dfxp":
+		return dfxp.NewWriter(), nil
+	case "scc":
+		if opts.sccDropFrame {
+			return scc.NewDropFrameWriter(), nil
+		}
+		return scc.NewWriter(), nil
+	case "sami":
+		return sami.NewWriter(), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// autoEncoding is the input encoding detected from the content.
+const autoEncoding = "auto"
+
+// decodeContent returns the content transcoded to UTF-8 from opts.encoding, or from
+// the detected encoding, and the name of the encoding.
+func decodeContent(content []byte, opts options) ([]byte, string, error) {
+	switch opts.encoding {
+	case "", autoEncoding:
+		return caps.DecodeInput(content)
+	case caps.EncodingUTF8:
+		return content, opts.encoding, nil
+	}
+	in, err := caps.NewDecodingReader(bytes.NewReader(content), opts.encoding)
+	if err != nil {
+		return nil, "", err
+	}
+	content, err = ioutil.ReadAll(in)
+	return content, opts.encoding, err
+}
+
+// readCaptions reads the captions from in with the reader for opts.from, streaming
+// them, or with the reader of the detected format when it's empty, which needs
+// the whole content as does the detection of the encoding. It returns the
+// encoding of the input and the warnings of the recovered problems when
+// opts.recovery isn't strict.
+func readCaptions(in io.Reader, opts options) (*caps.CaptionSet, string, []caps.Warning, error) {
+	from := opts.from
+	encoding := opts.encoding
+	var content []byte
+	if from == "" || encoding == "" || encoding == autoEncoding {
+		var err error
+		if content, err = ioutil.ReadAll(in); err != nil {
+			return nil, "", nil, err
+		}
+		if content, encoding, err = decodeContent(content, opts); err != nil {
+			return nil, "", nil, err
+		}
+		in = bytes.NewReader(content)
+	} else if encoding != caps.EncodingUTF8 {
+		var err error
+		if in, err = caps.NewDecodingReader(in, encoding); err != nil {
+			return nil, "", nil, err
+		}
+	}
+	if from == "" {
+		if from, _ = caps.DetectFormat(content); from == "" {
+			return nil, "", nil, fmt.Errorf("unable to detect caption format")
+		}
+	}
+	reader, err := newReader(from, opts)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	var warnings []caps.Warning
+	reader = caps.WithRecovery(reader, opts.recovery, func(warning caps.Warning) {
+		warnings = append(warnings, warning)
+	})
+	captionSet, err := caps.ReadStream(reader, in)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("error reading %s: %w", from, err)
+	}
+	if opts.speakers {
+		caps.DetectSpeakers(captionSet)
+	}
+	return captionSet, encoding, warnings, nil
+}
+
+// writeCaptions writes the captions with the writer for opts.to to the output file,
+// or to stdout when output is empty or "-". An SRT file holds a single language,
+// so the captions of each language are written to their own file, e.g.
+// "movie.fr.srt" for "movie.srt". On stdout, only the first language is written
+// and the others are reported on errOut.
+func writeCaptions(captionSet *caps.CaptionSet, output string, opts options, stdout, errOut io.Writer) error {
+	writer, err := newWriter(opts.to, opts)
+	if err != nil {
+		return err
+	}
+	toStdout := output == "" || output == "-"
+	if languages := captionSet.Languages(); opts.to == "srt" && len(languages) > 1 {
+		if !toStdout {
+			return writeSRTLanguages(captionSet, output, opts)
+		}
+		fmt.Fprintf(errOut, "caps: warning: srt holds a single language, dropping %s\n", strings.Join(languages[1:], ", "))
+		first := *captionSet
+		first.Captions = map[string][]*caps.Caption{languages[0]: captionSet.GetCaptions(languages[0])}
+		captionSet = &first
+	}
+	if toStdout {
+		return caps.WriteStream(writer, stdout, captionSet)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := caps.WriteStream(writer, f, captionSet); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeSRTLanguages writes the captions of each language to its own SRT file, named
+// after output.
+func writeSRTLanguages(captionSet *caps.CaptionSet, output string, opts options) error {
+	documents, err := srt.WriteLanguages(captionSet)
+	if err != nil {
+		return err
+	}
+	for _, lang := range captionSet.Languages() {
+		document := documents[lang]
+		if opts.bom || (opts.outputEncoding != "" && opts.outputEncoding != caps.EncodingUTF8) {
+			if document, err = caps.Encode(document, opts.outputEncoding, opts.bom); err != nil {
+				return err
+			}
+		}
+		if err := ioutil.WriteFile(srt.LangFilename(output, lang), document, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertFile converts a single file, using stdin and stdout when the input or output are empty or "-".
+// Warnings are reported on errOut.
+func convertFile(input, output string, opts options, stdin io.Reader, stdout, errOut io.Writer) error {
+	if _, err := newWriter(opts.to, opts); err != nil {
+		return err
+	}
+	in := stdin
+	if input != "" && input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+		opts.lang = srt.LangFromFilename(input)
+	}
+	captionSet, encoding, warnings, err := readCaptions(in, opts)
+	if err != nil {
+		return err
+	}
+	if encoding != caps.EncodingUTF8 && encoding != opts.encoding {
+		fmt.Fprintf(errOut, "caps: input encoding: %s\n", encoding)
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(errOut, "caps: warning: %s\n", warning)
+	}
+	return writeCaptions(captionSet, output, opts, stdout, errOut)
+}
+
+// convertTree converts every caption file under inputDir into outputDir, keeping
+// the directory layout and replacing the extension with the one of the output
+// format. Files that aren't captions or fail to convert are reported on errOut and
+// skipped; an error is returned at the end if any file failed.
+func convertTree(inputDir, outputDir string, opts options, errOut io.Writer) error {
+	if _, err := newWriter(opts.to, opts); err != nil {
+		return err
+	}
+	failed := 0
+	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fileOpts := opts
+		fileOpts.lang = srt.LangFromFilename(path)
+		// encoding is the encoding of the content decoded for the detection of
+		// its format, which is then read as UTF-8 rather than decoded again
+		encoding := ""
+		if opts.from == "" {
+			decoded, name, err := decodeContent(content, opts)
+			if err != nil {
+				fmt.Fprintf(errOut, "failed to convert %s: %v\n", rel, err)
+				failed++
+				return nil
+			}
+			format, _ := caps.DetectFormat(decoded)
+			if format == "" {
+				fmt.Fprintf(errOut, "skipping %s: unable to detect caption format\n", rel)
+				return nil
+			}
+			content, encoding = decoded, name
+			fileOpts.from, fileOpts.encoding = format, caps.EncodingUTF8
+		}
+		captionSet, readEncoding, warnings, err := readCaptions(bytes.NewReader(content), fileOpts)
+		if err != nil {
+			fmt.Fprintf(errOut, "failed to convert %s: %v\n", rel, err)
+			failed++
+			return nil
+		}
+		if encoding == "" {
+			encoding = readEncoding
+		}
+		if encoding != caps.EncodingUTF8 && encoding != opts.encoding {
+			fmt.Fprintf(errOut, "input encoding of %s: %s\n", rel, encoding)
+		}
+		for _, warning := range warnings {
+			fmt.Fprintf(errOut, "warning in %s: %s\n", rel, warning)
+		}
+		target := filepath.Join(outputDir, strings.TrimSuffix(rel, filepath.Ext(rel))+extensions[opts.to])
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return writeCaptions(captionSet, target, opts, nil, errOut)
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files failed to convert", failed)
+	}
+	return nil
+}
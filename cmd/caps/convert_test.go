@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	sampleSRT = `1
+00:00:09,209 --> 00:00:12,312
+( clock ticking )
+`
+	sampleVTT = "WEBVTT\n\n00:00:09.209 --> 00:00:12.312\n( clock ticking )\n"
+)
+
+func TestRunStdinStdout(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-to", "webvtt"}, strings.NewReader(sampleSRT), stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, sampleVTT, stdout.String())
+}
+
+func TestRunExplicitFormat(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-from", "webvtt", "-to", "webvtt", "-"}, strings.NewReader(sampleSRT), stdout, stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "error reading webvtt")
+}
+
+func TestRunMissingTarget(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{}, strings.NewReader(sampleSRT), stdout, stderr)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr.String(), "missing output format")
+}
+
+func TestRunRecover(t *testing.T) {
+	input := "1\n00:00:09.209 --> 00:00:12.312\n( clock ticking )\n"
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-to", "webvtt", "-recover", "repair"}, strings.NewReader(input), stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, sampleVTT, stdout.String())
+	assert.Contains(t, stderr.String(), "caps: warning: srt: line 2")
+
+	code = run([]string{"-to", "webvtt", "-recover", "fix"}, strings.NewReader(input), stdout, stderr)
+	assert.Equal(t, 2, code)
+}
+
+func TestRunSpeakers(t *testing.T) {
+	input := "1\n00:00:09,209 --> 00:00:12,312\nMAN:\nWhen we think\n"
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-to", "webvtt", "-speakers"}, strings.NewReader(input), stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "WEBVTT\n\n00:00:09.209 --> 00:00:12.312\n<v MAN>When we think</v>\n", stdout.String())
+}
+
+func TestRunBatch(t *testing.T) {
+	input, err := ioutil.TempDir("", "caps-input")
+	assert.Nil(t, err)
+	defer os.RemoveAll(input)
+	output, err := ioutil.TempDir("", "caps-output")
+	assert.Nil(t, err)
+	defer os.RemoveAll(output)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(input, "season1"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(input, "movie.srt"), []byte(sampleSRT), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(input, "season1", "episode1.vtt"), []byte(sampleVTT), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(input, "notes.txt"), []byte("not captions"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(input, "latin1.srt"), []byte(strings.Replace(sampleSRT, "clock", "h\xe9\xe9", 1)), 0644))
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-to", "webvtt", "-batch", "-o", output, input}, nil, stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stderr.String(), "skipping notes.txt")
+	assert.Contains(t, stderr.String(), "input encoding of latin1.srt: windows-1252\n")
+	content, err := ioutil.ReadFile(filepath.Join(output, "latin1.vtt"))
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Replace(sampleVTT, "clock", "héé", 1), string(content))
+
+	for _, path := range []string{"movie.vtt", filepath.Join("season1", "episode1.vtt")} {
+		content, err := ioutil.ReadFile(filepath.Join(output, path))
+		assert.Nil(t, err)
+		assert.Equal(t, sampleVTT, string(content))
+	}
+}
+
+func TestRunSRTLanguages(t *testing.T) {
+	input := `<SAMI><HEAD><STYLE TYPE="text/css"><!--
+.ENUSCC {lang: en-US;}
+.FRFRCC {lang: fr-FR;}
+--></STYLE></HEAD><BODY>
+<SYNC Start=1000><P Class=ENUSCC>Hello</P><P Class=FRFRCC>Bonjour</P></SYNC>
+<SYNC Start=3000><P Class=ENUSCC>&nbsp;</P><P Class=FRFRCC>&nbsp;</P></SYNC>
+</BODY></SAMI>`
+	output, err := ioutil.TempDir("", "caps-output")
+	assert.Nil(t, err)
+	defer os.RemoveAll(output)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-to", "srt", "-o", filepath.Join(output, "movie.srt")}, strings.NewReader(input), stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	english, err := ioutil.ReadFile(filepath.Join(output, "movie.en-US.srt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1\n00:00:01,000 --> 00:00:03,000\nHello\n", string(english))
+	french, err := ioutil.ReadFile(filepath.Join(output, "movie.fr-FR.srt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1\n00:00:01,000 --> 00:00:03,000\nBonjour\n", string(french))
+
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	code = run([]string{"-to", "srt"}, strings.NewReader(input), stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "1\n00:00:01,000 --> 00:00:03,000\nHello\n", stdout.String())
+	assert.Equal(t, "caps: warning: srt holds a single language, dropping fr-FR\n", stderr.String())
+}
+
+func TestRunEncoding(t *testing.T) {
+	input := strings.Replace(sampleSRT, "clock", "h\xe9\xe9", 1)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run([]string{"-to", "webvtt"}, strings.NewReader(input), stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "caps: input encoding: windows-1252\n", stderr.String())
+	assert.Equal(t, strings.Replace(sampleVTT, "clock", "héé", 1), stdout.String())
+
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	code = run([]string{"-from", "srt", "-to", "srt", "-encoding", "windows-1252", "-output-encoding", "utf-8", "-bom"}, strings.NewReader(input), stdout, stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "", stderr.String())
+	assert.Equal(t, "\xef\xbb\xbf"+strings.Replace(sampleSRT, "clock", "héé", 1), stdout.String())
+}
@@ -0,0 +1,89 @@
+// Command caps converts caption files between the srt, webvtt, dfxp, scc and sami formats.
+//
+// Usage:
+//
+//	caps -to webvtt [flags] [input]
+//	caps -to webvtt -batch -o outdir [flags] indir
+//
+// The input format is detected from the content unless -from is given. The input
+// is read from stdin when no file (or "-") is given, and the result is written to
+// stdout unless -o is set. In batch mode every caption file found in the input
+// directory tree is converted into the -o directory, keeping the same layout.
+//
+// With -recover skip, clamp or repair, invalid cues are recovered instead of
+// failing the conversion and every recovered problem is reported on stderr.
+//
+// The language of srt input files is read from the suffix of their name, as in
+// movie.fr.srt.
+//
+// The encoding of the input is detected from its byte order mark, its XML or HTML
+// charset declaration or its content, and reported on stderr when it isn't UTF-8,
+// unless -encoding is given. With -output-encoding and -bom, the output is written
+// in another encoding than UTF-8 or preceded by a byte order mark. The dfxp and
+// sami documents then declare it in their XML declaration or charset <META>.
+//
+// With -speakers, "NAME:" prefixes starting caption lines are read as speakers,
+// written as voices by the webvtt and dfxp writers.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vimeo/caps"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("caps", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	opts := options{}
+	flags.StringVar(&opts.from, "from", "", "input format (srt, webvtt, dfxp, scc, sami), detected from the content when empty")
+	flags.StringVar(&opts.to, "to", "", "output format (srt, webvtt, dfxp, scc, sami)")
+	output := flags.String("o", "", "output file, or output directory in batch mode (default stdout)")
+	batch := flags.Bool("batch", false, "convert every caption file in the input directory tree")
+	flags.BoolVar(&opts.sccRollUp, "scc-rollup", false, "simulate roll-up captions when reading scc")
+	flags.IntVar(&opts.sccOffset, "scc-offset", 0, "offset in seconds subtracted from scc timestamps")
+	flags.BoolVar(&opts.sccDropFrame, "scc-drop-frame", false, "write scc timecodes as drop-frame (HH:MM:SS;FF)")
+	flags.BoolVar(&opts.ignoreTimingErrors, "webvtt-ignore-timing-errors", false, "don't fail on out of order or invalid webvtt cue timings")
+	flags.BoolVar(&opts.speakers, "speakers", false, `turn "NAME:" prefixes starting lines into speakers (voices)`)
+	flags.StringVar(&opts.encoding, "encoding", autoEncoding, `input encoding, e.g. windows-1252, detected from the content when "auto"`)
+	flags.StringVar(&opts.outputEncoding, "output-encoding", caps.EncodingUTF8, "output encoding, e.g. utf-16le or windows-1252")
+	flags.BoolVar(&opts.bom, "bom", false, "write a byte order mark, with the utf-8 and utf-16 output encodings")
+	recovery := flags.String("recover", "strict", "how to handle invalid cues: strict, skip, clamp or repair; recovered problems are reported as warnings")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	var err error
+	if opts.recovery, err = caps.ParseRecovery(*recovery); err != nil {
+		fmt.Fprintf(stderr, "caps: %v\n", err)
+		return 2
+	}
+	if opts.to == "" {
+		fmt.Fprintln(stderr, "caps: missing output format (-to)")
+		flags.Usage()
+		return 2
+	}
+	input := flags.Arg(0)
+	if *batch {
+		if input == "" || *output == "" {
+			fmt.Fprintln(stderr, "caps: batch mode needs an input directory and an output directory (-o)")
+			return 2
+		}
+		if err := convertTree(input, *output, opts, stderr); err != nil {
+			fmt.Fprintf(stderr, "caps: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if err := convertFile(input, *output, opts, stdin, stdout, stderr); err != nil {
+		fmt.Fprintf(stderr, "caps: %v\n", err)
+		return 1
+	}
+	return 0
+}
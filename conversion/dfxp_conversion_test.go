@@ -3,6 +3,7 @@ package conversion
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/vimeo/caps/dfxp"
 	"github.com/vimeo/caps/scc"
 	"github.com/vimeo/caps/srt"
@@ -15,3 +16,14 @@ func TestDFXPConversion(t *testing.T) {
 	webvtt.NewReader(false)
 	dfxp.NewReader()
 }
+
+func TestDFXPRegionsToWebVTT(t *testing.T) {
+	captionSet, err := dfxp.NewReader().Read([]byte(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling">
+  <head><layout><region xml:id="top" tts:origin="10% 5%" tts:extent="80% 20%" tts:displayAlign="before"/></layout></head>
+  <body><div><p begin="00:00:01.000" end="00:00:02.000" region="top">top</p></div></body>
+</tt>`))
+	assert.Nil(t, err)
+	output, err := webvtt.NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, "WEBVTT\n\nREGION\nid:top\nwidth:80%\nregionanchor:0%,0%\nviewportanchor:10%,5%\n\n00:00:01.000 --> 00:00:02.000 region:top\ntop\n", string(output))
+}
@@ -0,0 +1,102 @@
+package conversion
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vimeo/caps"
+	_ "github.com/vimeo/caps/dfxp"
+	_ "github.com/vimeo/caps/sami"
+	_ "github.com/vimeo/caps/scc"
+	_ "github.com/vimeo/caps/srt"
+	_ "github.com/vimeo/caps/webvtt"
+)
+
+const (
+	sampleSRT = `1
+00:00:09,209 --> 00:00:12,312
+( clock ticking )
+`
+	sampleVTT = `WEBVTT
+
+00:00:09.209 --> 00:00:12.312
+( clock ticking )
+`
+	sampleDFXP = `<?xml version="1.0" encoding="utf-8"?>
+<tt xml:lang="en" xmlns="http://www.w3.org/ns/ttml">
+<body><div xml:lang="en-US"><p begin="00:00:09.209" end="00:00:12.312">( clock ticking )</p></div></body>
+</tt>`
+	sampleSCC = `Scenarist_SCC V1.0
+
+00:00:09:05 94ae 94ae 9420 9420 9470 9470 a820 e3ec efe3 6b20 f4e9 e36b e96e 6720 2980 942c 942c 942f 942f
+
+00:00:12:08 942c 942c
+`
+)
+
+func TestFormats(t *testing.T) {
+	assert.Equal(t, []string{"webvtt", "scc", "dfxp", "sami", "srt"}, caps.Formats())
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		input          string
+		wantFormat     string
+		wantConfidence float64
+	}{
+		{sampleSRT, "srt", 1},
+		{sampleVTT, "webvtt", 1},
+		{sampleDFXP, "dfxp", 1},
+		{sampleSCC, "scc", 1},
+		{sampleSAMI, "sami", 1},
+		{"hello world", "", 0},
+	}
+	for _, test := range tests {
+		name, confidence := caps.DetectFormat([]byte(test.input))
+		assert.Equal(t, test.wantFormat, name)
+		assert.Equal(t, test.wantConfidence, confidence)
+	}
+}
+
+func TestConvertAuto(t *testing.T) {
+	for _, input := range []string{sampleSRT, sampleVTT, sampleDFXP, sampleSAMI} {
+		output, err := caps.ConvertAuto([]byte(input), "webvtt")
+		assert.Nil(t, err)
+		assert.Equal(t, "WEBVTT\n\n00:00:09.209 --> 00:00:12.312\n( clock ticking )\n", string(output))
+	}
+	_, err := caps.ConvertAuto([]byte(sampleSRT), "unknown")
+	assert.EqualError(t, err, `no writer registered for format "unknown"`)
+	_, err = caps.ConvertAuto([]byte("hello world"), "srt")
+	assert.EqualError(t, err, "unable to detect caption format")
+}
+
+func TestConvertAutoEncodings(t *testing.T) {
+	latin1DFXP := strings.Replace(strings.Replace(sampleDFXP, "utf-8", "ISO-8859-1", 1), "clock", "horloge qui tourne \xe0", 1)
+	output, err := caps.ConvertAuto([]byte(latin1DFXP), "webvtt")
+	assert.Nil(t, err)
+	assert.Equal(t, "WEBVTT\n\n00:00:09.209 --> 00:00:12.312\n( horloge qui tourne à ticking )\n", string(output))
+
+	// UTF-8 content whose declaration names another encoding
+	mislabeledDFXP := strings.Replace(strings.Replace(sampleDFXP, "utf-8", "ISO-8859-1", 1), "clock", "café", 1)
+	output, err = caps.ConvertAuto([]byte(mislabeledDFXP), "webvtt")
+	assert.Nil(t, err)
+	assert.Equal(t, "WEBVTT\n\n00:00:09.209 --> 00:00:12.312\n( café ticking )\n", string(output))
+
+	utf16SAMI := []byte{0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(sampleSAMI)) {
+		utf16SAMI = append(utf16SAMI, byte(u), byte(u>>8))
+	}
+	output, err = caps.ConvertAuto(utf16SAMI, "webvtt")
+	assert.Nil(t, err)
+	assert.Equal(t, "WEBVTT\n\n00:00:09.209 --> 00:00:12.312\n( clock ticking )\n", string(output))
+}
+
+func TestRegisterTwice(t *testing.T) {
+	writer, err := caps.GetWriter("srt")
+	assert.Nil(t, err)
+	assert.PanicsWithValue(t, "caps: Register called twice for format srt", func() {
+		caps.Register("srt", nil, writer)
+	})
+}
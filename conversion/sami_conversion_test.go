@@ -1,9 +1,12 @@
 package conversion
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/vimeo/caps/dfxp"
+	"github.com/vimeo/caps/sami"
 	"github.com/vimeo/caps/scc"
 	"github.com/vimeo/caps/srt"
 	"github.com/vimeo/caps/webvtt"
@@ -14,4 +17,38 @@ func TestSAMIConversion(t *testing.T) {
 	srt.NewReader()
 	webvtt.NewReader(false)
 	dfxp.NewReader()
+	sami.NewReader()
 }
+
+func TestSAMItoDFXPStyles(t *testing.T) {
+	captionSet, err := sami.NewReader().Read([]byte(sampleSAMI))
+	assert.Nil(t, err)
+	output, err := dfxp.NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(output), `<style xml:id="p" tts:textAlign="center" tts:fontFamily="Arial" tts:fontSize="10pt" tts:color="#ffeedd"></style>`), string(output))
+	assert.True(t, strings.Contains(string(output), `<div xml:lang="en-US"><p begin="00:00:09.209" end="00:00:12.312" style="p">( clock ticking )</p>`), string(output))
+}
+
+func TestSAMItoDFXPClassStyles(t *testing.T) {
+	captionSet, err := sami.NewReader().Read([]byte(strings.Replace(sampleSAMI, "SAMI_Type: CC;", "SAMI_Type: CC; font-style: italic;", 1)))
+	assert.Nil(t, err)
+	output, err := dfxp.NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(output), `<style xml:id="ENCC" tts:fontStyle="italic"></style>`)
+	assert.Contains(t, string(output), `<p begin="00:00:09.209" end="00:00:12.312" style="p ENCC">( clock ticking )</p>`)
+}
+
+const sampleSAMI = `<SAMI>
+<HEAD>
+<STYLE TYPE="text/css">
+<!--
+P { margin-left: 1pt; text-align: center; font-size: 10pt; font-family: Arial; color: #ffeedd; }
+.ENCC {Name: English; lang: en-US; SAMI_Type: CC;}
+-->
+</STYLE>
+</HEAD>
+<BODY>
+<SYNC Start=9209><P Class=ENCC>( clock ticking )</P></SYNC>
+<SYNC Start=12312><P Class=ENCC>&nbsp;</P></SYNC>
+</BODY>
+</SAMI>`
@@ -3,6 +3,7 @@ package conversion
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/vimeo/caps/dfxp"
 	"github.com/vimeo/caps/scc"
 	"github.com/vimeo/caps/srt"
@@ -15,3 +16,29 @@ func TestSRTConversion(t *testing.T) {
 	webvtt.NewReader(false)
 	dfxp.NewReader()
 }
+
+func TestSCCItalicsToSRT(t *testing.T) {
+	captionSet, err := webvtt.NewReader(false).Read([]byte("WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nplain <i>italic\nnext</i>\n"))
+	assert.Nil(t, err)
+	content, err := scc.NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	captionSet, err = scc.DefaultReader().Read(content)
+	assert.Nil(t, err)
+	result, err := srt.NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), "plain <i>italic\nnext</i>\n")
+}
+
+func TestSRTTopPlacementToWebVTT(t *testing.T) {
+	captionSet, err := srt.NewReader().Read([]byte("1\n00:00:01,000 --> 00:00:02,000\n{\\an8}top\n"))
+	assert.Nil(t, err)
+	result, err := webvtt.NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, "WEBVTT\n\n00:00:01.000 --> 00:00:02.000 line:0\ntop\n", string(result))
+
+	captionSet, err = webvtt.NewReader(false).Read(result)
+	assert.Nil(t, err)
+	result, err = srt.NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, "1\n00:00:01,000 --> 00:00:02,000\n{\\an8}top\n", string(result))
+}
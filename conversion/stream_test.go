@@ -0,0 +1,42 @@
+package conversion
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vimeo/caps"
+)
+
+func TestStreamingMatchesBytes(t *testing.T) {
+	samples := map[string]string{
+		"srt":    sampleSRT,
+		"webvtt": sampleVTT,
+		"dfxp":   sampleDFXP,
+		"scc":    sampleSCC,
+		"sami":   sampleSAMI,
+	}
+	for _, format := range caps.Formats() {
+		t.Run(format, func(t *testing.T) {
+			reader, err := caps.GetReader(format)
+			assert.Nil(t, err)
+			writer, err := caps.GetWriter(format)
+			assert.Nil(t, err)
+			assert.Implements(t, (*caps.StreamReader)(nil), reader)
+			assert.Implements(t, (*caps.StreamWriter)(nil), writer)
+
+			want, err := reader.Read([]byte(samples[format]))
+			assert.Nil(t, err)
+			got, err := caps.ReadStream(reader, strings.NewReader(samples[format]))
+			assert.Nil(t, err)
+			assert.Equal(t, want, got)
+
+			wantOutput, err := writer.Write(want)
+			assert.Nil(t, err)
+			var output bytes.Buffer
+			assert.Nil(t, caps.WriteStream(writer, &output, got))
+			assert.Equal(t, string(wantOutput), output.String())
+		})
+	}
+}
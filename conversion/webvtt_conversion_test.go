@@ -3,6 +3,8 @@ package conversion
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/vimeo/caps"
 	"github.com/vimeo/caps/dfxp"
 	"github.com/vimeo/caps/scc"
 	"github.com/vimeo/caps/srt"
@@ -15,3 +17,42 @@ func TestWEBVTTConversion(t *testing.T) {
 	webvtt.NewReader(false)
 	dfxp.NewReader()
 }
+
+func TestWebVTTItalicsToSCC(t *testing.T) {
+	captionSet, err := webvtt.NewReader(false).Read([]byte("WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nplain <i>italic\nnext</i>\n"))
+	assert.Nil(t, err)
+	result, err := scc.NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	roundTrip, err := scc.DefaultReader().Read(result)
+	assert.Nil(t, err)
+
+	italics := caps.DefaultStyleProps()
+	italics.Italics = true
+	assert.Equal(t, []caps.CaptionContent{
+		caps.NewCaptionText("plain "),
+		caps.NewCaptionStyle(true, italics),
+		caps.NewCaptionText("italic"),
+		caps.NewLineBreak(),
+		caps.NewCaptionText("next"),
+		caps.NewCaptionStyle(false, italics),
+	}, roundTrip.GetCaptions(caps.DefaultLang)[0].Nodes)
+}
+
+func TestWebVTTInlineTimestampsToDFXP(t *testing.T) {
+	captionSet, err := webvtt.NewReader(false).Read([]byte("WEBVTT\n\n00:00:01.000 --> 00:00:03.000\nNever <00:00:01.500>drink\n<00:00:02.250>liquid\n"))
+	assert.Nil(t, err)
+	result, err := dfxp.NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), `Never <span begin="00:00:00.500">drink<br/></span><span begin="00:00:01.250">liquid</span></p>`)
+
+	roundTrip, err := dfxp.NewReader().Read(result)
+	assert.Nil(t, err)
+	caption := roundTrip.GetCaptions(caps.DefaultLang)[0]
+	stamps := []caps.Timestamp{}
+	for _, node := range caption.Nodes {
+		if stamp, ok := node.(caps.CaptionTimestamp); ok {
+			stamps = append(stamps, stamp.Time)
+		}
+	}
+	assert.Equal(t, []caps.Timestamp{caps.NewTimestamp(1500000), caps.NewTimestamp(2250000)}, stamps)
+}
@@ -4,43 +4,71 @@ import (
 	"encoding/xml"
 
 	"github.com/vimeo/caps"
+	"github.com/vimeo/caps/timecode"
 )
 
+const format = "dfxp"
+
+func init() {
+	caps.Register("dfxp", NewReader(), NewWriter())
+}
+
 func NewReader() caps.CaptionReader {
 	return &reader{
-		framerate:  "30",
-		multiplier: []int{1, 1},
-		timebase:   "media",
-		nodes:      []caps.CaptionContent{},
+		rate:     timecode.Rate30,
+		timebase: "media",
+		tickRate: timecode.Rate{Num: 1, Den: 1},
+		nodes:    []caps.CaptionContent{},
 	}
 }
 
 func NewWriter() caps.CaptionWriter {
-	return &writer{
-		false,
-		false,
-	}
+	return &writer{}
 }
 
 type Head struct {
-	Style  Style  `xml:"styling>style"`
-	Layout Region `xml:"layout>region"`
+	Metadata *Metadata `xml:"metadata,omitempty"`
+	Styles   []Style   `xml:"styling>style"`
+	Layout   []Region  `xml:"layout>region"`
+}
+
+// Metadata is the metadata element of the head, only written when there are agents.
+type Metadata struct {
+	Agents []Agent `xml:"ttm:agent"`
 }
 
 type Region struct {
 	XMLName         xml.Name `xml:"region"`
 	ID              string   `xml:"xml:id,attr"`
+	TTSOrigin       string   `xml:"tts:origin,attr,omitempty"`
+	TTSExtent       string   `xml:"tts:extent,attr,omitempty"`
 	TTSTextAlign    string   `xml:"tts:textAlign,attr,omitempty"`
 	TTSDisplayAlign string   `xml:"tts:displayAlign,attr,omitempty"`
+	TTSWritingMode  string   `xml:"tts:writingMode,attr,omitempty"`
+	TTSPadding      string   `xml:"tts:padding,attr,omitempty"`
+}
+
+// Agent is a ttm:agent, identifying a speaker.
+type Agent struct {
+	XMLName xml.Name  `xml:"ttm:agent"`
+	ID      string    `xml:"xml:id,attr"`
+	Type    string    `xml:"type,attr"`
+	Name    AgentName `xml:"ttm:name"`
+}
+
+type AgentName struct {
+	Type string `xml:"type,attr"`
+	Name string `xml:",chardata"`
 }
 
 type Paragraph struct {
 	XMLName xml.Name `xml:"p"`
 	Begin   string   `xml:"begin,attr"`
 	End     string   `xml:"end,attr"`
-	StyleID string   `xml:"style,attr"`
+	StyleID string   `xml:"style,attr,omitempty"`
+	Region  string   `xml:"region,attr,omitempty"`
+	Agent   string   `xml:"ttm:agent,attr,omitempty"`
 	Content string   `xml:",innerxml"`
-	Span    *Span    `xml:",omitempty"`
 }
 
 type Lang struct {
@@ -59,25 +87,30 @@ type BaseMarkup struct {
 	TtXMLLang  string   `xml:"xml:lang,attr" default:"en"`
 	TtXMLns    string   `xml:"xmlns,attr" default:"http://www.w3.org/ns/ttml"`
 	TtXMLnsTTS string   `xml:"xmlns:tts,attr" default:"http://www.w3.org/ns/ttml#styling"`
+	TtXMLnsTTM string   `xml:"xmlns:ttm,attr,omitempty"`
 	Head       Head     `xml:"head"`
 	Body       Body     `xml:"body"`
 }
 
+// Span is the start tag of a span of the content of a paragraph, which is written
+// as inner XML.
 type Span struct {
 	XMLName xml.Name `xml:"span"`
-	Text    string   `xml:",chardata"`
 	Style
 }
 
 type Style struct {
-	XMLName       xml.Name `xml:"style"`
-	ID            string   `xml:"xml:id,attr,omitempty"`
-	TTSTextAlign  string   `xml:"tts:textAlign,attr,omitempty"`
-	TTSFontStyle  string   `xml:"tts:fontStyle,attr,omitempty"`
-	TTSFontFamily string   `xml:"tts:fontFamily,attr,omitempty"`
-	TTSFontSize   string   `xml:"tts:fontSize,attr,omitempty"`
-	TTSFontWeight string   `xml:"tts:fontweight,attr,omitempty"`
-	TTSColor      string   `xml:"tts:color,attr,omitempty"`
+	XMLName xml.Name `xml:"style"`
+	ID      string   `xml:"xml:id,attr,omitempty"`
+	// StyleRef references the styles applied before the attributes
+	StyleRef          string `xml:"style,attr,omitempty"`
+	TTSTextAlign      string `xml:"tts:textAlign,attr,omitempty"`
+	TTSFontStyle      string `xml:"tts:fontStyle,attr,omitempty"`
+	TTSFontFamily     string `xml:"tts:fontFamily,attr,omitempty"`
+	TTSFontSize       string `xml:"tts:fontSize,attr,omitempty"`
+	TTSFontWeight     string `xml:"tts:fontWeight,attr,omitempty"`
+	TTSColor          string `xml:"tts:color,attr,omitempty"`
+	TTSTextDecoration string `xml:"tts:textDecoration,attr,omitempty"`
 	// FIXME this is never parsed to Style
 	TTSDisplayAlign string `xml:"tts:displayAlign,attr,omitempty"`
 }
@@ -2,13 +2,14 @@ package dfxp
 
 import (
 	"encoding/xml"
-	"fmt"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestStructToXML(t *testing.T) {
-	base := Span{xml.Name{}, "bla blablab bla alba", Style{TTSTextAlign: "center"}}
+	base := Span{Style: Style{TTSTextAlign: "center"}}
 	output, err := xml.MarshalIndent(base, "  ", "    ")
-	fmt.Println(err)
-	fmt.Println(string(output))
+	assert.Nil(t, err)
+	assert.Equal(t, `  <span tts:textAlign="center"></span>`, string(output))
 }
@@ -1,20 +1,62 @@
 package dfxp
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/antchfx/xmlquery"
 	"github.com/vimeo/caps"
+	"github.com/vimeo/caps/timecode"
 )
 
+// errNoBegin is returned by findTimes for elements without a begin time.
+var errNoBegin = errors.New("tag doesnt have a time begin")
+
+// offsetTime matches the TTML offset times, e.g. "10s", "1.5h" or "100ms".
+var offsetTime = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)(h|ms|m|s|f|t)$`)
+
 type reader struct {
-	framerate  string
-	multiplier []int
-	timebase   string
-	nodes      []caps.CaptionContent
+	rate     timecode.Rate
+	timebase string
+	// tickRate is the number of ticks per second of "t" offset times, kept as
+	// a rate so ticks convert like frames
+	tickRate timecode.Rate
+	nodes    []caps.CaptionContent
+	recovery caps.Recovery
+	warn     caps.WarningFunc
+	warnings []caps.Warning
+	// agents holds the names of the ttm:agent elements, by ID
+	agents map[string]string
+	// start is the begin time of the paragraph being translated, in microseconds
+	start int
+	// styles and regions hold the style and region elements, by ID
+	styles  map[string]*xmlquery.Node
+	regions map[string]*xmlquery.Node
+}
+
+// styleAttributes are the lower-cased names of the attributes read as styles, the
+// layout ones of regions included.
+var styleAttributes = map[string]bool{
+	"origin":         true,
+	"extent":         true,
+	"displayalign":   true,
+	"writingmode":    true,
+	"padding":        true,
+	"fontstyle":      true,
+	"textalign":      true,
+	"fontfamily":     true,
+	"fontsize":       true,
+	"color":          true,
+	"fontweight":     true,
+	"textdecoration": true,
 }
 
 func (r reader) Detect(content []byte) bool {
@@ -23,98 +65,158 @@ func (r reader) Detect(content []byte) bool {
 }
 
 func (r reader) Read(content []byte) (*caps.CaptionSet, error) {
-	doc, err := xmlquery.Parse(strings.NewReader(string(content)))
+	return r.ReadStream(bytes.NewReader(content))
+}
+
+// ReadStream parses the document from in, without keeping a copy of the raw content.
+func (r reader) ReadStream(in io.Reader) (*caps.CaptionSet, error) {
+	r.warnings = []caps.Warning{}
+	captions, warnings, err := r.read(in)
+	r.warn.Report(warnings)
+	return captions, err
+}
+
+// WithRecovery returns a copy of the reader falling back to the default frame rate
+// when the document's one is invalid and recovering from invalid timings.
+func (r reader) WithRecovery(recovery caps.Recovery, warn caps.WarningFunc) caps.CaptionReader {
+	r.recovery, r.warn = recovery, warn
+	return &r
+}
+
+func (r *reader) read(in io.Reader) (*caps.CaptionSet, []caps.Warning, error) {
+	doc, err := xmlquery.Parse(in)
 	if err != nil {
-		return nil, err
+		parseErr := &caps.ParseError{Format: format, Code: caps.ErrCodeSyntax, Err: err}
+		var syntaxErr *xml.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			parseErr.Line = syntaxErr.Line
+		}
+		return nil, nil, parseErr
 	}
 
 	captions := caps.NewCaptionSet()
 	tts := xmlquery.Find(doc, "/tt")
 	if len(tts) >= 1 {
 		tt := tts[0]
-		r.timebase = "0"
-		if timebase := tt.SelectAttr("ttp:timebase"); timebase != "" {
+		r.timebase = "media"
+		if timebase := ttAttr(tt, "timeBase"); timebase != "" {
 			r.timebase = timebase
 		}
-		r.framerate = "30"
-		if framerate := tt.SelectAttr("ttp:framerate"); framerate != "" {
-			r.framerate = framerate
-		}
-
-		r.multiplier = []int{1, 1}
-		if multiplier := tt.SelectAttr("ttp:framemultiplier"); multiplier != "" {
-			multipliers := strings.Split(multiplier, " ")
-			a, err := strconv.Atoi(multipliers[0])
-			if err != nil {
-				return nil, fmt.Errorf("failed to read multiplier: %w", err)
-			}
-			b, err := strconv.Atoi(multipliers[1])
-			if err != nil {
-				return nil, fmt.Errorf("failed to read multiplier: %w", err)
+		rate, err := readFrameRate(tt)
+		if err != nil {
+			parseErr := &caps.ParseError{Format: format, Snippet: ttParameters(tt), Code: caps.ErrCodeParameter, Err: err}
+			if r.recovery == caps.Strict {
+				return nil, nil, parseErr
 			}
-			r.multiplier = []int{a, b}
+			r.warnings = append(r.warnings, caps.Warning{Err: parseErr, Action: caps.ActionSkipped})
+		} else {
+			r.rate = rate
 		}
+		r.tickRate = readTickRate(tt, r.rate)
 	}
+	r.agents = readAgents(doc)
+	r.styles = readElements(doc, "//style")
+	r.regions = readElements(doc, "//region")
 	for _, div := range xmlquery.Find(doc, "//div") {
 		lang := div.SelectAttr("xml:lang")
 		if lang == "" {
 			lang = caps.DefaultLang
 		}
-		captions.SetCaptions(lang, r.translateDiv(div))
+		divCaptions, err := r.translateDiv(div)
+		if err != nil {
+			return nil, nil, err
+		}
+		divCaptions, warnings := caps.RecoverTimings(format, divCaptions, nil, r.recovery)
+		r.warnings = append(r.warnings, warnings...)
+		captions.SetCaptions(lang, divCaptions)
 	}
 
-	for _, style := range xmlquery.Find(doc, "//style") {
-		id := style.SelectAttr("id")
-		if id == "" {
-			id = style.SelectAttr("xml:id")
-		}
-		parsedStyle := r.translateStyle(style)
+	width, height := rootExtent(doc)
+	for id, region := range r.regions {
+		captions.AddRegion(r.translateRegion(id, region, width, height))
+	}
+	for id, style := range r.styles {
+		// the styles are resolved, their references aren't kept
+		parsedStyle := newStyleProps(r.styleAttrs(style, map[string]bool{}))
 		parsedStyle.ID = id
 		captions.AddStyle(parsedStyle)
 	}
 	captions = r.combineMatchingCaptions(captions)
 	if captions.IsEmpty() {
-		return captions, fmt.Errorf("empty caption file")
+		return captions, nil, caps.NewEmptyFileError(format)
 	}
-	return captions, nil
+	return captions, r.warnings, nil
 }
 
 func (r reader) combineMatchingCaptions(captionSet *caps.CaptionSet) *caps.CaptionSet {
 	for _, lang := range captionSet.Languages() {
 		captions := captionSet.GetCaptions(lang)
 		if len(captions) <= 1 {
-			return captionSet
+			continue
 		}
 		newCaps := captions[:1]
 
 		for _, caption := range captions[1:] {
 			lastIndex := len(newCaps) - 1
-			if caption.Start == newCaps[lastIndex].Start && caption.End == newCaps[lastIndex].End {
+			if caption.Start.Equal(newCaps[lastIndex].Start) && caption.End.Equal(newCaps[lastIndex].End) {
 				newCaps[lastIndex].Nodes = append(newCaps[lastIndex].Nodes, caps.NewLineBreak())
 				newCaps[lastIndex].Nodes = append(newCaps[lastIndex].Nodes, caption.Nodes...)
 				continue
 			}
 			newCaps = append(newCaps, caption)
-			captionSet.SetCaptions(lang, newCaps)
 		}
+		captionSet.SetCaptions(lang, newCaps)
 	}
 	return captionSet
 }
 
-func (r reader) translateDiv(div *xmlquery.Node) []*caps.Caption {
+// translateDiv returns the captions of the paragraphs of the div, timed by the div
+// when it has a begin time. Paragraphs without a begin time are skipped.
+func (r *reader) translateDiv(div *xmlquery.Node) ([]*caps.Caption, error) {
 	captions := []*caps.Caption{}
+	start, end, divErr := r.findTimes(div)
+	if divErr != nil && !errors.Is(divErr, errNoBegin) {
+		if err := r.recover(divErr); err != nil {
+			return nil, err
+		}
+		// the paragraphs are timed on their own
+		divErr = errNoBegin
+	}
 	for _, pTag := range xmlquery.Find(div, "//p") {
-		if start, end, err := r.findTimes(div); err == nil {
+		if divErr == nil {
 			captions = append(captions, r.translateParentTimedParagraph(pTag, start, end))
-		} else if c, err := r.translatePtag(pTag); err == nil {
-			captions = append(captions, c)
+			continue
+		}
+		c, err := r.translatePtag(pTag)
+		if errors.Is(err, errNoBegin) {
+			continue
+		}
+		if err != nil {
+			if err := r.recover(err); err != nil {
+				return nil, err
+			}
+			continue
 		}
+		captions = append(captions, c)
 	}
-	return captions
+	return captions, nil
+}
+
+// recover records a warning for the invalid times of an element, which is skipped
+// whatever the recovery since a single malformed paragraph doesn't prevent reading
+// the rest of the document. Other errors are returned.
+func (r *reader) recover(err error) error {
+	var parseErr *caps.ParseError
+	if !errors.As(err, &parseErr) {
+		return err
+	}
+	r.warnings = append(r.warnings, caps.Warning{Err: parseErr, Action: caps.ActionSkipped})
+	return nil
 }
 
 func (r *reader) translateParentTimedParagraph(paragraph *xmlquery.Node, start, end int) *caps.Caption {
 	r.nodes = []caps.CaptionContent{}
+	r.start = start
 
 	brs := xmlquery.Find(paragraph, "//br")
 	if len(brs) == 0 {
@@ -128,12 +230,48 @@ func (r *reader) translateParentTimedParagraph(paragraph *xmlquery.Node, start,
 		}
 	}
 
-	styles := r.translateStyle(paragraph)
-	s, e := float64(start), float64(end)
-	caption := caps.NewCaption(&s, &e, r.nodes, styles)
+	styles := r.paragraphStyle(paragraph)
+	nodes := trimSpaces(r.nodes)
+	if speaker := r.speaker(paragraph); speaker != "" {
+		nodes = append([]caps.CaptionContent{caps.NewCaptionSpan(true, caps.SpanVoice, speaker, "")}, nodes...)
+		nodes = append(nodes, caps.NewCaptionSpan(false, caps.SpanVoice, speaker, ""))
+	}
+	caption := caps.NewCaption(caps.NewTimestamp(int64(start)), caps.NewTimestamp(int64(end)), nodes, styles)
+	if region := regionRef(paragraph); r.regions[region] != nil {
+		caption.Placement.Region = region
+	}
 	return &caption
 }
 
+// readAgents returns the names of the ttm:agent elements by ID, the ID being
+// the name of agents without a ttm:name.
+func readAgents(doc *xmlquery.Node) map[string]string {
+	agents := map[string]string{}
+	for _, agent := range xmlquery.Find(doc, "//ttm:agent") {
+		id := agent.SelectAttr("xml:id")
+		if id == "" {
+			continue
+		}
+		agents[id] = id
+		if name := xmlquery.FindOne(agent, "ttm:name"); name != nil && strings.TrimSpace(name.InnerText()) != "" {
+			agents[id] = strings.TrimSpace(name.InnerText())
+		}
+	}
+	return agents
+}
+
+// speaker returns the name of the first agent of the paragraph, if any.
+func (r *reader) speaker(paragraph *xmlquery.Node) string {
+	ids := strings.Fields(paragraph.SelectAttr("ttm:agent"))
+	if len(ids) == 0 {
+		return ""
+	}
+	if name, ok := r.agents[ids[0]]; ok {
+		return name
+	}
+	return ids[0]
+}
+
 func (r *reader) translatePtag(paragraph *xmlquery.Node) (*caps.Caption, error) {
 	start, end, err := r.findTimes(paragraph)
 	if err != nil {
@@ -153,8 +291,7 @@ func (r *reader) translateTag(tag *xmlquery.Node) {
 		fallthrough
 	default:
 		if (tag.Data == "p" && tag.FirstChild == nil && tag.Type == 2) || tag.Type == 3 {
-			text := strings.TrimSpace(tag.InnerText())
-			if text != "" {
+			if text := trimRun(tag.InnerText()); text != "" {
 				r.nodes = append(r.nodes, caps.NewCaptionText(text))
 			}
 		} else {
@@ -167,8 +304,77 @@ func (r *reader) translateTag(tag *xmlquery.Node) {
 	}
 }
 
+// trimRun returns the text with the whitespace around it, like the indentation
+// of the document, replaced with a single space, which separates it from the text
+// of the next nodes. The whitespace inside the text is kept as is.
+func trimRun(text string) string {
+	run := strings.TrimSpace(text)
+	if run == "" {
+		if text != "" {
+			return " "
+		}
+		return ""
+	}
+	if strings.TrimLeftFunc(text, unicode.IsSpace) != text {
+		run = " " + run
+	}
+	if strings.TrimRightFunc(text, unicode.IsSpace) != text {
+		run += " "
+	}
+	return run
+}
+
+// trimSpaces removes the spaces starting and ending the lines of the nodes, and
+// the ones following another space in the previous text node.
+func trimSpaces(nodes []caps.CaptionContent) []caps.CaptionContent {
+	trimmed := []caps.CaptionContent{}
+	// last is the index of the last text node of the line, -1 when there is none
+	last := -1
+	afterSpace := true
+	trimEnd := func() {
+		if last < 0 {
+			return
+		}
+		if text := strings.TrimRight(trimmed[last].Content(), " "); text != "" {
+			trimmed[last] = caps.NewCaptionText(text)
+		} else {
+			trimmed = append(trimmed[:last], trimmed[last+1:]...)
+		}
+	}
+	for _, node := range nodes {
+		if node.Text() {
+			text := node.Content()
+			if afterSpace {
+				text = strings.TrimLeft(text, " ")
+			}
+			if text != "" {
+				afterSpace = strings.HasSuffix(text, " ")
+				last = len(trimmed)
+				trimmed = append(trimmed, caps.NewCaptionText(text))
+			}
+			continue
+		}
+		if node.LineBreak() {
+			trimEnd()
+			last, afterSpace = -1, true
+		}
+		trimmed = append(trimmed, node)
+	}
+	trimEnd()
+	return trimmed
+}
+
+// translateSpan adds the nodes of a span between a pair of caps.CaptionStyle nodes,
+// preceded by a caps.CaptionTimestamp when the span has its own begin time, relative
+// to the paragraph.
 func (r *reader) translateSpan(tag *xmlquery.Node) {
-	style := r.translateStyle(tag)
+	if begin := tag.SelectAttr("begin"); begin != "" {
+		if offset, err := r.translateTime(begin); err == nil {
+			r.nodes = append(r.nodes, caps.NewCaptionTimestamp(caps.NewTimestamp(int64(r.start+offset))))
+		}
+	}
+	style := newStyleProps(r.styleAttrs(tag, map[string]bool{}))
+	style.Class = tag.SelectAttr("style")
 	captionStyle := caps.NewCaptionStyle(true, style)
 	r.nodes = append(r.nodes, captionStyle)
 	// for some reason xmlquery.Find(tag, "child::*") doesnt work here
@@ -177,111 +383,343 @@ func (r *reader) translateSpan(tag *xmlquery.Node) {
 		r.translateTag(child)
 		child = child.NextSibling
 	}
-	//	secondStyle := CreateCaptionStyle(false, style)
-	//	r.nodes = append(r.nodes, secondStyle)
-	//	return // <- this return was uncommented
-	// FIXME this is duped, porting as is for now
-	//	for _, child := range xmlquery.Find(tag, "child::*") {
-	//r.translateTag(child)
-	//	}
+	r.nodes = append(r.nodes, caps.NewCaptionStyle(false, style))
+}
+
+// readElements returns the elements matching expr by ID, elements without an ID
+// being skipped.
+func readElements(doc *xmlquery.Node, expr string) map[string]*xmlquery.Node {
+	elements := map[string]*xmlquery.Node{}
+	for _, element := range xmlquery.Find(doc, expr) {
+		id := element.SelectAttr("id")
+		if id == "" {
+			id = element.SelectAttr("xml:id")
+		}
+		if id != "" {
+			elements[id] = element
+		}
+	}
+	return elements
 }
 
-func (r reader) translateStyle(tag *xmlquery.Node) caps.StyleProps {
-	style := caps.StyleProps{}
+// styleAttrs returns the style attributes of the element, by lower-cased name: those
+// of the styles it references, in order, overridden by those of the style elements
+// of a region, overridden by its own. seen holds the styles being resolved, whose
+// references are ignored to break cycles.
+func (r *reader) styleAttrs(tag *xmlquery.Node, seen map[string]bool) map[string]string {
+	attrs := map[string]string{}
+	merge := func(values map[string]string) {
+		for name, value := range values {
+			attrs[name] = value
+		}
+	}
+	for _, id := range strings.Fields(tag.SelectAttr("style")) {
+		if style, ok := r.styles[id]; ok && !seen[id] {
+			seen[id] = true
+			merge(r.styleAttrs(style, seen))
+			delete(seen, id)
+		}
+	}
+	if tag.Data == "region" {
+		for child := tag.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == xmlquery.ElementNode && child.Data == "style" {
+				merge(r.styleAttrs(child, seen))
+			}
+		}
+	}
 	for _, attr := range tag.Attr {
-		switch strings.ToLower(attr.Name.Local) {
-		case "style":
-			style.Class = attr.Value
-		case "fontstyle":
-			style.Italics = attr.Value == "italic"
-		case "textalign":
-			style.TextAlign = attr.Value
-		case "fontfamily":
-			style.FontFamily = attr.Value
-		case "fontsize":
-			style.FontSize = attr.Value
-		case "color":
-			style.Color = attr.Value
-		case "fontweight":
-			style.Bold = attr.Value == "bold"
-		case "textdecoration":
-			style.Underline = attr.Value == "underline"
+		if name := strings.ToLower(attr.Name.Local); styleAttributes[name] {
+			attrs[name] = attr.Value
 		}
 	}
+	return attrs
+}
+
+// paragraphStyle returns the computed style of the paragraph: the style of its
+// region, overridden by the styles inherited from its ancestors, overridden by its
+// own. Class holds the styles referenced by the paragraph and its ancestors.
+func (r *reader) paragraphStyle(paragraph *xmlquery.Node) caps.StyleProps {
+	ancestors := []*xmlquery.Node{}
+	for n := paragraph; n != nil; n = n.Parent {
+		if n.Type == xmlquery.ElementNode {
+			ancestors = append([]*xmlquery.Node{n}, ancestors...)
+		}
+	}
+	attrs := map[string]string{}
+	if tag, ok := r.regions[regionRef(paragraph)]; ok {
+		attrs = r.styleAttrs(tag, map[string]bool{})
+	}
+	refs := []string{}
+	referenced := map[string]bool{}
+	for _, n := range ancestors {
+		for name, value := range r.styleAttrs(n, map[string]bool{}) {
+			attrs[name] = value
+		}
+		for _, id := range strings.Fields(n.SelectAttr("style")) {
+			if !referenced[id] {
+				referenced[id] = true
+				refs = append(refs, id)
+			}
+		}
+	}
+	style := newStyleProps(attrs)
+	style.Class = strings.Join(refs, " ")
 	return style
 }
 
+// regionRef returns the region of the element, inherited from its ancestors.
+func regionRef(tag *xmlquery.Node) string {
+	for n := tag; n != nil; n = n.Parent {
+		if region := n.SelectAttr("region"); n.Type == xmlquery.ElementNode && region != "" {
+			return region
+		}
+	}
+	return ""
+}
+
+// translateRegion returns the region of a region element, whose pixel lengths are
+// relative to the width and height of the root container. A region without origin
+// or extent covers the whole video.
+func (r *reader) translateRegion(id string, tag *xmlquery.Node, width, height float64) caps.Region {
+	attrs := r.styleAttrs(tag, map[string]bool{})
+	region := caps.NewRegion(id)
+	region.RegionAnchor, region.ViewportAnchor = caps.Point{}, caps.Point{}
+	region.Width, region.Height = 100, 100
+	if x, y, ok := parseLengths(attrs["origin"], width, height); ok {
+		region.ViewportAnchor = caps.Point{X: x, Y: y}
+	}
+	if w, h, ok := parseLengths(attrs["extent"], width, height); ok {
+		region.Width, region.Height = w, h
+	}
+	region.Lines = int(math.Max(1, math.Round(region.Height*caps.DefaultRows/100)))
+	region.Align = attrs["textalign"]
+	region.DisplayAlign = attrs["displayalign"]
+	region.Padding = attrs["padding"]
+	switch attrs["writingmode"] {
+	case "tblr":
+		region.Vertical = "lr"
+	case "tbrl", "tb":
+		region.Vertical = "rl"
+	}
+	return region
+}
+
+// rootExtent returns the size in pixels of the root container set by the
+// tts:extent of the tt element, zeros when it isn't set in pixels.
+func rootExtent(doc *xmlquery.Node) (float64, float64) {
+	tt := xmlquery.FindOne(doc, "/tt")
+	if tt == nil {
+		return 0, 0
+	}
+	values := strings.Fields(tt.SelectAttr("tts:extent"))
+	if len(values) != 2 || !strings.HasSuffix(values[0], "px") || !strings.HasSuffix(values[1], "px") {
+		return 0, 0
+	}
+	width, errWidth := strconv.ParseFloat(strings.TrimSuffix(values[0], "px"), 64)
+	height, errHeight := strconv.ParseFloat(strings.TrimSuffix(values[1], "px"), 64)
+	if errWidth != nil || errHeight != nil {
+		return 0, 0
+	}
+	return width, height
+}
+
+// parseLengths returns a pair of TTML lengths as percentages of the root container,
+// pixels being converted with its width and height. ok is false for other units
+// and invalid values.
+func parseLengths(value string, width, height float64) (float64, float64, bool) {
+	values := strings.Fields(value)
+	if len(values) != 2 {
+		return 0, 0, false
+	}
+	percents := make([]float64, 2)
+	for i, size := range []float64{width, height} {
+		var err error
+		switch {
+		case strings.HasSuffix(values[i], "%"):
+			percents[i], err = strconv.ParseFloat(strings.TrimSuffix(values[i], "%"), 64)
+		case strings.HasSuffix(values[i], "px") && size > 0:
+			percents[i], err = strconv.ParseFloat(strings.TrimSuffix(values[i], "px"), 64)
+			percents[i] = percents[i] * 100 / size
+		default:
+			return 0, 0, false
+		}
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return percents[0], percents[1], true
+}
+
+// newStyleProps returns the style of the attributes returned by styleAttrs.
+func newStyleProps(attrs map[string]string) caps.StyleProps {
+	return caps.StyleProps{
+		Italics:    attrs["fontstyle"] == "italic",
+		TextAlign:  attrs["textalign"],
+		FontFamily: attrs["fontfamily"],
+		FontSize:   attrs["fontsize"],
+		Color:      attrs["color"],
+		Bold:       attrs["fontweight"] == "bold",
+		Underline:  attrs["textdecoration"] == "underline",
+	}
+}
+
 func (r reader) findTimes(root *xmlquery.Node) (int, int, error) {
 	begin := root.SelectAttr("begin")
 	if begin == "" {
-		return 0, 0, fmt.Errorf("tag doesnt have a time begin")
+		return 0, 0, errNoBegin
 	}
 	start, err := r.translateTime(begin)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, timeError("begin", begin, err)
 	}
 	endValue := root.SelectAttr("end")
 	if endValue == "" {
 		if dur := root.SelectAttr("dur"); dur != "" {
 			durParsed, err := r.translateTime(dur)
 			if err != nil {
-				return 0, 0, err
+				return 0, 0, timeError("dur", dur, err)
 			}
 			return start, start + durParsed, nil
 		}
 	}
 	end, err := r.translateTime(endValue)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, timeError("end", endValue, err)
 	}
 	return start, end, nil
 }
 
-func (r reader) translateTime(stamp string) (int, error) {
-	timesplit := strings.Split(stamp, ":")
-	if !strings.Contains(timesplit[2], ".") {
-		timesplit[2] = timesplit[2] + ".000"
+// timeError returns the ParseError for the invalid time value of the attribute name.
+func timeError(name, value string, err error) error {
+	return &caps.ParseError{Format: format, Snippet: fmt.Sprintf("%s=%q", name, value), Code: caps.ErrCodeTimestamp, Err: err}
+}
+
+// readFrameRate returns the frame rate declared by the ttp:frameRate,
+// ttp:frameRateMultiplier and ttp:dropMode attributes of the tt element.
+func readFrameRate(tt *xmlquery.Node) (timecode.Rate, error) {
+	var nominal, multiplierNum, multiplierDen int64 = 30, 1, 1
+	var err error
+	if framerate := ttAttr(tt, "frameRate"); framerate != "" {
+		nominal, err = strconv.ParseInt(strings.TrimSpace(framerate), 10, 64)
+		if err != nil {
+			return timecode.Rate{}, fmt.Errorf("failed to read frame rate: %w", err)
+		}
 	}
-	timesplit0, err := strconv.Atoi(timesplit[0])
-	if err != nil {
-		return 0, err
+	if multiplier := ttAttr(tt, "frameRateMultiplier"); multiplier != "" {
+		multipliers := strings.Fields(multiplier)
+		if len(multipliers) != 2 {
+			return timecode.Rate{}, fmt.Errorf("failed to read multiplier: invalid value %q", multiplier)
+		}
+		multiplierNum, err = strconv.ParseInt(multipliers[0], 10, 64)
+		if err != nil {
+			return timecode.Rate{}, fmt.Errorf("failed to read multiplier: %w", err)
+		}
+		multiplierDen, err = strconv.ParseInt(multipliers[1], 10, 64)
+		if err != nil {
+			return timecode.Rate{}, fmt.Errorf("failed to read multiplier: %w", err)
+		}
 	}
-	timesplit1, err := strconv.Atoi(timesplit[1])
-	if err != nil {
-		return 0, err
+	dropFrame := ttAttr(tt, "dropMode") == "dropNTSC"
+	return timecode.NewRate(nominal, multiplierNum, multiplierDen, dropFrame)
+}
+
+// readTickRate returns the tick rate declared by ttp:tickRate. Without it, the
+// tick rate is the frame rate times the sub-frame rate when the document declares
+// a frame rate, and one tick per second otherwise.
+func readTickRate(tt *xmlquery.Node, rate timecode.Rate) timecode.Rate {
+	if tickRate, err := strconv.ParseInt(strings.TrimSpace(ttAttr(tt, "tickRate")), 10, 64); err == nil && tickRate > 0 {
+		return timecode.Rate{Num: tickRate, Den: 1}
 	}
-	secsplit := strings.Split(timesplit[2], ".")
-	secsplit0, err := strconv.Atoi(secsplit[0])
-	if err != nil {
-		return 0, err
+	if ttAttr(tt, "frameRate") == "" {
+		return timecode.Rate{Num: 1, Den: 1}
 	}
-	secsplit1, err := strconv.Atoi(secsplit[1])
-	if err != nil {
-		return 0, err
+	subFrameRate, err := strconv.ParseInt(strings.TrimSpace(ttAttr(tt, "subFrameRate")), 10, 64)
+	if err != nil || subFrameRate < 1 {
+		subFrameRate = 1
 	}
-	if len(timesplit) > 3 {
-		timesplit3, err := strconv.ParseFloat(timesplit[3], 32)
-		if err != nil {
-			return 0, err
+	return timecode.Rate{Num: rate.Num * subFrameRate, Den: rate.Den}
+}
+
+// ttParameters returns the ttp: parameter attributes of the tt element, as found in the document.
+func ttParameters(tt *xmlquery.Node) string {
+	params := []string{}
+	for _, attr := range tt.Attr {
+		if attr.Name.Space == "ttp" {
+			params = append(params, fmt.Sprintf("ttp:%s=%q", attr.Name.Local, attr.Value))
+		}
+	}
+	return strings.Join(params, " ")
+}
+
+// ttAttr returns the value of a ttp: parameter attribute, ignoring the case of its name
+// since both ttp:frameRate and ttp:framerate are found in the wild.
+func ttAttr(tt *xmlquery.Node, name string) string {
+	for _, attr := range tt.Attr {
+		if attr.Name.Space == "ttp" && strings.EqualFold(attr.Name.Local, name) {
+			return attr.Value
 		}
-		framerate, err := strconv.ParseFloat(r.framerate, 32)
+	}
+	return ""
+}
+
+// translateTime converts a clock time, "HH:MM:SS(.fraction)" or "HH:MM:SS:FF"
+// with frames, or an offset time, e.g. "10s" or "5f", to microseconds. With the
+// smpte time base, clock times are timecodes labeling frames at the document
+// frame rate.
+func (r reader) translateTime(stamp string) (int, error) {
+	if matches := offsetTime.FindStringSubmatch(strings.TrimSpace(stamp)); matches != nil {
+		return r.translateOffsetTime(matches[1], matches[2])
+	}
+	timesplit := strings.Split(stamp, ":")
+	if len(timesplit) < 3 || len(timesplit) > 4 {
+		return 0, fmt.Errorf("invalid time expression %q", stamp)
+	}
+	fraction := "0"
+	if secsplit := strings.SplitN(timesplit[2], ".", 2); len(secsplit) == 2 {
+		timesplit[2], fraction = secsplit[0], secsplit[1]
+	}
+	values := make([]int64, 4)
+	for i, value := range timesplit {
+		v, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
 			return 0, err
 		}
-		if r.timebase == "smpte" {
-			secsplit1 = int(timesplit3 / framerate * 1000.0)
-		} else {
-			secsplit1 = int(float64(int(timesplit3)*r.multiplier[1]) / framerate * float64(r.multiplier[0]) * 1000.0)
-		}
+		values[i] = v
+	}
+	fractionMicro, err := strconv.ParseInt((fraction + "000000")[:6], 10, 64)
+	if err != nil {
+		return 0, err
 	}
-	microseconds := int(timesplit0)*3600000000 +
-		int(timesplit1)*60000000 +
-		int(secsplit0)*1000000 +
-		int(secsplit1)*1000
 
 	if r.timebase == "smpte" {
-		return int(float64(microseconds) * float64(r.multiplier[1]) / float64(r.multiplier[0])), nil
+		tc := timecode.Timecode{Hours: values[0], Minutes: values[1], Seconds: values[2], Frames: values[3], Rate: r.rate}
+		return int(tc.Microseconds() + fractionMicro), nil
 	}
+	microseconds := ((values[0]*60+values[1])*60+values[2])*1000000 + fractionMicro
+	return int(microseconds + r.rate.FramesToMicroseconds(values[3])), nil
+}
 
-	return microseconds, nil
+// translateOffsetTime converts the count of an offset time in the given metric
+// to microseconds, frames and ticks being counted at the document frame and tick rates.
+func (r reader) translateOffsetTime(count, metric string) (int, error) {
+	value, err := strconv.ParseFloat(count, 64)
+	if err != nil {
+		return 0, err
+	}
+	var seconds float64
+	switch metric {
+	case "h":
+		seconds = value * 3600
+	case "m":
+		seconds = value * 60
+	case "s":
+		seconds = value
+	case "ms":
+		seconds = value / 1000
+	case "f":
+		seconds = value * float64(r.rate.Den) / float64(r.rate.Num)
+	case "t":
+		seconds = value * float64(r.tickRate.Den) / float64(r.tickRate.Num)
+	}
+	return int(math.Round(seconds * 1000000)), nil
 }
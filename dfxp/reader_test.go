@@ -1,7 +1,7 @@
 package dfxp
 
 import (
-	"fmt"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -109,14 +109,14 @@ func TestReader(t *testing.T) {
 				capts := captionSet.GetCaptions(caps.DefaultLang)
 				assert.Equal(t, 7, len(capts))
 				paragraph := capts[2]
-				assert.Equal(t, 18752000, int(*paragraph.Start))
-				assert.Equal(t, 20887000, int(*paragraph.End))
+				assert.Equal(t, 18752000, int(paragraph.Start.Microseconds()))
+				assert.Equal(t, 20887000, int(paragraph.End.Microseconds()))
 			},
 		},
 		{
 			name:     "Empty File",
 			contents: sampleDFXPEmpty,
-			err:      fmt.Errorf("empty caption file"),
+			err:      caps.NewEmptyFileError("dfxp"),
 			assertions: func(captionSet *caps.CaptionSet) {
 				assert.True(t, captionSet.IsEmpty())
 			},
@@ -176,10 +176,13 @@ func TestCaptionNodes(t *testing.T) {
 			caps.NewCaptionText("♪ ...say bow, wow, ♪"),
 		},
 		{
-			caps.NewCaptionStyle(false, caps.StyleProps{
+			caps.NewCaptionStyle(true, caps.StyleProps{
 				TextAlign: "right",
 			}),
 			caps.NewCaptionText("we have this vision of Einstein"),
+			caps.NewCaptionStyle(false, caps.StyleProps{
+				TextAlign: "right",
+			}),
 		},
 		{
 			caps.NewLineBreak(),
@@ -220,3 +223,179 @@ func TestCaptionNodes(t *testing.T) {
 		}
 	}
 }
+
+func TestCombineMatchingCaptions(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(`<tt xml:lang="en" xmlns="http://www.w3.org/ns/ttml">
+  <body>
+    <div xml:lang="en-US">
+      <p begin="00:00:01.000" end="00:00:02.000">first line</p>
+      <p begin="00:00:01.000" end="00:00:02.000">second line</p>
+    </div>
+  </body>
+</tt>`))
+	assert.Nil(t, err)
+	captions := captionSet.GetCaptions("en-US")
+	assert.Equal(t, 1, len(captions))
+	assert.Equal(t, "first line\nsecond line", captions[0].Text())
+}
+
+func TestFrameRates(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    string
+		begin     string
+		wantStart int64
+	}{
+		{"media frames", ``, "00:00:01:15", 1500000},
+		{"media fraction", ``, "00:00:02.07", 2070000},
+		{"media 25fps", `ttp:frameRate="25"`, "00:00:01:05", 1200000},
+		{"smpte 29.97 NDF", `ttp:timeBase="smpte" ttp:frameRate="30" ttp:frameRateMultiplier="1000 1001"`, "01:00:00:00", 3603600000},
+		{"smpte 29.97 DF", `ttp:timeBase="smpte" ttp:frameRate="30" ttp:frameRateMultiplier="1000 1001" ttp:dropMode="dropNTSC"`, "00:01:00:02", 60060000},
+		{"offset hours", ``, "0.5h", 1800000000},
+		{"offset minutes", ``, "2m", 120000000},
+		{"offset seconds", ``, "10s", 10000000},
+		{"offset fraction", ``, "1.25s", 1250000},
+		{"offset milliseconds", ``, "100ms", 100000},
+		{"offset frames", ``, "45f", 1500000},
+		{"offset frames 25fps", `ttp:frameRate="25"`, "5f", 200000},
+		{"offset ticks", `ttp:tickRate="10000000"`, "25000000t", 2500000},
+		{"offset ticks frame rate", `ttp:frameRate="25" ttp:subFrameRate="2"`, "75t", 1500000},
+		{"offset ticks default", ``, "3t", 3000000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captionSet, err := NewReader().Read([]byte(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ` + test.params + `>
+  <body>
+    <div>
+      <p begin="` + test.begin + `" dur="00:00:01.000">text</p>
+    </div>
+  </body>
+</tt>`))
+			assert.Nil(t, err)
+			captions := captionSet.GetCaptions(caps.DefaultLang)
+			assert.Equal(t, 1, len(captions))
+			assert.Equal(t, test.wantStart, captions[0].Start.Microseconds())
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	// paragraphs with invalid times are skipped, even in strict mode
+	content := []byte(`<tt xmlns="http://www.w3.org/ns/ttml">
+  <body>
+    <div>
+      <p begin="00:00:01.000" end="00:00:0x.000">text</p>
+      <p begin="00:00:02.000" end="00:00:03.000">valid</p>
+    </div>
+  </body>
+</tt>`)
+	captionSet, err := NewReader().Read(content)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(captionSet.GetCaptions(caps.DefaultLang)))
+	_, warnings, err := caps.ReadLenient(NewReader(), content, caps.Strict)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(warnings))
+	assert.Equal(t, caps.ErrCodeTimestamp, warnings[0].Err.Code)
+	assert.Equal(t, `end="00:00:0x.000"`, warnings[0].Err.Snippet)
+
+	var parseErr *caps.ParseError
+	_, err = NewReader().Read([]byte("<tt>\n<body>\n</div>\n</tt>"))
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, caps.ErrCodeSyntax, parseErr.Code)
+	assert.Equal(t, 3, parseErr.Line)
+}
+
+func TestStyleInheritance(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(`<tt xml:lang="en" xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling">
+  <head>
+    <styling>
+      <style xml:id="base" tts:fontFamily="Arial" tts:color="white"/>
+      <style xml:id="yellow" style="base" tts:color="yellow"/>
+      <style xml:id="loop" style="loop emphasis" tts:fontSize="80%"/>
+      <style xml:id="emphasis" tts:fontStyle="italic"/>
+    </styling>
+    <layout>
+      <region xml:id="top" tts:textAlign="left">
+        <style tts:fontSize="120%"/>
+      </region>
+    </layout>
+  </head>
+  <body style="base">
+    <div xml:lang="en-US" region="top">
+      <p begin="00:00:01.000" end="00:00:02.000" style="yellow" tts:fontWeight="bold">plain <span style="emphasis" tts:color="red">red</span></p>
+      <p begin="00:00:03.000" end="00:00:04.000" style="loop">loop</p>
+    </div>
+  </body>
+</tt>`))
+	assert.Nil(t, err)
+	assert.Equal(t, []caps.StyleProps{
+		{ID: "base", FontFamily: "Arial", Color: "white"},
+		{ID: "emphasis", Italics: true},
+		{ID: "loop", FontSize: "80%", Italics: true},
+		{ID: "yellow", FontFamily: "Arial", Color: "yellow"},
+	}, captionSet.GetStyles())
+
+	captions := captionSet.GetCaptions("en-US")
+	assert.Equal(t, caps.StyleProps{Class: "base yellow", TextAlign: "left", FontFamily: "Arial", FontSize: "120%", Color: "yellow", Bold: true}, captions[0].Style)
+	assert.Equal(t, caps.NewCaptionStyle(true, caps.StyleProps{Class: "emphasis", Color: "red", Italics: true}), captions[0].Nodes[1])
+	assert.Equal(t, caps.StyleProps{Class: "base loop", TextAlign: "left", FontFamily: "Arial", FontSize: "80%", Color: "white", Italics: true}, captions[1].Style)
+}
+
+func TestRegions(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(`<tt xml:lang="en" xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling" tts:extent="1920px 1080px">
+  <head>
+    <layout>
+      <region xml:id="top" tts:origin="10% 5%" tts:extent="80% 20%" tts:displayAlign="before" tts:padding="1% 2%"/>
+      <region xml:id="right" tts:origin="1440px 540px" tts:extent="480px 540px" tts:textAlign="right"/>
+      <region xml:id="vertical" tts:writingMode="tbrl"/>
+    </layout>
+  </head>
+  <body>
+    <div xml:lang="en-US" region="top">
+      <p begin="00:00:01.000" end="00:00:02.000">top</p>
+      <p begin="00:00:03.000" end="00:00:04.000" region="right">right</p>
+      <p begin="00:00:05.000" end="00:00:06.000" region="unknown">unknown</p>
+    </div>
+  </body>
+</tt>`))
+	assert.Nil(t, err)
+	assert.Equal(t, []caps.Region{
+		{ID: "right", Width: 25, Height: 50, Lines: 8, ViewportAnchor: caps.Point{X: 75, Y: 50}, Align: "right"},
+		{ID: "top", Width: 80, Height: 20, Lines: 3, ViewportAnchor: caps.Point{X: 10, Y: 5}, DisplayAlign: "before", Padding: "1% 2%"},
+		{ID: "vertical", Width: 100, Height: 100, Lines: 15, Vertical: "rl"},
+	}, captionSet.GetRegions())
+	captions := captionSet.GetCaptions("en-US")
+	assert.Equal(t, "top", captions[0].Placement.Region)
+	assert.Equal(t, "right", captions[1].Placement.Region)
+	assert.Equal(t, "right", captions[1].Style.TextAlign)
+	assert.True(t, captions[2].Placement.IsDefault())
+}
+
+func TestTextRuns(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(`<tt xml:lang="en" xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling">
+  <body>
+    <div xml:lang="en">
+      <p begin="00:00:01.000" end="00:00:02.000">
+        Tom &amp; <span tts:fontStyle="italic">Jerry</span>
+        <span tts:fontWeight="bold">loud</span><br/>
+        after
+      </p>
+    </div>
+  </body>
+</tt>`))
+	assert.Nil(t, err)
+	italic := caps.StyleProps{Italics: true}
+	bold := caps.StyleProps{Bold: true}
+	assert.Equal(t, []caps.CaptionContent{
+		caps.NewCaptionText("Tom & "),
+		caps.NewCaptionStyle(true, italic),
+		caps.NewCaptionText("Jerry"),
+		caps.NewCaptionStyle(false, italic),
+		caps.NewCaptionText(" "),
+		caps.NewCaptionStyle(true, bold),
+		caps.NewCaptionText("loud"),
+		caps.NewCaptionStyle(false, bold),
+		caps.NewLineBreak(),
+		caps.NewCaptionText("after"),
+	}, captionSet.GetCaptions("en")[0].Nodes)
+}
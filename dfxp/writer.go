@@ -3,6 +3,10 @@ package dfxp
 import (
 	"bytes"
 	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/vimeo/caps"
@@ -11,39 +15,92 @@ import (
 type writer struct {
 	pStyle   bool
 	openSpan bool
+	// encoding is the encoding declared by the XML declaration, none when empty
+	encoding string
 }
 
 // TODO: rewrite all _recreate from python's DFXPWriter class
 
 func (w writer) Write(captions *caps.CaptionSet) ([]byte, error) {
-	st := defaultStyle()
+	var output bytes.Buffer
+	if err := w.WriteStream(&output, captions); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// WriteStream encodes the document directly to out.
+func (w writer) WriteStream(out io.Writer, captions *caps.CaptionSet) error {
+	styles := []Style{}
 	for _, style := range captions.GetStyles() {
-		st = newStyle(style)
+		styles = append(styles, newStyle(style))
+	}
+	if len(styles) == 0 {
+		styles = append(styles, defaultStyle())
 	}
-	sid := st.ID
 	base := newBaseMarkup()
 	base.Head = Head{
-		Style:  st,
-		Layout: defaultRegion(),
+		Styles: styles,
+		Layout: []Region{},
+	}
+	if len(captions.Regions) == 0 {
+		base.Head.Layout = append(base.Head.Layout, defaultRegion())
 	}
+	for _, region := range captions.GetRegions() {
+		base.Head.Layout = append(base.Head.Layout, convertRegion(region))
+	}
+	// regions holds the ID of the region generated for each placement
+	regions := map[caps.Placement]string{}
+	// agents holds the ID of the agent of each speaker
+	agents := map[string]string{}
 	for _, lang := range captions.Languages() {
 		divLang := Lang{
 			Lang: lang,
 			Ps:   []Paragraph{},
 		}
 		for _, c := range captions.GetCaptions(lang) {
-			if c.Style.ID != "" {
-				sid = c.Style.ID
+			p := newParagraph(captions, c)
+			if _, ok := captions.Regions[c.Placement.Region]; ok {
+				p.Region = c.Placement.Region
+			} else if !c.Placement.IsDefault() {
+				if _, ok := regions[c.Placement]; !ok {
+					regions[c.Placement] = newRegionID(captions, len(regions)+1)
+					base.Head.Layout = append(base.Head.Layout, newRegion(regions[c.Placement], c.Placement))
+				}
+				p.Region = regions[c.Placement]
+			}
+			ids := []string{}
+			for _, speaker := range c.Speakers() {
+				if _, ok := agents[speaker]; !ok {
+					agents[speaker] = fmt.Sprintf("agent%d", len(agents)+1)
+					if base.Head.Metadata == nil {
+						base.Head.Metadata = &Metadata{}
+					}
+					base.Head.Metadata.Agents = append(base.Head.Metadata.Agents, newAgent(agents[speaker], speaker))
+				}
+				ids = append(ids, agents[speaker])
 			}
-			divLang.Ps = append(divLang.Ps, newParagraph(c, sid))
+			p.Agent = strings.Join(ids, " ")
+			divLang.Ps = append(divLang.Ps, p)
 		}
 		base.Body.Langs = append(base.Body.Langs, divLang)
 	}
-	content, err := xml.Marshal(base)
-	if err != nil {
-		return nil, err
+	if len(agents) > 0 {
+		base.TtXMLnsTTM = "http://www.w3.org/ns/ttml#metadata"
+	}
+	if w.encoding != "" {
+		if _, err := fmt.Fprintf(out, "<?xml version=\"1.0\" encoding=\"%s\"?>\n", w.encoding); err != nil {
+			return err
+		}
 	}
-	return content, nil
+	return xml.NewEncoder(out).Encode(base)
+}
+
+// WithEncoding returns a copy of the writer starting the documents with an XML
+// declaration of the named encoding, which XML parsers otherwise read as UTF-8.
+func (w writer) WithEncoding(name string) caps.CaptionWriter {
+	w.encoding = name
+	return &w
 }
 
 func newStyle(style caps.StyleProps) Style {
@@ -55,7 +112,7 @@ func newStyle(style caps.StyleProps) Style {
 	if style.Bold {
 		fontWeight = "bold"
 	}
-	return Style{
+	s := Style{
 		ID:            style.ID,
 		TTSTextAlign:  style.TextAlign,
 		TTSFontStyle:  fontStyle,
@@ -66,6 +123,67 @@ func newStyle(style caps.StyleProps) Style {
 		// FIXME this is never parsed to Style
 		TTSDisplayAlign: "",
 	}
+	if style.Underline {
+		s.TTSTextDecoration = "underline"
+	}
+	return s
+}
+
+// styleRef returns the reference of a style to the styles of the caption set: its
+// ID followed by the classes it names, those that aren't styles of the set being
+// left out, or an empty string.
+func styleRef(captions *caps.CaptionSet, style caps.StyleProps) string {
+	ids := []string{}
+	for _, id := range append([]string{style.ID}, strings.Fields(style.Class)...) {
+		if _, ok := captions.Styles[id]; ok && id != "" && !contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return strings.Join(ids, " ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// newSpanStyle returns the attributes of a span of the style: the reference to the
+// styles of the caption set and the properties differing from theirs.
+func newSpanStyle(captions *caps.CaptionSet, style caps.StyleProps) Style {
+	ref := styleRef(captions, style)
+	referenced := caps.StyleProps{}
+	for _, id := range strings.Fields(ref) {
+		referenced = referenced.Merge(captions.Styles[id])
+	}
+	differs := func(value, referenced string) string {
+		if value == referenced {
+			return ""
+		}
+		return value
+	}
+	flag := func(value, referenced bool, on, off string) string {
+		switch {
+		case value == referenced:
+			return ""
+		case value:
+			return on
+		}
+		return off
+	}
+	return Style{
+		StyleRef:          ref,
+		TTSTextAlign:      differs(style.TextAlign, referenced.TextAlign),
+		TTSFontStyle:      flag(style.Italics, referenced.Italics, "italic", "normal"),
+		TTSFontFamily:     differs(style.FontFamily, referenced.FontFamily),
+		TTSFontSize:       differs(style.FontSize, referenced.FontSize),
+		TTSFontWeight:     flag(style.Bold, referenced.Bold, "bold", "normal"),
+		TTSColor:          differs(style.Color, referenced.Color),
+		TTSTextDecoration: flag(style.Underline, referenced.Underline, "underline", "none"),
+	}
 }
 
 func defaultStyle() Style {
@@ -85,50 +203,253 @@ func defaultRegion() Region {
 	}
 }
 
-func newSpan(s string, style Style) *Span {
-	return &Span{xml.Name{}, s, style}
+// newRegion returns a region displaying text as placed by placement. Line numbers
+// are converted to percentages assuming caps.DefaultRows lines fit on the video.
+func newRegion(id string, placement caps.Placement) Region {
+	// the inline axis is horizontal for horizontal text
+	size := 100.0
+	if placement.Size.IsSet() {
+		size = placement.Size.Value()
+	}
+	positionAlign := placement.PositionAlign
+	if positionAlign == "" {
+		switch placement.Align {
+		case "start", "left":
+			positionAlign = "line-left"
+		case "end", "right":
+			positionAlign = "line-right"
+		default:
+			positionAlign = "center"
+		}
+	}
+	position := map[string]float64{"line-left": 0, "center": 50, "line-right": 100}[positionAlign]
+	if placement.Position.IsSet() {
+		position = placement.Position.Value()
+	}
+	inline := position
+	switch positionAlign {
+	case "center":
+		inline -= size / 2
+	case "line-right":
+		inline -= size
+	}
+	inline = math.Max(0, math.Min(inline, 100-size))
+
+	// the block axis is vertical for horizontal text, the box being at the end
+	// (bottom) of the video by default
+	block, blockSize, displayAlign := 0.0, 100.0, "after"
+	line, lineAlign := placement.Line, placement.LineAlign
+	if line.IsSet() && !line.IsPercent() {
+		if line.Value() >= 0 {
+			line, lineAlign = caps.NewPercentOffset(line.Value()*100/caps.DefaultRows), "start"
+		} else {
+			line, lineAlign = caps.NewPercentOffset(100+(line.Value()+1)*100/caps.DefaultRows), "end"
+		}
+	}
+	if line.IsSet() {
+		offset := math.Max(0, math.Min(line.Value(), 100))
+		switch lineAlign {
+		case "end":
+			block, blockSize = 0, offset
+		case "center":
+			displayAlign = "center"
+			block, blockSize = 0, 2*offset
+			if offset > 50 {
+				block, blockSize = 2*offset-100, 200-2*offset
+			}
+		default:
+			displayAlign = "before"
+			block, blockSize = offset, 100-offset
+		}
+	}
+
+	region := Region{
+		ID:              id,
+		TTSTextAlign:    placement.Align,
+		TTSDisplayAlign: displayAlign,
+		TTSOrigin:       formatPercents(inline, block),
+		TTSExtent:       formatPercents(size, blockSize),
+	}
+	if region.TTSTextAlign == "" {
+		region.TTSTextAlign = "center"
+	}
+	switch placement.Vertical {
+	case "lr":
+		region.TTSWritingMode = "tblr"
+		region.TTSOrigin = formatPercents(block, inline)
+		region.TTSExtent = formatPercents(blockSize, size)
+	case "rl":
+		region.TTSWritingMode = "tbrl"
+		region.TTSOrigin = formatPercents(100-block-blockSize, inline)
+		region.TTSExtent = formatPercents(blockSize, size)
+	}
+	return region
+}
+
+// newRegionID returns the ID of the nth generated region, not used by the regions
+// of the caption set.
+func newRegionID(captions *caps.CaptionSet, n int) string {
+	id := fmt.Sprintf("region%d", n)
+	for {
+		if _, ok := captions.Regions[id]; !ok {
+			return id
+		}
+		id = "_" + id
+	}
+}
+
+// convertRegion returns the region displaying the lines of a caps.Region, the lines
+// being stacked from the bottom unless set otherwise. Without a height, line heights
+// are a caps.DefaultRows of the video height.
+func convertRegion(region caps.Region) Region {
+	width := region.Width
+	height := region.Height
+	if height <= 0 {
+		height = float64(region.Lines) * 100 / caps.DefaultRows
+	}
+	x := region.ViewportAnchor.X - region.RegionAnchor.X*width/100
+	y := region.ViewportAnchor.Y - region.RegionAnchor.Y*height/100
+	converted := Region{
+		ID:              region.ID,
+		TTSOrigin:       formatPercents(math.Max(0, math.Min(x, 100-width)), math.Max(0, math.Min(y, 100-height))),
+		TTSExtent:       formatPercents(width, math.Min(height, 100)),
+		TTSTextAlign:    region.Align,
+		TTSDisplayAlign: region.DisplayAlign,
+		TTSPadding:      region.Padding,
+	}
+	if converted.TTSTextAlign == "" {
+		converted.TTSTextAlign = "center"
+	}
+	if converted.TTSDisplayAlign == "" {
+		converted.TTSDisplayAlign = "after"
+	}
+	switch region.Vertical {
+	case "lr":
+		converted.TTSWritingMode = "tblr"
+	case "rl":
+		converted.TTSWritingMode = "tbrl"
+	}
+	return converted
 }
 
-func newParagraph(caption *caps.Caption, s string) Paragraph {
-	start := caption.FormatStart()
-	end := caption.FormatEnd()
-	line := ""
-	var sp *Span
+// formatPercents returns the TTML value of a pair of percentages, e.g. "10% 85.5%".
+func formatPercents(x, y float64) string {
+	format := func(v float64) string {
+		return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64) + "%"
+	}
+	return format(x) + " " + format(y)
+}
 
-	for _, node := range caption.Nodes {
-		if node.Text() && sp == nil {
-			buf := bytes.Buffer{}
-			xml.Escape(&buf, []byte(node.Content()))
-			str := buf.String()
-			str = strings.ReplaceAll(str, `&#39;`, `'`)
-			str = strings.ReplaceAll(str, `&#34;`, `"`)
-			str = strings.ReplaceAll(str, `&#xA;`, ``)
-			line += str
-		} else if node.LineBreak() && sp == nil {
-			line += "<br/>"
-		} else if node.Style() && sp == nil {
-			sp = newSpan(line, newStyle(node.(caps.CaptionStyle).Props))
-		} else if sp != nil {
-			// FIXME do all the strings.ReplaceAll here too
-			line += node.Content()
-			sp.Text += line
+func newAgent(id, name string) Agent {
+	return Agent{ID: id, Type: "person", Name: AgentName{Type: "full", Name: name}}
+}
+
+// newSpanStart returns the start tag of a span of the style.
+func newSpanStart(style Style) string {
+	output, err := xml.Marshal(Span{Style: style})
+	if err != nil {
+		return "<span>"
+	}
+	// the span is empty, its end tag closes it right away
+	return strings.TrimSuffix(string(output), "</span>")
+}
+
+// escapeText returns the text escaped as XML character data, quotes being left
+// as is and line feeds removed.
+func escapeText(text string) string {
+	buf := bytes.Buffer{}
+	xml.Escape(&buf, []byte(text))
+	str := buf.String()
+	str = strings.ReplaceAll(str, `&#39;`, `'`)
+	str = strings.ReplaceAll(str, `&#34;`, `"`)
+	str = strings.ReplaceAll(str, `&#xA;`, ``)
+	return str
+}
+
+// openSpan is a span opened in a paragraph, by a caps.CaptionStyle or a
+// caps.CaptionTimestamp when timed.
+type openSpan struct {
+	start string
+	timed bool
+}
+
+// newParagraph returns the paragraph of the caption, referencing the styles of the
+// caption set, or the default style when the set has none. Style nodes open and
+// close nested spans, timestamps open spans timed relative to the paragraph
+// lasting until the next timestamp.
+func newParagraph(captions *caps.CaptionSet, caption *caps.Caption) Paragraph {
+	s := styleRef(captions, caption.Style)
+	if len(captions.Styles) == 0 {
+		s = defaultStyle().ID
+	}
+	content := strings.Builder{}
+	open := []openSpan{}
+	// last returns the index of the innermost open span, timed or not, or -1
+	last := func(timed bool) int {
+		for i := len(open) - 1; i >= 0; i-- {
+			if open[i].timed == timed {
+				return i
+			}
 		}
+		return -1
 	}
-	if sp != nil {
-		return Paragraph{
-			Begin:   start,
-			End:     end,
-			StyleID: s,
-			Span:    sp,
+	// closeSpan closes the ith open span, the spans it holds being closed and
+	// reopened after it
+	closeSpan := func(i int) {
+		reopened := append([]openSpan{}, open[i+1:]...)
+		for range open[i:] {
+			content.WriteString("</span>")
+		}
+		open = append(open[:i], reopened...)
+		for _, span := range reopened {
+			content.WriteString(span.start)
 		}
 	}
 
+	for _, node := range caption.Nodes {
+		switch node := node.(type) {
+		case caps.CaptionStyle:
+			if node.Start {
+				span := openSpan{start: newSpanStart(newSpanStyle(captions, node.Props))}
+				content.WriteString(span.start)
+				open = append(open, span)
+			} else if i := last(false); i >= 0 {
+				closeSpan(i)
+			}
+		case caps.CaptionTimestamp:
+			if i := last(true); i >= 0 {
+				closeSpan(i)
+			}
+			span := openSpan{start: fmt.Sprintf(`<span begin="%s">`, formatOffset(caption.Start, node.Time)), timed: true}
+			content.WriteString(span.start)
+			open = append(open, span)
+		default:
+			if node.Text() {
+				content.WriteString(escapeText(node.Content()))
+			} else if node.LineBreak() {
+				content.WriteString("<br/>")
+			}
+		}
+	}
+	for range open {
+		content.WriteString("</span>")
+	}
+
 	return Paragraph{
-		Begin:   start,
-		End:     end,
+		Begin:   caption.Start.FormatDFXP(),
+		End:     caption.End.FormatDFXP(),
 		StyleID: s,
-		Content: line,
+		Content: content.String(),
+	}
+}
+
+// formatOffset returns the begin time of a span starting at time in a paragraph
+// starting at start, span times being relative to their paragraph.
+func formatOffset(start, time caps.Timestamp) string {
+	if !time.After(start) {
+		return caps.NewTimestamp(0).FormatDFXP()
 	}
+	return caps.NewTimestamp(0).Add(time.Sub(start)).FormatDFXP()
 }
 
 func newBaseMarkup() BaseMarkup {
@@ -1,5 +1,13 @@
 package dfxp
 
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vimeo/caps"
+)
+
 //func TestDFXPWriter(t *testing.T) {
 //	captionSet, err := NewReader().Read(sampleDFXP)
 //	assert.Nil(t, err)
@@ -8,3 +16,212 @@ package dfxp
 //	fmt.Println("--------------------------")
 //	fmt.Println(gohtml.Format(string(output[0])))
 //}
+
+func TestWriterRegions(t *testing.T) {
+	top := caps.NewCaption(caps.NewTimestamp(1000000), caps.NewTimestamp(2000000), []caps.CaptionContent{caps.NewCaptionText("top")}, caps.DefaultStyleProps())
+	top.Placement = caps.Placement{Line: caps.NewLineOffset(0), Align: "left"}
+	bottom := caps.NewCaption(caps.NewTimestamp(3000000), caps.NewTimestamp(4000000), []caps.CaptionContent{caps.NewCaptionText("bottom")}, caps.DefaultStyleProps())
+	left := caps.NewCaption(caps.NewTimestamp(5000000), caps.NewTimestamp(6000000), []caps.CaptionContent{caps.NewCaptionText("left")}, caps.DefaultStyleProps())
+	left.Placement = caps.Placement{Line: caps.NewPercentOffset(90), LineAlign: "end", Position: caps.NewPercentOffset(10), PositionAlign: "line-left", Size: caps.NewPercentOffset(40)}
+	captionSet := caps.NewCaptionSet()
+	captionSet.SetCaptions(caps.DefaultLang, []*caps.Caption{&top, &bottom, &left, &top})
+
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), `<layout><region xml:id="bottom" tts:textAlign="center" tts:displayAlign="after"></region>`+
+		`<region xml:id="region1" tts:origin="0% 0%" tts:extent="100% 100%" tts:textAlign="left" tts:displayAlign="before"></region>`+
+		`<region xml:id="region2" tts:origin="10% 0%" tts:extent="40% 90%" tts:textAlign="center" tts:displayAlign="after"></region></layout>`)
+	assert.Contains(t, string(result), `<p begin="00:00:01.000" end="00:00:02.000" style="default" region="region1">top</p>`)
+	assert.Contains(t, string(result), `<p begin="00:00:03.000" end="00:00:04.000" style="default">bottom</p>`)
+	assert.Contains(t, string(result), `<p begin="00:00:05.000" end="00:00:06.000" style="default" region="region2">left</p>`)
+	assert.Equal(t, 2, strings.Count(string(result), `region="region1"`))
+}
+
+func TestNewRegion(t *testing.T) {
+	tests := []struct {
+		name      string
+		placement caps.Placement
+		expected  Region
+	}{
+		{"last line", caps.Placement{Line: caps.NewLineOffset(-1)}, Region{ID: "r", TTSOrigin: "0% 0%", TTSExtent: "100% 100%", TTSTextAlign: "center", TTSDisplayAlign: "after"}},
+		{"centered", caps.Placement{Line: caps.NewPercentOffset(60), LineAlign: "center", Position: caps.NewPercentOffset(50), Size: caps.NewPercentOffset(50)}, Region{ID: "r", TTSOrigin: "25% 20%", TTSExtent: "50% 80%", TTSTextAlign: "center", TTSDisplayAlign: "center"}},
+		{"vertical", caps.Placement{Vertical: "rl", Line: caps.NewPercentOffset(10), Align: "start"}, Region{ID: "r", TTSOrigin: "0% 0%", TTSExtent: "90% 100%", TTSTextAlign: "start", TTSDisplayAlign: "before", TTSWritingMode: "tbrl"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, newRegion("r", test.placement))
+		})
+	}
+}
+
+func TestWriterCaptionSetRegions(t *testing.T) {
+	captionSet := caps.NewCaptionSet()
+	region := caps.NewRegion("region1")
+	region.Width, region.ViewportAnchor = 40, caps.Point{X: 10, Y: 90}
+	captionSet.AddRegion(region)
+	caption := caps.NewCaption(caps.NewTimestamp(1000000), caps.NewTimestamp(2000000), []caps.CaptionContent{caps.NewCaptionText("fred")}, caps.DefaultStyleProps())
+	caption.Placement = caps.Placement{Region: "region1", Align: "left"}
+	top := caps.NewCaption(caps.NewTimestamp(3000000), caps.NewTimestamp(4000000), []caps.CaptionContent{caps.NewCaptionText("top")}, caps.DefaultStyleProps())
+	top.Placement = caps.Placement{Line: caps.NewLineOffset(0)}
+	captionSet.SetCaptions(caps.DefaultLang, []*caps.Caption{&caption, &top})
+
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), `<region xml:id="region1" tts:origin="10% 70%" tts:extent="40% 20%" tts:textAlign="center" tts:displayAlign="after"></region>`)
+	assert.Contains(t, string(result), `<region xml:id="_region1" tts:origin="0% 0%"`)
+	assert.Contains(t, string(result), `style="default" region="region1">fred</p>`)
+	assert.Contains(t, string(result), `style="default" region="_region1">top</p>`)
+}
+
+func TestWriterAgents(t *testing.T) {
+	nodes := []caps.CaptionContent{caps.NewCaptionSpan(true, caps.SpanVoice, "Bob", ""), caps.NewCaptionText("hi"), caps.NewCaptionSpan(false, caps.SpanVoice, "Bob", "")}
+	voiced := caps.NewCaption(caps.NewTimestamp(1000000), caps.NewTimestamp(2000000), nodes, caps.DefaultStyleProps())
+	plain := caps.NewCaption(caps.NewTimestamp(3000000), caps.NewTimestamp(4000000), []caps.CaptionContent{caps.NewCaptionText("nobody")}, caps.DefaultStyleProps())
+	captionSet := caps.NewCaptionSet()
+	captionSet.SetCaptions(caps.DefaultLang, []*caps.Caption{&voiced, &plain})
+
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), `xmlns:ttm="http://www.w3.org/ns/ttml#metadata"`)
+	assert.Contains(t, string(result), `<head><metadata><ttm:agent xml:id="agent1" type="person"><ttm:name type="full">Bob</ttm:name></ttm:agent></metadata>`)
+	assert.Contains(t, string(result), `style="default" ttm:agent="agent1">hi</p>`)
+
+	roundTrip, err := NewReader().Read(result)
+	assert.Nil(t, err)
+	captions := roundTrip.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, nodes, captions[0].Nodes)
+	assert.Equal(t, []string{}, captions[1].Speakers())
+
+	// without speakers, no metadata element is written
+	captionSet.SetCaptions(caps.DefaultLang, []*caps.Caption{&plain})
+	result, err = NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(result), "<metadata")
+}
+
+func TestWriterEncoding(t *testing.T) {
+	caption := caps.NewCaption(caps.NewTimestamp(1000000), caps.NewTimestamp(2000000), []caps.CaptionContent{caps.NewCaptionText("café")}, caps.DefaultStyleProps())
+	captionSet := caps.NewCaptionSet()
+	captionSet.SetCaptions(caps.DefaultLang, []*caps.Caption{&caption})
+
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(result), "<tt "))
+
+	writer, err := caps.NewEncodedWriter(NewWriter(), caps.EncodingWindows1252, false)
+	assert.Nil(t, err)
+	result, err = writer.Write(captionSet)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(result), `<?xml version="1.0" encoding="windows-1252"?>`+"\n<tt "))
+	assert.Contains(t, string(result), "caf\xe9")
+	assert.Equal(t, caps.EncodingWindows1252, caps.DetectEncoding(result))
+
+	in, err := caps.NewDecodingReader(strings.NewReader(string(result)), caps.EncodingWindows1252)
+	assert.Nil(t, err)
+	roundTrip, err := caps.ReadStream(NewReader(), in)
+	assert.Nil(t, err)
+	assert.Equal(t, "café", roundTrip.GetCaptions(caps.DefaultLang)[0].Text())
+}
+
+func TestWriterStyles(t *testing.T) {
+	captionSet := caps.NewCaptionSet()
+	captionSet.AddStyle(caps.StyleProps{ID: "yellow", Color: "yellow", FontFamily: "Arial"})
+	captionSet.AddStyle(caps.StyleProps{ID: "emphasis", Italics: true, Underline: true})
+	nodes := []caps.CaptionContent{
+		caps.NewCaptionStyle(true, caps.StyleProps{Class: "emphasis", Italics: true, Underline: true, Color: "red"}),
+		caps.NewCaptionText("red"),
+	}
+	styled := caps.NewCaption(caps.NewTimestamp(1000000), caps.NewTimestamp(2000000), nodes, caps.StyleProps{Class: "yellow"})
+	plain := caps.NewCaption(caps.NewTimestamp(3000000), caps.NewTimestamp(4000000), []caps.CaptionContent{caps.NewCaptionText("plain")}, caps.DefaultStyleProps())
+	captionSet.SetCaptions(caps.DefaultLang, []*caps.Caption{&styled, &plain})
+
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), `<styling><style xml:id="emphasis" tts:fontStyle="italic" tts:textDecoration="underline"></style>`+
+		`<style xml:id="yellow" tts:fontFamily="Arial" tts:color="yellow"></style></styling>`)
+	assert.Contains(t, string(result), `<p begin="00:00:01.000" end="00:00:02.000" style="yellow"><span style="emphasis" tts:color="red">red</span></p>`)
+	assert.Contains(t, string(result), `<p begin="00:00:03.000" end="00:00:04.000">plain</p>`)
+
+	roundTrip, err := NewReader().Read(result)
+	assert.Nil(t, err)
+	assert.Equal(t, captionSet.GetStyles(), roundTrip.GetStyles())
+	captions := roundTrip.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, "yellow", captions[0].Style.Class)
+	assert.Equal(t, nodes[0], captions[0].Nodes[0])
+}
+
+func TestWriterRegionsRoundTrip(t *testing.T) {
+	input := []byte(`<tt xml:lang="en" xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling">
+  <head>
+    <layout>
+      <region xml:id="top" tts:origin="10% 5%" tts:extent="80% 20%" tts:displayAlign="before" tts:padding="1% 2%" tts:textAlign="left"/>
+      <region xml:id="vertical" tts:origin="85% 0%" tts:extent="15% 100%" tts:writingMode="tbrl"/>
+    </layout>
+  </head>
+  <body>
+    <div xml:lang="en-US">
+      <p begin="00:00:01.000" end="00:00:02.000" region="top">top</p>
+      <p begin="00:00:03.000" end="00:00:04.000" region="vertical">vertical</p>
+    </div>
+  </body>
+</tt>`)
+	captionSet, err := NewReader().Read(input)
+	assert.Nil(t, err)
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), `<layout><region xml:id="top" tts:origin="10% 5%" tts:extent="80% 20%" tts:textAlign="left" tts:displayAlign="before" tts:padding="1% 2%"></region>`+
+		`<region xml:id="vertical" tts:origin="85% 0%" tts:extent="15% 100%" tts:textAlign="center" tts:displayAlign="after" tts:writingMode="tbrl"></region></layout>`)
+	assert.Contains(t, string(result), `<p begin="00:00:01.000" end="00:00:02.000" style="default" region="top">top</p>`)
+	assert.Contains(t, string(result), `<p begin="00:00:03.000" end="00:00:04.000" style="default" region="vertical">vertical</p>`)
+
+	roundTrip, err := NewReader().Read(result)
+	assert.Nil(t, err)
+	assert.Equal(t, captionSet.GetRegions()[0], roundTrip.GetRegions()[0])
+}
+
+func TestWriterNestedSpans(t *testing.T) {
+	italic := caps.StyleProps{Italics: true}
+	bold := caps.StyleProps{Bold: true}
+	nodes := []caps.CaptionContent{
+		caps.NewCaptionText("Tom & Jerry "),
+		caps.NewCaptionStyle(true, italic),
+		caps.NewCaptionText("<really> "),
+		caps.NewCaptionStyle(true, bold),
+		caps.NewCaptionText("loud"),
+		caps.NewCaptionStyle(false, bold),
+		caps.NewLineBreak(),
+		caps.NewCaptionText("it's \"fine\""),
+		caps.NewCaptionStyle(false, italic),
+		caps.NewCaptionText(" after"),
+	}
+	caption := caps.NewCaption(caps.NewTimestamp(1000000), caps.NewTimestamp(2000000), nodes, caps.DefaultStyleProps())
+	p := newParagraph(caps.NewCaptionSet(), &caption)
+	assert.Equal(t, `Tom &amp; Jerry <span tts:fontStyle="italic">&lt;really&gt; <span tts:fontWeight="bold">loud</span><br/>it's "fine"</span> after`, p.Content)
+
+	captionSet := caps.NewCaptionSet()
+	captionSet.SetCaptions(caps.DefaultLang, []*caps.Caption{&caption})
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	roundTrip, err := NewReader().Read(result)
+	assert.Nil(t, err)
+	captions := roundTrip.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, "Tom & Jerry <really> loud\nit's \"fine\" after", captions[0].Text())
+	assert.Equal(t, nodes, captions[0].Nodes)
+}
+
+func TestWriterTimedSpans(t *testing.T) {
+	bold := caps.StyleProps{Bold: true}
+	nodes := []caps.CaptionContent{
+		caps.NewCaptionStyle(true, bold),
+		caps.NewCaptionText("one "),
+		caps.NewCaptionTimestamp(caps.NewTimestamp(1500000)),
+		caps.NewCaptionText("two"),
+		caps.NewCaptionStyle(false, bold),
+		caps.NewCaptionText(" three"),
+		caps.NewCaptionTimestamp(caps.NewTimestamp(1800000)),
+		caps.NewCaptionText(" four"),
+	}
+	caption := caps.NewCaption(caps.NewTimestamp(1000000), caps.NewTimestamp(2000000), nodes, caps.DefaultStyleProps())
+	p := newParagraph(caps.NewCaptionSet(), &caption)
+	assert.Equal(t, `<span tts:fontWeight="bold">one <span begin="00:00:00.500">two</span></span><span begin="00:00:00.500"> three</span><span begin="00:00:00.800"> four</span>`, p.Content)
+}
@@ -0,0 +1,308 @@
+package caps
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// Names of the encodings, as in the WHATWG Encoding Standard.
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+	EncodingWindows1251 = "windows-1251"
+)
+
+// sniffSize is the size of the start of the content searched for BOMs and charset declarations.
+const sniffSize = 1024
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+
+	xmlEncodingPattern  = regexp.MustCompile(`^\s*<\?xml[^>]*?encoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+	htmlCharsetPattern  = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?([A-Za-z0-9._:-]+)`)
+	xmlEncodingReplacer = regexp.MustCompile(`^(\s*<\?xml[^>]*?encoding\s*=\s*["'])[A-Za-z0-9._:-]+(["'])`)
+)
+
+// DetectEncoding returns the name of the encoding of the content. In order, it's
+// found from:
+//   - a byte order mark
+//   - the zero bytes of UTF-16 text without a byte order mark
+//   - UTF-8 when the content is valid UTF-8 with non-ASCII characters, since text in
+//     legacy encodings rarely is, even when an other encoding is declared
+//   - a XML encoding declaration or a HTML <meta> charset
+//   - UTF-8 when the content is valid UTF-8
+//   - Windows-1251 when most non-ASCII characters follow each other, as in Cyrillic
+//     words, Windows-1252 (a superset of ISO-8859-1) otherwise.
+func DetectEncoding(content []byte) string {
+	switch {
+	case bytes.HasPrefix(content, bomUTF8):
+		return EncodingUTF8
+	case bytes.HasPrefix(content, bomUTF16LE):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(content, bomUTF16BE):
+		return EncodingUTF16BE
+	}
+	if name := detectUTF16(content); name != "" {
+		return name
+	}
+	valid := utf8.Valid(content)
+	if valid && !isASCII(content) {
+		return EncodingUTF8
+	}
+	if name := declaredEncoding(content); name != "" {
+		return name
+	}
+	if valid {
+		return EncodingUTF8
+	}
+	return detectLegacyEncoding(content)
+}
+
+// DecodeInput returns the content transcoded to UTF-8, as readers expect it, and
+// the name of its encoding as returned by DetectEncoding. The byte order mark is
+// removed and the XML encoding declaration is replaced with UTF-8, even for UTF-8
+// content declaring another encoding.
+func DecodeInput(content []byte) ([]byte, string, error) {
+	name := DetectEncoding(content)
+	for _, bom := range [][]byte{bomUTF8, bomUTF16LE, bomUTF16BE} {
+		if bytes.HasPrefix(content, bom) {
+			content = content[len(bom):]
+			break
+		}
+	}
+	if name == EncodingUTF8 {
+		// UTF-8 content can still declare another encoding, which XML parsers would
+		// decode it with
+		if matches := xmlEncodingPattern.FindSubmatch(content); matches != nil && !isUTF8Label(string(matches[1])) {
+			content = xmlEncodingReplacer.ReplaceAll(content, []byte("${1}UTF-8${2}"))
+		}
+		return content, name, nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, name, fmt.Errorf("unsupported encoding %q: %w", name, err)
+	}
+	decoded, err := enc.NewDecoder().Bytes(content)
+	if err != nil {
+		return nil, name, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	return xmlEncodingReplacer.ReplaceAll(decoded, []byte("${1}UTF-8${2}")), name, nil
+}
+
+// NewDecodingReader returns a reader transcoding in from the named encoding to
+// UTF-8, for streaming input whose encoding is known. As with DecodeInput, the XML
+// encoding declaration is replaced with UTF-8.
+func NewDecodingReader(in io.Reader, name string) (io.Reader, error) {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported encoding %q: %w", name, err)
+	}
+	decoded := bufio.NewReaderSize(transform.NewReader(in, enc.NewDecoder()), sniffSize)
+	// errors are returned again by the reads following Peek
+	start, _ := decoded.Peek(sniffSize)
+	match := xmlEncodingReplacer.FindIndex(start)
+	if match == nil {
+		return decoded, nil
+	}
+	declaration := xmlEncodingReplacer.ReplaceAll(append([]byte{}, start[:match[1]]...), []byte("${1}UTF-8${2}"))
+	if _, err := decoded.Discard(match[1]); err != nil {
+		return nil, err
+	}
+	return io.MultiReader(bytes.NewReader(declaration), decoded), nil
+}
+
+// isUTF8Label reports whether the encoding label names UTF-8, e.g. "utf8".
+func isUTF8Label(label string) bool {
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return false
+	}
+	name, err := htmlindex.Name(enc)
+	return err == nil && name == EncodingUTF8
+}
+
+// detectUTF16 returns the UTF-16 encoding of text without byte order mark, found
+// from the zero high bytes of ASCII characters, or an empty string.
+func detectUTF16(content []byte) string {
+	sample := content
+	if len(sample) > sniffSize {
+		sample = sample[:sniffSize]
+	}
+	pairs := len(sample) / 2
+	if pairs < 2 {
+		return ""
+	}
+	even, odd := 0, 0
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 && sample[i+1] != 0 {
+			even++
+		} else if sample[i] != 0 && sample[i+1] == 0 {
+			odd++
+		}
+	}
+	switch {
+	case odd*10 > pairs*4 && even*10 < pairs:
+		return EncodingUTF16LE
+	case even*10 > pairs*4 && odd*10 < pairs:
+		return EncodingUTF16BE
+	}
+	return ""
+}
+
+// declaredEncoding returns the canonical name of the encoding declared by the XML
+// declaration or a HTML <meta> tag at the start of the content, or an empty string.
+func declaredEncoding(content []byte) string {
+	sample := content
+	if len(sample) > sniffSize {
+		sample = sample[:sniffSize]
+	}
+	matches := xmlEncodingPattern.FindSubmatch(sample)
+	if matches == nil {
+		matches = htmlCharsetPattern.FindSubmatch(sample)
+	}
+	if matches == nil {
+		return ""
+	}
+	enc, err := htmlindex.Get(string(matches[1]))
+	if err != nil {
+		return ""
+	}
+	name, err := htmlindex.Name(enc)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// detectLegacyEncoding guesses the single byte encoding of text that isn't valid
+// UTF-8. Cyrillic words are made of consecutive non-ASCII bytes, when the accented
+// letters of Western European languages are mostly surrounded by ASCII letters.
+func detectLegacyEncoding(content []byte) string {
+	high, consecutive := 0, 0
+	for i, b := range content {
+		if b < 0x80 {
+			continue
+		}
+		high++
+		if i > 0 && content[i-1] >= 0x80 {
+			consecutive++
+		}
+	}
+	if consecutive*2 > high {
+		return EncodingWindows1251
+	}
+	return EncodingWindows1252
+}
+
+func isASCII(content []byte) bool {
+	for _, b := range content {
+		if b >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// EncodingDeclarer is implemented by writers of formats declaring their encoding
+// in the document, like the XML declaration of DFXP or the charset <meta> of SAMI.
+// WithEncoding returns a copy of the writer declaring the named encoding.
+type EncodingDeclarer interface {
+	WithEncoding(name string) CaptionWriter
+}
+
+// NewEncodedWriter returns a writer encoding the output of writer in the named
+// encoding, preceded by a byte order mark when bom is true. Only the UTF-8 and
+// UTF-16 encodings have a byte order mark. When writer is an EncodingDeclarer,
+// the documents declare the encodings other than UTF-8, so that they are read back
+// with the right one.
+func NewEncodedWriter(writer CaptionWriter, name string, bom bool) (CaptionWriter, error) {
+	enc, name, byteOrderMark, err := outputEncoding(name, bom)
+	if err != nil {
+		return nil, err
+	}
+	if declarer, ok := writer.(EncodingDeclarer); ok && name != EncodingUTF8 {
+		writer = declarer.WithEncoding(name)
+	}
+	return &encodedWriter{writer: writer, encoding: enc, bom: byteOrderMark}, nil
+}
+
+// Encode returns the UTF-8 content encoded in the named encoding, preceded by a
+// byte order mark when bom is true, for output that isn't written by a CaptionWriter.
+func Encode(content []byte, name string, bom bool) ([]byte, error) {
+	enc, _, byteOrderMark, err := outputEncoding(name, bom)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := enc.NewEncoder().Bytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+	return append(append([]byte{}, byteOrderMark...), encoded...), nil
+}
+
+// outputEncoding returns the named encoding, its canonical name and its byte order
+// mark when bom is true. Only the UTF-8 and UTF-16 encodings have a byte order mark.
+func outputEncoding(name string, bom bool) (encoding.Encoding, string, []byte, error) {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unsupported encoding %q: %w", name, err)
+	}
+	if name, err = htmlindex.Name(enc); err != nil {
+		return nil, "", nil, fmt.Errorf("unsupported encoding %q: %w", name, err)
+	}
+	if !bom {
+		return enc, name, nil, nil
+	}
+	switch name {
+	case EncodingUTF8:
+		return enc, name, bomUTF8, nil
+	case EncodingUTF16LE:
+		return enc, name, bomUTF16LE, nil
+	case EncodingUTF16BE:
+		return enc, name, bomUTF16BE, nil
+	}
+	return nil, "", nil, fmt.Errorf("encoding %q has no byte order mark", name)
+}
+
+type encodedWriter struct {
+	writer   CaptionWriter
+	encoding encoding.Encoding
+	bom      []byte
+}
+
+func (w *encodedWriter) Write(captionSet *CaptionSet) ([]byte, error) {
+	content, err := w.writer.Write(captionSet)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := w.encoding.NewEncoder().Bytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+	return append(append([]byte{}, w.bom...), encoded...), nil
+}
+
+// WriteStream encodes the output of the wrapped writer as it's written, when it's
+// a StreamWriter.
+func (w *encodedWriter) WriteStream(out io.Writer, captionSet *CaptionSet) error {
+	if _, err := out.Write(w.bom); err != nil {
+		return err
+	}
+	encoder := transform.NewWriter(out, w.encoding.NewEncoder())
+	if err := WriteStream(w.writer, encoder, captionSet); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
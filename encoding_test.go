@@ -0,0 +1,121 @@
+package caps
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func utf16LE(s string) []byte {
+	output := []byte{}
+	for _, u := range utf16.Encode([]rune(s)) {
+		output = append(output, byte(u), byte(u>>8))
+	}
+	return output
+}
+
+func TestDetectEncoding(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		content  []byte
+		expected string
+	}{
+		{"ascii", []byte("1\n00:00:01,000 --> 00:00:02,000\nhello\n"), EncodingUTF8},
+		{"utf-8", []byte("café"), EncodingUTF8},
+		{"utf-8 bom", append([]byte{0xef, 0xbb, 0xbf}, "hello"...), EncodingUTF8},
+		{"utf-16le bom", append([]byte{0xff, 0xfe}, utf16LE("hello")...), EncodingUTF16LE},
+		{"utf-16be bom", []byte{0xfe, 0xff, 0, 'h', 0, 'i'}, EncodingUTF16BE},
+		{"utf-16le", utf16LE("<SAMI>hello</SAMI>"), EncodingUTF16LE},
+		{"xml declaration", []byte(`<?xml version="1.0" encoding="ISO-8859-1"?><tt>caf` + "\xe9" + `</tt>`), EncodingWindows1252},
+		{"html charset", []byte(`<SAMI><HEAD><META charset="windows-1251"></HEAD></SAMI>`), EncodingWindows1251},
+		{"utf-8 over declaration", []byte(`<?xml version="1.0" encoding="ISO-8859-1"?><tt>café</tt>`), EncodingUTF8},
+		{"windows-1252", []byte("caf\xe9 cr\xe8me br\xfbl\xe9e"), EncodingWindows1252},
+		{"windows-1251", []byte("\xcf\xf0\xe8\xe2\xe5\xf2 \xec\xe8\xf0"), EncodingWindows1251},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, DetectEncoding(test.content))
+		})
+	}
+}
+
+func TestDecodeInput(t *testing.T) {
+	content, encoding, err := DecodeInput([]byte("1\n00:00:01,000 --> 00:00:02,000\ncaf\xe9\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, EncodingWindows1252, encoding)
+	assert.Equal(t, "1\n00:00:01,000 --> 00:00:02,000\ncafé\n", string(content))
+
+	content, encoding, err = DecodeInput(append([]byte{0xff, 0xfe}, utf16LE("<SAMI>héllo</SAMI>")...))
+	assert.Nil(t, err)
+	assert.Equal(t, EncodingUTF16LE, encoding)
+	assert.Equal(t, "<SAMI>héllo</SAMI>", string(content))
+
+	content, encoding, err = DecodeInput([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?><tt>caf` + "\xe9" + `</tt>`))
+	assert.Nil(t, err)
+	assert.Equal(t, EncodingWindows1252, encoding)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?><tt>café</tt>`, string(content))
+
+	// UTF-8 content declaring another encoding
+	content, encoding, err = DecodeInput([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?><tt>café</tt>`))
+	assert.Nil(t, err)
+	assert.Equal(t, EncodingUTF8, encoding)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?><tt>café</tt>`, string(content))
+
+	content, _, err = DecodeInput([]byte(`<?xml version="1.0" encoding="utf8"?><tt>café</tt>`))
+	assert.Nil(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="utf8"?><tt>café</tt>`, string(content))
+
+	content, encoding, err = DecodeInput([]byte{0xef, 0xbb, 0xbf, 'h', 'i'})
+	assert.Nil(t, err)
+	assert.Equal(t, EncodingUTF8, encoding)
+	assert.Equal(t, "hi", string(content))
+}
+
+func TestDecodingReader(t *testing.T) {
+	in, err := NewDecodingReader(bytes.NewReader([]byte(`<?xml version="1.0" encoding="windows-1252"?><tt>caf`+"\xe9"+`</tt>`)), EncodingWindows1252)
+	assert.Nil(t, err)
+	content, err := ioutil.ReadAll(in)
+	assert.Nil(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?><tt>café</tt>`, string(content))
+
+	in, err = NewDecodingReader(bytes.NewReader([]byte("caf\xe9")), EncodingWindows1252)
+	assert.Nil(t, err)
+	content, err = ioutil.ReadAll(in)
+	assert.Nil(t, err)
+	assert.Equal(t, "café", string(content))
+}
+
+func TestEncodedWriter(t *testing.T) {
+	set := NewCaptionSet()
+	set.SetCaptions(DefaultLang, []*Caption{{Nodes: []CaptionContent{NewCaptionText("café")}}})
+
+	writer, err := NewEncodedWriter(bytesOnly{}, "utf-16le", true)
+	assert.Nil(t, err)
+	output, err := writer.Write(set)
+	assert.Nil(t, err)
+	assert.Equal(t, append([]byte{0xff, 0xfe}, utf16LE("café")...), output)
+	var stream bytes.Buffer
+	assert.Nil(t, WriteStream(writer, &stream, set))
+	assert.Equal(t, output, stream.Bytes())
+
+	writer, err = NewEncodedWriter(bytesOnly{}, "latin1", false)
+	assert.Nil(t, err)
+	output, err = writer.Write(set)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("caf\xe9"), output)
+
+	encoded, err := Encode([]byte("café"), "utf-16le", true)
+	assert.Nil(t, err)
+	assert.Equal(t, append([]byte{0xff, 0xfe}, utf16LE("café")...), encoded)
+
+	_, err = NewEncodedWriter(bytesOnly{}, "windows-1252", true)
+	assert.EqualError(t, err, `encoding "windows-1252" has no byte order mark`)
+	_, err = NewEncodedWriter(bytesOnly{}, "unknown", false)
+	assert.Error(t, err)
+
+	set.SetCaptions(DefaultLang, []*Caption{{Nodes: []CaptionContent{NewCaptionText("日本")}}})
+	_, err = writer.Write(set)
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package caps
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrEmptyFile is wrapped by the ParseError returned for files without captions.
+var ErrEmptyFile = errors.New("empty caption file")
+
+// ErrorCode is a machine-readable identifier of the kind of a ParseError.
+type ErrorCode string
+
+const (
+	// ErrCodeEmpty means the file doesn't contain any caption.
+	ErrCodeEmpty ErrorCode = "empty"
+	// ErrCodeSyntax means the file isn't well-formed, e.g. invalid XML.
+	ErrCodeSyntax ErrorCode = "syntax"
+	// ErrCodeMalformed means a caption block doesn't have the expected structure.
+	ErrCodeMalformed ErrorCode = "malformed"
+	// ErrCodeTimestamp means a timestamp or timecode can't be parsed.
+	ErrCodeTimestamp ErrorCode = "invalid_timestamp"
+	// ErrCodeTiming means valid timestamps are inconsistent, e.g. a caption ending before it starts.
+	ErrCodeTiming ErrorCode = "invalid_timing"
+	// ErrCodeParameter means a document wide parameter, e.g. a frame rate, is invalid.
+	ErrCodeParameter ErrorCode = "invalid_parameter"
+)
+
+// ParseError is the error returned by readers when the content of a file is invalid.
+// Line and Column are 1-based and 0 when the position is unknown, Snippet is the
+// offending part of the file when it's known.
+type ParseError struct {
+	Format  string
+	Line    int
+	Column  int
+	Snippet string
+	Code    ErrorCode
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	var msg strings.Builder
+	msg.WriteString(e.Format)
+	if e.Line > 0 {
+		fmt.Fprintf(&msg, ": line %d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&msg, ", column %d", e.Column)
+		}
+	}
+	msg.WriteString(": ")
+	msg.WriteString(e.Err.Error())
+	if e.Snippet != "" {
+		fmt.Fprintf(&msg, " (%q)", e.Snippet)
+	}
+	return msg.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// NewEmptyFileError returns the error readers return for files without captions.
+func NewEmptyFileError(format string) *ParseError {
+	return &ParseError{Format: format, Code: ErrCodeEmpty, Err: ErrEmptyFile}
+}
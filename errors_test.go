@@ -0,0 +1,29 @@
+package caps
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseError(t *testing.T) {
+	err := fmt.Errorf("error reading srt: %w", &ParseError{
+		Format:  "srt",
+		Line:    6,
+		Column:  18,
+		Snippet: "00:00:1x,000",
+		Code:    ErrCodeTimestamp,
+		Err:     errors.New("invalid srt timestamp"),
+	})
+	assert.EqualError(t, err, `error reading srt: srt: line 6, column 18: invalid srt timestamp ("00:00:1x,000")`)
+	var parseErr *ParseError
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, ErrCodeTimestamp, parseErr.Code)
+	assert.Equal(t, 6, parseErr.Line)
+
+	empty := NewEmptyFileError("webvtt")
+	assert.EqualError(t, empty, "webvtt: empty caption file")
+	assert.True(t, errors.Is(empty, ErrEmptyFile))
+}
@@ -0,0 +1,146 @@
+package fmp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errTruncated = errors.New("truncated box")
+
+// box returns an ISO BMFF box of the given type holding the payloads.
+func box(boxType string, payloads ...[]byte) []byte {
+	size := 8
+	for _, payload := range payloads {
+		size += len(payload)
+	}
+	output := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(output, uint32(size))
+	copy(output[4:], boxType)
+	for _, payload := range payloads {
+		output = append(output, payload...)
+	}
+	return output
+}
+
+// fullBox returns a box starting with a version and flags.
+func fullBox(boxType string, version byte, flags uint32, payloads ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(boxType, append([][]byte{header}, payloads...)...)
+}
+
+func u16(v uint16) []byte {
+	output := make([]byte, 2)
+	binary.BigEndian.PutUint16(output, v)
+	return output
+}
+
+func u32(v uint32) []byte {
+	output := make([]byte, 4)
+	binary.BigEndian.PutUint32(output, v)
+	return output
+}
+
+func u64(v uint64) []byte {
+	output := make([]byte, 8)
+	binary.BigEndian.PutUint64(output, v)
+	return output
+}
+
+// cstring returns the null terminated string.
+func cstring(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// parsedBox is a box read from a file, Offset being the position of the box in
+// the file and Payload its content after the header.
+type parsedBox struct {
+	Type    string
+	Offset  int
+	Payload []byte
+	header  int
+}
+
+// parseBoxes returns the boxes of content, offset being the position of content
+// in the file.
+func parseBoxes(content []byte, offset int) ([]parsedBox, error) {
+	boxes := []parsedBox{}
+	for pos := 0; pos < len(content); {
+		if len(content)-pos < 8 {
+			return nil, fmt.Errorf("%w at offset %d", errTruncated, offset+pos)
+		}
+		size := uint64(binary.BigEndian.Uint32(content[pos:]))
+		boxType := string(content[pos+4 : pos+8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			// the box extends to the end of the file
+			size = uint64(len(content) - pos)
+		case 1:
+			if len(content)-pos < 16 {
+				return nil, fmt.Errorf("%w at offset %d", errTruncated, offset+pos)
+			}
+			size, header = binary.BigEndian.Uint64(content[pos+8:]), 16
+		}
+		if size < header || size > uint64(len(content)-pos) {
+			return nil, fmt.Errorf("%w: %q at offset %d", errTruncated, boxType, offset+pos)
+		}
+		boxes = append(boxes, parsedBox{Type: boxType, Offset: offset + pos, Payload: content[pos+int(header) : pos+int(size)], header: int(header)})
+		pos += int(size)
+	}
+	return boxes, nil
+}
+
+// children returns the boxes held by the box, skip being the size of the fields
+// preceding them.
+func (b parsedBox) children(skip int) ([]parsedBox, error) {
+	if len(b.Payload) < skip {
+		return nil, fmt.Errorf("%w: %q at offset %d", errTruncated, b.Type, b.Offset)
+	}
+	return parseBoxes(b.Payload[skip:], b.Offset+b.header+skip)
+}
+
+// find returns the first box of the type, nil when there's none.
+func find(boxes []parsedBox, boxType string) *parsedBox {
+	for i := range boxes {
+		if boxes[i].Type == boxType {
+			return &boxes[i]
+		}
+	}
+	return nil
+}
+
+// fields reads the big-endian fields of a box payload, the first read past the
+// end of the payload setting err.
+type fields struct {
+	payload []byte
+	pos     int
+	err     error
+}
+
+func (f *fields) next(n int) []byte {
+	if f.err != nil || len(f.payload)-f.pos < n {
+		f.err = errTruncated
+		return make([]byte, n)
+	}
+	f.pos += n
+	return f.payload[f.pos-n : f.pos]
+}
+
+func (f *fields) u8() uint8 {
+	return f.next(1)[0]
+}
+
+func (f *fields) u32() uint32 {
+	return binary.BigEndian.Uint32(f.next(4))
+}
+
+func (f *fields) u64() uint64 {
+	return binary.BigEndian.Uint64(f.next(8))
+}
+
+// fullBoxHeader returns the version and the flags of a full box.
+func (f *fields) fullBoxHeader() (uint8, uint32) {
+	header := f.u32()
+	return uint8(header >> 24), header & 0xffffff
+}
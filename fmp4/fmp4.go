@@ -0,0 +1,68 @@
+// Package fmp4 packages captions as ISO BMFF (fragmented MP4) text tracks for DASH,
+// WebVTT cues in 'wvtt' samples and TTML documents in 'stpp' samples, as specified
+// by ISO/IEC 14496-30.
+package fmp4
+
+import (
+	"errors"
+	"time"
+
+	"github.com/vimeo/caps"
+)
+
+const format = "fmp4"
+
+// Codec is the sample entry of the text track, the format of its samples.
+type Codec string
+
+const (
+	// WVTT stores WebVTT cues in 'vttc' boxes, one sample per interval between cue times.
+	WVTT Codec = "wvtt"
+	// STPP stores a TTML document per sample, one sample per segment.
+	STPP Codec = "stpp"
+)
+
+const (
+	// timescale is the number of ticks per second of the media timeline.
+	timescale = 1000
+	trackID   = 1
+)
+
+const ttmlNamespace = "http://www.w3.org/ns/ttml"
+
+var (
+	errSegmentDuration = errors.New("segment duration must be positive")
+	errNoTextTrack     = errors.New("no wvtt or stpp track")
+	errSampleCount     = errors.New("invalid trun sample count")
+)
+
+func NewReader() caps.CaptionReader {
+	return &Reader{}
+}
+
+// NewWriter returns a writer packaging the captions of the first language with
+// the codec, in media segments of segmentDuration.
+func NewWriter(codec Codec, segmentDuration time.Duration) caps.CaptionWriter {
+	return &Writer{codec: codec, segmentDuration: segmentDuration}
+}
+
+// sample is a sample of the text track, its time and duration in timescale ticks.
+type sample struct {
+	time     uint64
+	duration uint32
+	data     []byte
+}
+
+// toTicks returns the time in ticks of the scale. Negative times, which captions
+// can have after an offset, are clamped to 0 as the track starts there.
+func toTicks(t caps.Timestamp, scale uint32) uint64 {
+	if t.Microseconds() < 0 {
+		return 0
+	}
+	micro := uint64(t.Microseconds())
+	return micro/1000000*uint64(scale) + micro%1000000*uint64(scale)/1000000
+}
+
+func fromTicks(ticks uint64, scale uint32) caps.Timestamp {
+	return caps.NewTimestamp(int64(ticks/uint64(scale)*1000000 + ticks%uint64(scale)*1000000/uint64(scale)))
+}
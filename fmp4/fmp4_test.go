@@ -0,0 +1,141 @@
+package fmp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vimeo/caps"
+	"github.com/vimeo/caps/webvtt"
+)
+
+const sampleWebVTT = `WEBVTT
+
+REGION
+id:fred
+width:40%
+
+intro
+00:00:01.000 --> 00:00:03.000 align:start
+<v Fred>Hi, my <i>name</i> is Fred</v>
+
+00:00:02.000 --> 00:00:05.000 region:fred
+across segments
+
+00:00:09.000 --> 00:00:10.000
+last
+`
+
+func readSample(t *testing.T) *caps.CaptionSet {
+	captionSet, err := webvtt.NewReader(false).Read([]byte(sampleWebVTT))
+	assert.Nil(t, err)
+	return captionSet
+}
+
+func TestWVTTRoundTrip(t *testing.T) {
+	captionSet := readSample(t)
+	writer := NewWriter(WVTT, 4*time.Second).(*Writer)
+	init, segments, err := writer.Segments(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(segments))
+	assert.True(t, NewReader().Detect(init))
+
+	boxes, err := parseBoxes(segments[0], 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"styp", "moof", "mdat"}, []string{boxes[0].Type, boxes[1].Type, boxes[2].Type})
+
+	fragment, err := readFragment(boxes[1], segments[0], track{id: trackID, timescale: timescale})
+	assert.Nil(t, err)
+	// empty, first cue, both cues, second cue
+	assert.Equal(t, []uint64{0, 1000, 2000, 3000}, []uint64{fragment[0].time, fragment[1].time, fragment[2].time, fragment[3].time})
+	assert.Equal(t, box("vtte"), fragment[0].data)
+
+	roundTrip, err := NewReader().(*Reader).ReadFragments(init, segments...)
+	assert.Nil(t, err)
+	assert.Equal(t, captionSet, roundTrip)
+}
+
+func TestSTPPRoundTrip(t *testing.T) {
+	captionSet := readSample(t)
+	content, err := NewWriter(STPP, 4*time.Second).Write(captionSet)
+	assert.Nil(t, err)
+	assert.True(t, NewReader().Detect(content))
+
+	roundTrip, err := NewReader().Read(content)
+	assert.Nil(t, err)
+	captions := roundTrip.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, 3, len(captions))
+	// the caption cut at the end of the first segment is merged back
+	assert.Equal(t, "across segments", captions[1].Text())
+	assert.Equal(t, caps.NewTimestamp(2000000), captions[1].Start)
+	assert.Equal(t, caps.NewTimestamp(5000000), captions[1].End)
+}
+
+func TestLanguage(t *testing.T) {
+	assert.Equal(t, uint16(0x55c4), packLanguage("und"))
+	assert.Equal(t, "eng", unpackLanguage(packLanguage("eng")))
+
+	captionSet := caps.NewCaptionSet()
+	captionSet.SetCaptions("fr-CA", readSample(t).GetCaptions(caps.DefaultLang))
+	content, err := NewWriter(WVTT, 10*time.Second).Write(captionSet)
+	assert.Nil(t, err)
+	roundTrip, err := NewReader().Read(content)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"fr-CA"}, roundTrip.Languages())
+}
+
+func TestSegmentErrors(t *testing.T) {
+	_, err := NewWriter(WVTT, 0).Write(readSample(t))
+	assert.Equal(t, errSegmentDuration, err)
+	_, err = NewWriter("tx3g", time.Second).Write(readSample(t))
+	assert.EqualError(t, err, `unknown codec "tx3g"`)
+	_, err = NewReader().Read([]byte{0, 0, 0, 16, 'f', 't', 'y', 'p'})
+	assert.True(t, err != nil)
+}
+
+func TestNegativeDataOffset(t *testing.T) {
+	content, err := NewWriter(WVTT, 10*time.Second).Write(readSample(t))
+	assert.Nil(t, err)
+	// the data offset, relative to the moof box, follows the type, version,
+	// flags and sample count of the trun box. Pointing one byte before the
+	// start of the file, the sample would end within it if the position wrapped.
+	moof := bytes.Index(content, []byte("moof")) - 4
+	trun := bytes.Index(content, []byte("trun"))
+	binary.BigEndian.PutUint32(content[trun+12:], uint32(int32(-moof-1)))
+	_, err = NewReader().Read(content)
+	assert.True(t, errors.Is(err, errTruncated))
+}
+
+func TestTrunSampleCount(t *testing.T) {
+	content, err := NewWriter(WVTT, 10*time.Second).Write(readSample(t))
+	assert.Nil(t, err)
+	// the sample count follows the type, version and flags of the trun box
+	trun := bytes.Index(content, []byte("trun"))
+	binary.BigEndian.PutUint32(content[trun+8:], 0xffffffff)
+	_, err = NewReader().Read(content)
+	assert.True(t, errors.Is(err, errTruncated))
+
+	// without sizes in the trun box, the samples have the default size of 0
+	content[trun+6] = 0
+	_, err = NewReader().Read(content)
+	assert.True(t, errors.Is(err, errSampleCount))
+}
+
+func TestNegativeTimes(t *testing.T) {
+	assert.Equal(t, uint64(0), toTicks(caps.NewTimestamp(-1500000), timescale))
+
+	caption := caps.NewCaption(caps.NewTimestamp(-1000000), caps.NewTimestamp(2000000), []caps.CaptionContent{caps.NewCaptionText("early")}, caps.DefaultStyleProps())
+	captionSet := caps.NewCaptionSet()
+	captionSet.SetCaptions(caps.DefaultLang, []*caps.Caption{&caption})
+	content, err := NewWriter(WVTT, 10*time.Second).Write(captionSet)
+	assert.Nil(t, err)
+	roundTrip, err := NewReader().Read(content)
+	assert.Nil(t, err)
+	captions := roundTrip.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, 1, len(captions))
+	assert.Equal(t, int64(0), captions[0].Start.Microseconds())
+	assert.Equal(t, int64(2000000), captions[0].End.Microseconds())
+}
@@ -0,0 +1,482 @@
+package fmp4
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vimeo/caps"
+	"github.com/vimeo/caps/dfxp"
+	"github.com/vimeo/caps/webvtt"
+)
+
+type Reader struct{}
+
+// track is the text track described by the moov box.
+type track struct {
+	id        uint32
+	codec     Codec
+	timescale uint32
+	lang      string
+	// config is the WebVTT header of wvtt tracks
+	config string
+	// defaultDuration and defaultSize are the trex defaults of the samples
+	defaultDuration uint32
+	defaultSize     uint32
+}
+
+// Detect reports whether the content starts with an ISO BMFF box and holds a
+// wvtt or stpp sample entry.
+func (r Reader) Detect(content []byte) bool {
+	if len(content) < 8 {
+		return false
+	}
+	switch string(content[4:8]) {
+	case "ftyp", "styp", "moov":
+		return bytes.Contains(content, []byte("wvtt")) || bytes.Contains(content, []byte("stpp"))
+	}
+	return false
+}
+
+// Read extracts the captions of a fragmented MP4 file, an initialization segment
+// followed by media segments.
+func (r Reader) Read(content []byte) (*caps.CaptionSet, error) {
+	boxes, err := parseBoxes(content, 0)
+	if err != nil {
+		return nil, err
+	}
+	moov := find(boxes, "moov")
+	if moov == nil {
+		return nil, errors.New("missing moov box")
+	}
+	t, err := readTrack(*moov)
+	if err != nil {
+		return nil, err
+	}
+	samples := []sample{}
+	for _, b := range boxes {
+		if b.Type != "moof" {
+			continue
+		}
+		fragment, err := readFragment(b, content, t)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, fragment...)
+	}
+	if t.codec == WVTT {
+		return readWVTT(t, samples)
+	}
+	return readSTPP(samples)
+}
+
+// ReadFragments extracts the captions of an initialization segment and its media segments.
+func (r Reader) ReadFragments(init []byte, segments ...[]byte) (*caps.CaptionSet, error) {
+	return r.Read(bytes.Join(append([][]byte{init}, segments...), nil))
+}
+
+// readTrack returns the first wvtt or stpp track of the moov box.
+func readTrack(moov parsedBox) (track, error) {
+	boxes, err := moov.children(0)
+	if err != nil {
+		return track{}, err
+	}
+	for _, trak := range boxes {
+		if trak.Type != "trak" {
+			continue
+		}
+		t, err := readTrak(trak)
+		if err != nil {
+			return track{}, err
+		}
+		if t.codec == "" {
+			continue
+		}
+		if mvex := find(boxes, "mvex"); mvex != nil {
+			if err := t.readDefaults(*mvex); err != nil {
+				return track{}, err
+			}
+		}
+		return t, nil
+	}
+	return track{}, errNoTextTrack
+}
+
+func readTrak(trak parsedBox) (track, error) {
+	t := track{lang: caps.DefaultLang}
+	boxes, err := trak.children(0)
+	if err != nil {
+		return t, err
+	}
+	tkhd, mdia := find(boxes, "tkhd"), find(boxes, "mdia")
+	if tkhd == nil || mdia == nil {
+		return t, errors.New("missing tkhd or mdia box")
+	}
+	f := fields{payload: tkhd.Payload}
+	if version, _ := f.fullBoxHeader(); version == 1 {
+		f.next(16)
+	} else {
+		f.next(8)
+	}
+	t.id = f.u32()
+	if f.err != nil {
+		return t, fmt.Errorf("invalid tkhd box: %w", f.err)
+	}
+
+	boxes, err = mdia.children(0)
+	if err != nil {
+		return t, err
+	}
+	if mdhd := find(boxes, "mdhd"); mdhd != nil {
+		f := fields{payload: mdhd.Payload}
+		version, _ := f.fullBoxHeader()
+		if version == 1 {
+			f.next(16)
+			t.timescale = f.u32()
+			f.next(8)
+		} else {
+			f.next(8)
+			t.timescale = f.u32()
+			f.next(4)
+		}
+		packed := uint16(f.u8())<<8 | uint16(f.u8())
+		if f.err != nil || t.timescale == 0 {
+			return t, errors.New("invalid mdhd box")
+		}
+		if language := unpackLanguage(packed); language != "und" {
+			t.lang = language
+		}
+	}
+	if elng := find(boxes, "elng"); elng != nil && len(elng.Payload) > 4 {
+		if lang := strings.TrimRight(string(elng.Payload[4:]), "\x00"); lang != "" {
+			t.lang = lang
+		}
+	}
+	stsd, err := findPath(boxes, "minf", "stbl", "stsd")
+	if err != nil || stsd == nil {
+		return t, err
+	}
+	// stsd holds the entry count after the version and flags
+	entries, err := stsd.children(8)
+	if err != nil {
+		return t, err
+	}
+	for _, entry := range entries {
+		switch Codec(entry.Type) {
+		case WVTT:
+			t.codec = WVTT
+			// the sample entry fields are 6 reserved bytes and the data reference index
+			children, err := entry.children(8)
+			if err != nil {
+				return t, err
+			}
+			if vttC := find(children, "vttC"); vttC != nil {
+				t.config = string(vttC.Payload)
+			}
+			return t, nil
+		case STPP:
+			t.codec = STPP
+			return t, nil
+		}
+	}
+	return t, nil
+}
+
+// readDefaults reads the sample defaults of the track in the trex box of mvex.
+func (t *track) readDefaults(mvex parsedBox) error {
+	boxes, err := mvex.children(0)
+	if err != nil {
+		return err
+	}
+	for _, b := range boxes {
+		if b.Type != "trex" {
+			continue
+		}
+		f := fields{payload: b.Payload}
+		f.fullBoxHeader()
+		id := f.u32()
+		f.next(4)
+		defaultDuration, defaultSize := f.u32(), f.u32()
+		if f.err != nil {
+			return fmt.Errorf("invalid trex box: %w", f.err)
+		}
+		if id == t.id {
+			t.defaultDuration, t.defaultSize = defaultDuration, defaultSize
+		}
+	}
+	return nil
+}
+
+// findPath returns the box found by following the path of box types, nil if missing.
+func findPath(boxes []parsedBox, path ...string) (*parsedBox, error) {
+	for i, boxType := range path {
+		b := find(boxes, boxType)
+		if b == nil || i == len(path)-1 {
+			return b, nil
+		}
+		var err error
+		if boxes, err = b.children(0); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// readFragment returns the samples of the track in a moof box, content being the
+// whole file the sample data offsets point into.
+func readFragment(moof parsedBox, content []byte, t track) ([]sample, error) {
+	boxes, err := moof.children(0)
+	if err != nil {
+		return nil, err
+	}
+	samples := []sample{}
+	for _, traf := range boxes {
+		if traf.Type != "traf" {
+			continue
+		}
+		children, err := traf.children(0)
+		if err != nil {
+			return nil, err
+		}
+		tfhd := find(children, "tfhd")
+		if tfhd == nil {
+			return nil, errors.New("missing tfhd box")
+		}
+		f := fields{payload: tfhd.Payload}
+		_, flags := f.fullBoxHeader()
+		if f.u32() != t.id {
+			continue
+		}
+		// offsets are computed as int64, a negative data offset being valid as long
+		// as the data ends up in the file
+		base := int64(moof.Offset)
+		if flags&0x01 != 0 {
+			base = int64(f.u64())
+		}
+		if flags&0x02 != 0 {
+			f.u32()
+		}
+		defaultDuration, defaultSize := t.defaultDuration, t.defaultSize
+		if flags&0x08 != 0 {
+			defaultDuration = f.u32()
+		}
+		if flags&0x10 != 0 {
+			defaultSize = f.u32()
+		}
+		if f.err != nil {
+			return nil, fmt.Errorf("invalid tfhd box: %w", f.err)
+		}
+
+		decodeTime := uint64(0)
+		if tfdt := find(children, "tfdt"); tfdt != nil {
+			f := fields{payload: tfdt.Payload}
+			if version, _ := f.fullBoxHeader(); version == 1 {
+				decodeTime = f.u64()
+			} else {
+				decodeTime = uint64(f.u32())
+			}
+			if f.err != nil {
+				return nil, fmt.Errorf("invalid tfdt box: %w", f.err)
+			}
+		}
+		// without a data offset, the data follows the moof box and the mdat header
+		position := int64(moof.Offset + moof.header + len(moof.Payload) + 8)
+		for _, trun := range children {
+			if trun.Type != "trun" {
+				continue
+			}
+			f := fields{payload: trun.Payload}
+			_, flags := f.fullBoxHeader()
+			count := f.u32()
+			if flags&0x01 != 0 {
+				position = base + int64(int32(f.u32()))
+			}
+			if flags&0x04 != 0 {
+				f.u32()
+			}
+			if err := checkSampleCount(flags, count, len(f.payload)-f.pos, defaultSize, int64(len(content))-position); err != nil {
+				return nil, err
+			}
+			for i := uint32(0); i < count && f.err == nil; i++ {
+				duration, size := defaultDuration, defaultSize
+				if flags&0x100 != 0 {
+					duration = f.u32()
+				}
+				if flags&0x200 != 0 {
+					size = f.u32()
+				}
+				if flags&0x400 != 0 {
+					f.u32()
+				}
+				if flags&0x800 != 0 {
+					f.u32()
+				}
+				if position < 0 || position > int64(len(content)) || int64(size) > int64(len(content))-position {
+					return nil, fmt.Errorf("%w: sample data at offset %d", errTruncated, position)
+				}
+				samples = append(samples, sample{time: decodeTime, duration: duration, data: content[position : position+int64(size)]})
+				decodeTime += uint64(duration)
+				position += int64(size)
+			}
+			if f.err != nil {
+				return nil, fmt.Errorf("invalid trun box: %w", f.err)
+			}
+		}
+	}
+	return samples, nil
+}
+
+// checkSampleCount checks the sample count of a trun box against the bytes left,
+// before the samples are allocated: the remaining payload when the samples have
+// fields in the box, or the data left in the file when they all have the default
+// size, which must then not be zero.
+func checkSampleCount(flags, count uint32, payload int, defaultSize uint32, data int64) error {
+	sampleFields := 0
+	for _, flag := range []uint32{0x100, 0x200, 0x400, 0x800} {
+		if flags&flag != 0 {
+			sampleFields += 4
+		}
+	}
+	if sampleFields > 0 {
+		if uint64(count)*uint64(sampleFields) > uint64(payload) {
+			return fmt.Errorf("%w: trun box of %d samples", errTruncated, count)
+		}
+		return nil
+	}
+	if count > 0 && defaultSize == 0 {
+		return fmt.Errorf("%w: %d samples without size", errSampleCount, count)
+	}
+	if data < 0 || uint64(count)*uint64(defaultSize) > uint64(data) {
+		return fmt.Errorf("%w: trun box of %d samples", errTruncated, count)
+	}
+	return nil
+}
+
+// cue is a cue of a wvtt track, lasting over consecutive samples.
+type cue struct {
+	id       string
+	settings string
+	text     string
+	start    uint64
+	end      uint64
+}
+
+// readWVTT returns the cues of the samples of a wvtt track, merging the cues
+// repeated in consecutive samples, read as a WebVTT file.
+func readWVTT(t track, samples []sample) (*caps.CaptionSet, error) {
+	cues := []*cue{}
+	// previous holds the cues of the previous sample
+	previous := []*cue{}
+	for _, s := range samples {
+		boxes, err := parseBoxes(s.data, 0)
+		if err != nil {
+			return nil, err
+		}
+		current := []*cue{}
+		for _, vttc := range boxes {
+			if vttc.Type != "vttc" {
+				continue
+			}
+			children, err := vttc.children(0)
+			if err != nil {
+				return nil, err
+			}
+			c := &cue{start: s.time, end: s.time + uint64(s.duration)}
+			for _, child := range children {
+				switch child.Type {
+				case "iden":
+					c.id = string(child.Payload)
+				case "sttg":
+					c.settings = string(child.Payload)
+				case "payl":
+					c.text = string(child.Payload)
+				}
+			}
+			current = append(current, continueCue(c, previous, &cues))
+		}
+		previous = current
+	}
+	if len(cues) == 0 {
+		return nil, caps.NewEmptyFileError(format)
+	}
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].start < cues[j].start })
+
+	document := strings.Builder{}
+	config := strings.TrimSpace(t.config)
+	if !strings.HasPrefix(config, "WEBVTT") {
+		config = "WEBVTT"
+	}
+	document.WriteString(config + "\n\n")
+	for _, c := range cues {
+		if c.id != "" {
+			document.WriteString(c.id + "\n")
+		}
+		start, end := fromTicks(c.start, t.timescale), fromTicks(c.end, t.timescale)
+		fmt.Fprintf(&document, "%s --> %s %s\n%s\n\n", start.FormatWebVTT(), end.FormatWebVTT(), c.settings, c.text)
+	}
+	captionSet, err := webvtt.NewReader(true).Read([]byte(document.String()))
+	if err != nil {
+		return nil, err
+	}
+	if t.lang != caps.DefaultLang {
+		captionSet.SetCaptions(t.lang, captionSet.GetCaptions(caps.DefaultLang))
+		delete(captionSet.Captions, caps.DefaultLang)
+	}
+	return captionSet, nil
+}
+
+// continueCue returns the cue of previous continued by c, extended to the end of c,
+// or c added to cues when it's a new cue.
+func continueCue(c *cue, previous []*cue, cues *[]*cue) *cue {
+	for _, p := range previous {
+		if p.end == c.start && p.id == c.id && p.settings == c.settings && p.text == c.text {
+			p.end = c.end
+			return p
+		}
+	}
+	*cues = append(*cues, c)
+	return c
+}
+
+// readSTPP returns the captions of the TTML documents of the samples of a stpp
+// track, merging the captions cut at the end of a sample with their continuation.
+func readSTPP(samples []sample) (*caps.CaptionSet, error) {
+	captionSet := caps.NewCaptionSet()
+	for _, s := range samples {
+		document, err := dfxp.NewReader().Read(s.data)
+		if errors.Is(err, caps.ErrEmptyFile) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ttml sample: %w", err)
+		}
+		for _, style := range document.GetStyles() {
+			captionSet.AddStyle(style)
+		}
+		for _, region := range document.GetRegions() {
+			captionSet.AddRegion(region)
+		}
+		for _, lang := range document.Languages() {
+			captions := captionSet.GetCaptions(lang)
+			for _, caption := range document.GetCaptions(lang) {
+				if n := len(captions); n > 0 && captions[n-1].End.Equal(caption.Start) && captions[n-1].Text() == caption.Text() {
+					captions[n-1].End = caption.End
+					continue
+				}
+				captions = append(captions, caption)
+			}
+			captionSet.SetCaptions(lang, captions)
+		}
+	}
+	if captionSet.IsEmpty() {
+		return nil, caps.NewEmptyFileError(format)
+	}
+	return captionSet, nil
+}
+
+// unpackLanguage returns the ISO 639-2/T code packed in the mdhd box.
+func unpackLanguage(packed uint16) string {
+	return string([]byte{byte(packed>>10&0x1f) + 0x60, byte(packed>>5&0x1f) + 0x60, byte(packed&0x1f) + 0x60})
+}
@@ -0,0 +1,250 @@
+package fmp4
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vimeo/caps"
+	"github.com/vimeo/caps/dfxp"
+	"github.com/vimeo/caps/webvtt"
+)
+
+// iso639 matches the languages that can be set in the mdhd box, the full tag being
+// written in the elng box.
+var iso639 = regexp.MustCompile(`^[a-z]{3}$`)
+
+type Writer struct {
+	codec           Codec
+	segmentDuration time.Duration
+}
+
+// Write returns the initialization segment followed by the media segments, a
+// complete fragmented MP4 file.
+func (w *Writer) Write(captionSet *caps.CaptionSet) ([]byte, error) {
+	init, segments, err := w.Segments(captionSet)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Join(append([][]byte{init}, segments...), nil), nil
+}
+
+// Segments returns the initialization segment and the media segments of the
+// captions, each media segment lasting the segment duration but the last one,
+// ending with the last caption. Captions spanning several segments are split.
+func (w *Writer) Segments(captionSet *caps.CaptionSet) ([]byte, [][]byte, error) {
+	if w.segmentDuration <= 0 {
+		return nil, nil, errSegmentDuration
+	}
+	lang := caps.DefaultLang
+	if languages := captionSet.Languages(); len(languages) > 0 {
+		lang = languages[0]
+	}
+	captions := captionSet.GetCaptions(lang)
+	init, err := w.initSegment(captionSet, lang)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	total := uint64(0)
+	for _, caption := range captions {
+		if end := toTicks(caption.End, timescale); end > total {
+			total = end
+		}
+	}
+	duration := toTicks(caps.TimestampFromDuration(w.segmentDuration), timescale)
+	segments := [][]byte{}
+	for start := uint64(0); start < total || len(segments) == 0; start += duration {
+		end := start + duration
+		if end > total && total > start {
+			end = total
+		}
+		var samples []sample
+		if w.codec == WVTT {
+			samples = wvttSamples(captions, start, end)
+		} else {
+			samples, err = stppSamples(captionSet, lang, captions, start, end)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		segments = append(segments, mediaSegment(uint32(len(segments)+1), start, samples))
+	}
+	return init, segments, nil
+}
+
+// wvttSamples returns the samples of the cues displayed between start and end, a
+// sample for each interval between cue times holding a vttc box for each cue
+// displayed, or an empty vtte box.
+func wvttSamples(captions []*caps.Caption, start, end uint64) []sample {
+	times := []uint64{start, end}
+	for _, caption := range captions {
+		captionStart, captionEnd := toTicks(caption.Start, timescale), toTicks(caption.End, timescale)
+		if captionStart < end && captionEnd > start {
+			if captionStart > start {
+				times = append(times, captionStart)
+			}
+			if captionEnd < end {
+				times = append(times, captionEnd)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	samples := []sample{}
+	for i := 0; i+1 < len(times); i++ {
+		if times[i] == times[i+1] {
+			continue
+		}
+		data := []byte{}
+		for _, caption := range captions {
+			if toTicks(caption.Start, timescale) <= times[i] && toTicks(caption.End, timescale) > times[i] {
+				data = append(data, vttcBox(caption)...)
+			}
+		}
+		if len(data) == 0 {
+			data = box("vtte")
+		}
+		samples = append(samples, sample{time: times[i], duration: uint32(times[i+1] - times[i]), data: data})
+	}
+	return samples
+}
+
+// vttcBox returns the box of a cue, with its identifier, settings and text.
+func vttcBox(caption *caps.Caption) []byte {
+	text, settings := webvtt.FormatCue(*caption)
+	children := [][]byte{}
+	if caption.ID != "" {
+		children = append(children, box("iden", []byte(caption.ID)))
+	}
+	if settings != "" {
+		children = append(children, box("sttg", []byte(settings)))
+	}
+	children = append(children, box("payl", []byte(text)))
+	return box("vttc", children...)
+}
+
+// stppSamples returns the sample of the captions displayed between start and end,
+// a TTML document holding them cut to the segment.
+func stppSamples(captionSet *caps.CaptionSet, lang string, captions []*caps.Caption, start, end uint64) ([]sample, error) {
+	segment := caps.NewCaptionSet()
+	segment.Styles = captionSet.Styles
+	segment.Regions = captionSet.Regions
+	cut := []*caps.Caption{}
+	for _, caption := range captions {
+		captionStart, captionEnd := toTicks(caption.Start, timescale), toTicks(caption.End, timescale)
+		if captionStart >= end || captionEnd <= start {
+			continue
+		}
+		c := *caption
+		if captionStart < start {
+			c.Start = fromTicks(start, timescale)
+		}
+		if captionEnd > end {
+			c.End = fromTicks(end, timescale)
+		}
+		cut = append(cut, &c)
+	}
+	if len(cut) > 0 {
+		segment.SetCaptions(lang, cut)
+	}
+	document, err := dfxp.NewWriter().Write(segment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write ttml sample: %w", err)
+	}
+	return []sample{{time: start, duration: uint32(end - start), data: document}}, nil
+}
+
+// initSegment returns the ftyp and moov boxes describing the text track.
+func (w *Writer) initSegment(captionSet *caps.CaptionSet, lang string) ([]byte, error) {
+	var entry, mediaHeader []byte
+	handler := ""
+	switch w.codec {
+	case WVTT:
+		// the configuration holds the header of a WebVTT file, regions and styles
+		header := caps.NewCaptionSet()
+		header.Styles = captionSet.Styles
+		header.Regions = captionSet.Regions
+		config, err := webvtt.NewWriter().Write(header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write webvtt configuration: %w", err)
+		}
+		entry = box("wvtt", make([]byte, 6), u16(1), box("vttC", bytes.TrimSpace(config)))
+		handler, mediaHeader = "text", fullBox("nmhd", 0, 0)
+	case STPP:
+		entry = box("stpp", make([]byte, 6), u16(1), cstring(ttmlNamespace), cstring(""), cstring(""))
+		handler, mediaHeader = "subt", fullBox("sthd", 0, 0)
+	default:
+		return nil, fmt.Errorf("unknown codec %q", w.codec)
+	}
+
+	matrix := bytes.Join([][]byte{u32(0x00010000), u32(0), u32(0), u32(0), u32(0x00010000), u32(0), u32(0), u32(0), u32(0x40000000)}, nil)
+	language := "und"
+	if primary := strings.ToLower(strings.Split(lang, "-")[0]); iso639.MatchString(primary) {
+		language = primary
+	}
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, u32(1), entry),
+		fullBox("stts", 0, 0, u32(0)),
+		fullBox("stsc", 0, 0, u32(0)),
+		fullBox("stsz", 0, 0, u32(0), u32(0)),
+		fullBox("stco", 0, 0, u32(0)),
+	)
+	mdia := box("mdia",
+		fullBox("mdhd", 0, 0, u32(0), u32(0), u32(timescale), u32(0), u16(packLanguage(language)), u16(0)),
+		fullBox("elng", 0, 0, cstring(lang)),
+		fullBox("hdlr", 0, 0, u32(0), []byte(handler), make([]byte, 12), cstring("caps")),
+		box("minf", mediaHeader, box("dinf", fullBox("dref", 0, 0, u32(1), fullBox("url ", 0, 1))), stbl),
+	)
+	// the track is enabled and in the presentation
+	tkhd := fullBox("tkhd", 0, 3, u32(0), u32(0), u32(trackID), u32(0), u32(0), make([]byte, 8), u16(0), u16(0), u16(0), u16(0), matrix, u32(0), u32(0))
+	moov := box("moov",
+		fullBox("mvhd", 0, 0, u32(0), u32(0), u32(timescale), u32(0), u32(0x00010000), u16(0x0100), make([]byte, 10), matrix, make([]byte, 24), u32(trackID+1)),
+		box("trak", tkhd, mdia),
+		box("mvex", fullBox("trex", 0, 0, u32(trackID), u32(1), u32(0), u32(0), u32(0))),
+	)
+	ftyp := box("ftyp", []byte("iso6"), u32(0), []byte("iso6"), []byte("dash"))
+	return append(ftyp, moov...), nil
+}
+
+// mediaSegment returns the styp, moof and mdat boxes of the samples, decodeTime
+// being the time of the first one.
+func mediaSegment(sequence uint32, decodeTime uint64, samples []sample) []byte {
+	data := [][]byte{}
+	for _, s := range samples {
+		data = append(data, s.data)
+	}
+	moof := func(dataOffset uint32) []byte {
+		entries := [][]byte{u32(uint32(len(samples))), u32(dataOffset)}
+		for _, s := range samples {
+			entries = append(entries, u32(s.duration), u32(uint32(len(s.data))))
+		}
+		// the tfhd default-base-is-moof flag makes the data offset relative to
+		// the moof box, and the trun flags announce the data offset and the
+		// duration and size of each sample
+		return box("moof",
+			fullBox("mfhd", 0, 0, u32(sequence)),
+			box("traf",
+				fullBox("tfhd", 0, 0x020000, u32(trackID)),
+				fullBox("tfdt", 1, 0, u64(decodeTime)),
+				fullBox("trun", 0, 0x000301, entries...),
+			),
+		)
+	}
+	// the samples follow the moof box and the mdat header
+	header := moof(uint32(len(moof(0)) + 8))
+	styp := box("styp", []byte("msdh"), u32(0), []byte("msdh"), []byte("msix"))
+	return bytes.Join([][]byte{styp, header, box("mdat", data...)}, nil)
+}
+
+// packLanguage returns the ISO 639-2/T code packed as in the mdhd box, 5 bits per letter.
+func packLanguage(language string) uint16 {
+	packed := uint16(0)
+	for i := 0; i < 3; i++ {
+		packed = packed<<5 | uint16(language[i]-0x60)
+	}
+	return packed
+}
@@ -10,4 +10,5 @@ require (
 	github.com/sergi/go-diff v1.3.1 // indirect
 	github.com/stretchr/testify v1.4.0
 	golang.org/x/net v0.0.0-20220708220712-1185a9018129
+	golang.org/x/text v0.3.7
 )
@@ -0,0 +1,192 @@
+package caps
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Recovery is the way a LenientReader handles invalid cues, see WithRecovery.
+type Recovery int
+
+const (
+	// Strict fails on the first invalid cue, which is what readers do by default.
+	Strict Recovery = iota
+	// Skip drops the invalid cues.
+	Skip
+	// Clamp moves invalid timings to the closest valid ones, e.g. a cue ending before
+	// its start ends at its start. Cues that can't be clamped are dropped.
+	Clamp
+	// Repair tries to recover what was meant, e.g. parsing timestamps using the wrong
+	// separators, swapping inverted timings or sorting cues. Cues that can't be
+	// repaired are dropped.
+	Repair
+)
+
+var recoveryNames = []string{"strict", "skip", "clamp", "repair"}
+
+func (r Recovery) String() string {
+	if r < 0 || int(r) >= len(recoveryNames) {
+		return fmt.Sprintf("Recovery(%d)", int(r))
+	}
+	return recoveryNames[r]
+}
+
+// ParseRecovery returns the recovery named s: strict, skip, clamp or repair.
+func ParseRecovery(s string) (Recovery, error) {
+	for i, name := range recoveryNames {
+		if strings.EqualFold(s, name) {
+			return Recovery(i), nil
+		}
+	}
+	return Strict, fmt.Errorf("unknown recovery %q", s)
+}
+
+// Warning describes an invalid part of a file recovered by a LenientReader.
+type Warning struct {
+	// Err is the problem found, as Read would have reported it.
+	Err *ParseError
+	// Action is what was done to recover from it: ActionSkipped, ActionClamped or ActionRepaired.
+	Action string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Err, w.Action)
+}
+
+// WarningFunc receives the warnings of a reader recovering from invalid cues.
+type WarningFunc func(Warning)
+
+// Report passes each warning to f, when f isn't nil.
+func (f WarningFunc) Report(warnings []Warning) {
+	if f == nil {
+		return
+	}
+	for _, warning := range warnings {
+		f(warning)
+	}
+}
+
+// LenientReader is implemented by readers that can recover from invalid cues.
+// WithRecovery returns a copy of the reader whose Read and ReadStream recover
+// according to recovery, passing a warning to warn (which may be nil) for each
+// recovered problem. Errors that prevent reading the file at all, like invalid
+// XML or a file without captions, are still returned as errors.
+type LenientReader interface {
+	WithRecovery(recovery Recovery, warn WarningFunc) CaptionReader
+}
+
+// WithRecovery returns a copy of reader recovering from invalid cues when it's a
+// LenientReader, and reader itself otherwise.
+func WithRecovery(reader CaptionReader, recovery Recovery, warn WarningFunc) CaptionReader {
+	if lenientReader, ok := reader.(LenientReader); ok {
+		return lenientReader.WithRecovery(recovery, warn)
+	}
+	return reader
+}
+
+// ReadLenient reads content with recovery, returning the captions that could be
+// read along with the warnings.
+func ReadLenient(reader CaptionReader, content []byte, recovery Recovery) (*CaptionSet, []Warning, error) {
+	warnings := []Warning{}
+	captionSet, err := WithRecovery(reader, recovery, func(warning Warning) {
+		warnings = append(warnings, warning)
+	}).Read(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	return captionSet, warnings, nil
+}
+
+// Warning actions.
+const (
+	ActionSkipped  = "skipped"
+	ActionClamped  = "clamped"
+	ActionRepaired = "repaired"
+)
+
+// defaultRepairDuration is the duration given to cues without an end and
+// without a following cue.
+const defaultRepairDuration = 4 * time.Second
+
+// RecoverTimings checks the timings of captions, lines holding the line number of
+// the timing of each caption in the file (or 0 when unknown), and fixes the invalid
+// ones according to recovery:
+//   - cues without a start are dropped;
+//   - cues without an end are dropped, or end when the next cue starts with Clamp
+//     and Repair;
+//   - cues ending before they start are dropped, end at their start with Clamp or
+//     have their timings swapped with Repair;
+//   - cues starting before the previous one are dropped, start with the previous
+//     one with Clamp, or are sorted with Repair.
+//
+// Readers use it in lenient mode, after reading all the cues.
+func RecoverTimings(format string, captions []*Caption, lines []int, recovery Recovery) ([]*Caption, []Warning) {
+	warnings := []Warning{}
+	if recovery == Strict {
+		return captions, warnings
+	}
+	warn := func(i int, message string, code ErrorCode, action string) {
+		line := 0
+		if i < len(lines) {
+			line = lines[i]
+		}
+		caption := captions[i]
+		snippet := fmt.Sprintf("%s --> %s", caption.FormatStart(), caption.FormatEnd())
+		err := &ParseError{Format: format, Line: line, Snippet: snippet, Code: code, Err: fmt.Errorf("%s", message)}
+		warnings = append(warnings, Warning{Err: err, Action: action})
+	}
+	action := map[Recovery]string{Skip: ActionSkipped, Clamp: ActionClamped, Repair: ActionRepaired}[recovery]
+	valid := []*Caption{}
+	var previous *Caption
+	unsorted := false
+	for i, caption := range captions {
+		if !caption.Start.IsSet() {
+			warn(i, "invalid cue start timestamp", ErrCodeTimestamp, ActionSkipped)
+			continue
+		}
+		if !caption.End.IsSet() {
+			warn(i, "invalid cue end timestamp", ErrCodeTimestamp, action)
+			if recovery == Skip {
+				continue
+			}
+			caption.End = caption.Start.Add(defaultRepairDuration)
+			if i+1 < len(captions) && captions[i+1].Start.After(caption.Start) {
+				caption.End = captions[i+1].Start
+			}
+		}
+		if caption.End.Before(caption.Start) {
+			warn(i, "end timestamp is not greater than start timestamp", ErrCodeTiming, action)
+			switch recovery {
+			case Skip:
+				continue
+			case Clamp:
+				caption.End = caption.Start
+			case Repair:
+				caption.Start, caption.End = caption.End, caption.Start
+			}
+		}
+		if previous != nil && caption.Start.Before(previous.Start) {
+			warn(i, "start timestamp is not greater to start timestamp of previous cue", ErrCodeTiming, action)
+			switch recovery {
+			case Skip:
+				continue
+			case Clamp:
+				duration := caption.End.Sub(caption.Start)
+				caption.Start = previous.Start
+				caption.End = caption.Start.Add(duration)
+			case Repair:
+				unsorted = true
+			}
+		}
+		valid = append(valid, caption)
+		previous = caption
+	}
+	if unsorted {
+		sort.SliceStable(valid, func(i, j int) bool {
+			return valid[i].Start.Before(valid[j].Start)
+		})
+	}
+	return valid, warnings
+}
@@ -0,0 +1,104 @@
+package caps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func timedCaptions(timings ...[2]int64) []*Caption {
+	captions := []*Caption{}
+	for _, timing := range timings {
+		c := NewCaption(NewTimestamp(timing[0]*microSecond), NewTimestamp(timing[1]*microSecond), []CaptionContent{NewCaptionText("text")}, DefaultStyleProps())
+		captions = append(captions, &c)
+	}
+	return captions
+}
+
+func TestRecoverTimings(t *testing.T) {
+	tests := []struct {
+		recovery     Recovery
+		wantTimings  []string
+		wantActions  []string
+		wantWarnings []string
+	}{
+		{
+			recovery:    Skip,
+			wantTimings: []string{"00:00:01.000 --> 00:00:02.000", "00:00:06.000 --> 00:00:07.000"},
+			wantActions: []string{ActionSkipped, ActionSkipped},
+			wantWarnings: []string{
+				`srt: line 6: end timestamp is not greater than start timestamp ("00:00:05.000 --> 00:00:04.000"): skipped`,
+				`srt: line 14: start timestamp is not greater to start timestamp of previous cue ("00:00:03.000 --> 00:00:04.000"): skipped`,
+			},
+		},
+		{
+			recovery:    Clamp,
+			wantTimings: []string{"00:00:01.000 --> 00:00:02.000", "00:00:05.000 --> 00:00:05.000", "00:00:06.000 --> 00:00:07.000", "00:00:06.000 --> 00:00:07.000"},
+			wantActions: []string{ActionClamped, ActionClamped},
+		},
+		{
+			recovery:    Repair,
+			wantTimings: []string{"00:00:01.000 --> 00:00:02.000", "00:00:03.000 --> 00:00:04.000", "00:00:04.000 --> 00:00:05.000", "00:00:06.000 --> 00:00:07.000"},
+			wantActions: []string{ActionRepaired, ActionRepaired},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.recovery.String(), func(t *testing.T) {
+			captions := timedCaptions([2]int64{1, 2}, [2]int64{5, 4}, [2]int64{6, 7}, [2]int64{3, 4})
+			recovered, warnings := RecoverTimings("srt", captions, []int{2, 6, 10, 14}, test.recovery)
+			timings := []string{}
+			for _, caption := range recovered {
+				timings = append(timings, caption.FormatStart()+" --> "+caption.FormatEnd())
+			}
+			assert.Equal(t, test.wantTimings, timings)
+			actions := []string{}
+			messages := []string{}
+			for _, warning := range warnings {
+				actions = append(actions, warning.Action)
+				messages = append(messages, warning.String())
+			}
+			assert.Equal(t, test.wantActions, actions)
+			if test.wantWarnings != nil {
+				assert.Equal(t, test.wantWarnings, messages)
+			}
+		})
+	}
+}
+
+func TestRecoverTimingsMissingEnd(t *testing.T) {
+	captions := timedCaptions([2]int64{1, 2}, [2]int64{3, 4})
+	captions[0].End = Timestamp{}
+	captions[1].End = Timestamp{}
+
+	recovered, warnings := RecoverTimings("scc", timedCopy(captions), nil, Skip)
+	assert.Equal(t, 0, len(recovered))
+	assert.Equal(t, 2, len(warnings))
+
+	recovered, warnings = RecoverTimings("scc", timedCopy(captions), nil, Repair)
+	assert.Equal(t, 2, len(warnings))
+	assert.Equal(t, "00:00:03.000", recovered[0].FormatEnd())
+	assert.Equal(t, "00:00:07.000", recovered[1].FormatEnd())
+
+	recovered, warnings = RecoverTimings("scc", timedCopy(captions), nil, Strict)
+	assert.Equal(t, 2, len(recovered))
+	assert.Equal(t, 0, len(warnings))
+}
+
+func timedCopy(captions []*Caption) []*Caption {
+	copies := []*Caption{}
+	for _, caption := range captions {
+		c := *caption
+		copies = append(copies, &c)
+	}
+	return copies
+}
+
+func TestParseRecovery(t *testing.T) {
+	for _, recovery := range []Recovery{Strict, Skip, Clamp, Repair} {
+		parsed, err := ParseRecovery(recovery.String())
+		assert.Nil(t, err)
+		assert.Equal(t, recovery, parsed)
+	}
+	_, err := ParseRecovery("fix")
+	assert.EqualError(t, err, `unknown recovery "fix"`)
+}
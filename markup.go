@@ -0,0 +1,72 @@
+package caps
+
+// TagStack is the stack of the tags open in the markup of a caption, for readers
+// of HTML-like formats: an end tag closes the tags opened after the matching start
+// tag, and the tags left open are closed at the end of the caption.
+type TagStack struct {
+	names   []string
+	closing []CaptionContent
+}
+
+// Open pushes the tag name, closed by the closing node.
+func (s *TagStack) Open(name string, closing CaptionContent) {
+	s.names = append(s.names, name)
+	s.closing = append(s.closing, closing)
+}
+
+// Close returns the closing nodes of the last tag named name and of the tags
+// opened after it, innermost first, or none when no such tag is open.
+func (s *TagStack) Close(name string) []CaptionContent {
+	for i := len(s.names) - 1; i >= 0; i-- {
+		if s.names[i] == name {
+			return s.closeFrom(i)
+		}
+	}
+	return nil
+}
+
+// CloseAll returns the closing nodes of all the open tags, innermost first.
+func (s *TagStack) CloseAll() []CaptionContent {
+	return s.closeFrom(0)
+}
+
+func (s *TagStack) closeFrom(i int) []CaptionContent {
+	nodes := []CaptionContent{}
+	for j := len(s.closing) - 1; j >= i; j-- {
+		nodes = append(nodes, s.closing[j])
+	}
+	s.names, s.closing = s.names[:i], s.closing[:i]
+	return nodes
+}
+
+// MarkupStack is the stack of the markup opened by the style and span nodes of a
+// caption, for writers: a closing node closes the markup of the last start node,
+// and the markup left open is closed at the end of the caption.
+type MarkupStack struct {
+	closing []string
+}
+
+// Push records the markup closing the markup of a start node.
+func (s *MarkupStack) Push(closing string) {
+	s.closing = append(s.closing, closing)
+}
+
+// Pop returns the markup closing the last start node, or an empty string when
+// none is open.
+func (s *MarkupStack) Pop() string {
+	if len(s.closing) == 0 {
+		return ""
+	}
+	closing := s.closing[len(s.closing)-1]
+	s.closing = s.closing[:len(s.closing)-1]
+	return closing
+}
+
+// PopAll returns the markup closing all the open start nodes, innermost first.
+func (s *MarkupStack) PopAll() string {
+	closing := ""
+	for len(s.closing) > 0 {
+		closing += s.Pop()
+	}
+	return closing
+}
@@ -0,0 +1,32 @@
+package caps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagStack(t *testing.T) {
+	italics, bold := StyleProps{Italics: true}, StyleProps{Bold: true}
+	open := TagStack{}
+	open.Open("i", NewCaptionStyle(false, italics))
+	open.Open("b", NewCaptionStyle(false, bold))
+	assert.Equal(t, []CaptionContent(nil), open.Close("u"))
+	// closing the outer tag closes the misnested inner one first
+	assert.Equal(t, []CaptionContent{NewCaptionStyle(false, bold), NewCaptionStyle(false, italics)}, open.Close("i"))
+	assert.Equal(t, []CaptionContent{}, open.CloseAll())
+
+	open.Open("i", NewCaptionStyle(false, italics))
+	assert.Equal(t, []CaptionContent{NewCaptionStyle(false, italics)}, open.CloseAll())
+}
+
+func TestMarkupStack(t *testing.T) {
+	open := MarkupStack{}
+	assert.Equal(t, "", open.Pop())
+	open.Push("</i>")
+	open.Push("</u></b>")
+	assert.Equal(t, "</u></b>", open.Pop())
+	open.Push("</font>")
+	assert.Equal(t, "</font></i>", open.PopAll())
+	assert.Equal(t, "", open.PopAll())
+}
@@ -0,0 +1,130 @@
+package caps
+
+import (
+	"strconv"
+)
+
+// DefaultRows is the number of lines of text assumed to fit in the height of the
+// video when converting line numbers to percentages, like the 15 rows of CEA-608.
+const DefaultRows = 15
+
+// Offset is a distance along an axis of the video, either a percentage of its size
+// or a number of lines. The zero value is unset, leaving it to the player.
+type Offset struct {
+	value   float64
+	percent bool
+	set     bool
+}
+
+// NewPercentOffset returns an offset of percent of the video size.
+func NewPercentOffset(percent float64) Offset {
+	return Offset{value: percent, percent: true, set: true}
+}
+
+// NewLineOffset returns an offset of n lines, counted from the end of the axis
+// when negative (-1 being the last line).
+func NewLineOffset(n int) Offset {
+	return Offset{value: float64(n), set: true}
+}
+
+func (o Offset) IsSet() bool {
+	return o.set
+}
+
+// IsPercent reports whether the offset is a percentage rather than a number of lines.
+func (o Offset) IsPercent() bool {
+	return o.percent
+}
+
+// Value returns the percentage or the number of lines.
+func (o Offset) Value() float64 {
+	return o.value
+}
+
+// String returns the offset as in WebVTT cue settings, e.g. "10%" or "-1",
+// or an empty string when unset.
+func (o Offset) String() string {
+	if !o.set {
+		return ""
+	}
+	if o.percent {
+		return strconv.FormatFloat(o.value, 'f', -1, 64) + "%"
+	}
+	return strconv.FormatFloat(o.value, 'f', -1, 64)
+}
+
+// Placement is where a caption is displayed on the video, modeled after WebVTT cue
+// settings. The zero value leaves it to the player, usually at the bottom center.
+type Placement struct {
+	// Vertical is the direction of vertical text, "rl" or "lr", empty for horizontal text.
+	Vertical string
+	// Line is the offset of the caption box on the block axis, from the top for
+	// horizontal text.
+	Line Offset
+	// LineAlign is the edge of the box placed at Line: "start", "center" or "end".
+	LineAlign string
+	// Position is the offset of the caption box on the inline axis, from the left
+	// for horizontal text. It's always a percentage.
+	Position Offset
+	// PositionAlign is the edge of the box placed at Position: "line-left", "center"
+	// or "line-right".
+	PositionAlign string
+	// Size is the size of the box on the inline axis, as a percentage.
+	Size Offset
+	// Align is the alignment of the text in the box: "start", "center", "end",
+	// "left" or "right".
+	Align string
+	// Region is the ID of the region of the CaptionSet holding the caption, if any.
+	Region string
+}
+
+// IsDefault reports whether the placement is left to the player.
+func (p Placement) IsDefault() bool {
+	return p == Placement{}
+}
+
+// Point is a position as percentages of the width and height of an area.
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Region is an area of the video holding captions, modeled after WebVTT regions.
+type Region struct {
+	ID string
+	// Width is the width of the region, as a percentage of the video width.
+	Width float64
+	// Lines is the height of the region, as a number of lines.
+	Lines int
+	// Height is the height of the region as a percentage of the video height, when
+	// known more precisely than Lines, as for TTML regions. Zero uses Lines.
+	Height float64
+	// RegionAnchor is the point of the region, as percentages of its size, placed
+	// at the ViewportAnchor point of the video.
+	RegionAnchor   Point
+	ViewportAnchor Point
+	// Scroll is true when new lines push the previous ones up, as for roll-up captions.
+	Scroll bool
+	// Align is the alignment of the text in the region, as Placement.Align, and
+	// DisplayAlign the alignment of the lines on the block axis: "before", "center"
+	// or "after". Empty, they're the center and the end of the region.
+	Align        string
+	DisplayAlign string
+	// Vertical is the direction of vertical text, as Placement.Vertical.
+	Vertical string
+	// Padding is the space between the edges of the region and its text, as TTML
+	// lengths, e.g. "1% 2%".
+	Padding string
+}
+
+// NewRegion returns a region with the WebVTT defaults: as wide as the video,
+// 3 lines high and anchored by its bottom left corner.
+func NewRegion(id string) Region {
+	return Region{
+		ID:             id,
+		Width:          100,
+		Lines:          3,
+		RegionAnchor:   Point{0, 100},
+		ViewportAnchor: Point{0, 100},
+	}
+}
@@ -0,0 +1,30 @@
+package caps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffset(t *testing.T) {
+	var unset Offset
+	assert.False(t, unset.IsSet())
+	assert.Equal(t, "", unset.String())
+	assert.Equal(t, "10%", NewPercentOffset(10).String())
+	assert.Equal(t, "33.5%", NewPercentOffset(33.5).String())
+	assert.True(t, NewPercentOffset(0).IsSet())
+	assert.Equal(t, "-1", NewLineOffset(-1).String())
+	assert.False(t, NewLineOffset(0).IsPercent())
+	assert.True(t, Placement{}.IsDefault())
+	assert.False(t, Placement{Line: NewLineOffset(0)}.IsDefault())
+}
+
+func TestRegions(t *testing.T) {
+	captionSet := NewCaptionSet()
+	captionSet.AddRegion(NewRegion("b"))
+	captionSet.AddRegion(NewRegion("a"))
+	regions := captionSet.GetRegions()
+	assert.Equal(t, 2, len(regions))
+	assert.Equal(t, "a", regions[0].ID)
+	assert.Equal(t, Region{ID: "b", Width: 100, Lines: 3, RegionAnchor: Point{0, 100}, ViewportAnchor: Point{0, 100}}, regions[1])
+}
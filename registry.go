@@ -0,0 +1,141 @@
+package caps
+
+import (
+	"fmt"
+	"sync"
+)
+
+// detectionPriority is the order formats are tried in by DetectFormat, from the most
+// to the least specific signature. Formats that are not listed here are tried
+// afterwards, in registration order.
+var detectionPriority = []string{"webvtt", "scc", "dfxp", "sami", "srt"}
+
+type format struct {
+	reader CaptionReader
+	writer CaptionWriter
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]format{}
+	// registered keeps the registration order of the formats
+	registered []string
+)
+
+// Register makes a caption format available by name for DetectFormat and ConvertAuto.
+// It's meant to be called from the init function of the format packages, so they
+// only need to be imported for their side effects, e.g. import _ "github.com/vimeo/caps/srt".
+// Either reader or writer may be nil for formats that can only be read or written.
+// Register panics if it's called twice for the same name.
+func Register(name string, reader CaptionReader, writer CaptionWriter) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if reader == nil && writer == nil {
+		panic("caps: Register reader and writer are nil for " + name)
+	}
+	if _, dup := formats[name]; dup {
+		panic("caps: Register called twice for format " + name)
+	}
+	formats[name] = format{reader, writer}
+	registered = append(registered, name)
+}
+
+// Formats returns the names of the registered formats, in detection order.
+func Formats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	return detectionOrder()
+}
+
+// detectionOrder must be called with formatsMu held.
+func detectionOrder() []string {
+	names := []string{}
+	for _, name := range detectionPriority {
+		if _, ok := formats[name]; ok {
+			names = append(names, name)
+		}
+	}
+	for _, name := range registered {
+		if !isPriority(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func isPriority(name string) bool {
+	for _, p := range detectionPriority {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetReader returns the reader registered for the format name.
+func GetReader(name string) (CaptionReader, error) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	f, ok := formats[name]
+	if !ok || f.reader == nil {
+		return nil, fmt.Errorf("no reader registered for format %q", name)
+	}
+	return f.reader, nil
+}
+
+// GetWriter returns the writer registered for the format name.
+func GetWriter(name string) (CaptionWriter, error) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	f, ok := formats[name]
+	if !ok || f.writer == nil {
+		return nil, fmt.Errorf("no writer registered for format %q", name)
+	}
+	return f.writer, nil
+}
+
+// DetectFormat returns the name of the first registered format, in detection order,
+// whose reader detects the content. The confidence is 1 when no other format
+// detected the content and is split evenly between every format that did
+// otherwise, e.g. 0.5 when two formats claimed it. An empty name and a zero
+// confidence are returned when no format was detected.
+func DetectFormat(content []byte) (string, float64) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	detected := []string{}
+	for _, name := range detectionOrder() {
+		if reader := formats[name].reader; reader != nil && reader.Detect(content) {
+			detected = append(detected, name)
+		}
+	}
+	if len(detected) == 0 {
+		return "", 0
+	}
+	return detected[0], 1 / float64(len(detected))
+}
+
+// ConvertAuto detects the encoding and the format of the input and converts it
+// to the target format.
+func ConvertAuto(input []byte, target string) ([]byte, error) {
+	input, _, err := DecodeInput(input)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := DetectFormat(input)
+	if name == "" {
+		return nil, fmt.Errorf("unable to detect caption format")
+	}
+	reader, err := GetReader(name)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := GetWriter(target)
+	if err != nil {
+		return nil, err
+	}
+	captionSet, err := reader.Read(input)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
+	}
+	return writer.Write(captionSet)
+}
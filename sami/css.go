@@ -0,0 +1,150 @@
+package sami
+
+import (
+	"strings"
+
+	"github.com/vimeo/caps"
+)
+
+// cssRule is a single "selector { property: value; ... }" rule of a SAMI STYLE block.
+type cssRule struct {
+	selector     string
+	declarations []cssDeclaration
+}
+
+type cssDeclaration struct {
+	property string
+	value    string
+}
+
+// classInfo is the SAMI specific metadata of a class, e.g. ".ENCC {Name: English; lang: en-US; SAMI_Type: CC;}".
+type classInfo struct {
+	Name     string
+	Lang     string
+	SAMIType string
+}
+
+// parseCSS parses the contents of STYLE blocks into rules. It only handles the
+// small subset of CSS SAMI files use: comments are dropped and rules with
+// several selectors ("P, .ENCC { ... }") are split into one rule per selector.
+func parseCSS(css string) []cssRule {
+	css = reCSSComment.ReplaceAllString(css, "")
+	css = strings.NewReplacer("<!--", "", "-->", "").Replace(css)
+	rules := []cssRule{}
+	for {
+		open := strings.Index(css, "{")
+		if open < 0 {
+			break
+		}
+		end := strings.Index(css[open:], "}")
+		if end < 0 {
+			end = len(css) - open
+		}
+		selectors := css[:open]
+		declarations := parseDeclarations(css[open+1 : open+end])
+		for _, selector := range strings.Split(selectors, ",") {
+			if selector = strings.TrimSpace(selector); selector != "" {
+				rules = append(rules, cssRule{selector, declarations})
+			}
+		}
+		if open+end+1 >= len(css) {
+			break
+		}
+		css = css[open+end+1:]
+	}
+	return rules
+}
+
+// parseDeclarations parses a "property: value; ..." list, as found in rules and style attributes.
+func parseDeclarations(block string) []cssDeclaration {
+	declarations := []cssDeclaration{}
+	for _, declaration := range strings.Split(block, ";") {
+		parts := strings.SplitN(declaration, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		property := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+		if property == "" || value == "" {
+			continue
+		}
+		declarations = append(declarations, cssDeclaration{property, value})
+	}
+	return declarations
+}
+
+// applyDeclarations sets the StyleProps fields matching the declarations,
+// returning the SAMI class metadata found among them.
+func applyDeclarations(style *caps.StyleProps, declarations []cssDeclaration) classInfo {
+	info := classInfo{}
+	for _, d := range declarations {
+		switch d.property {
+		case "text-align":
+			style.TextAlign = d.value
+		case "font-family":
+			style.FontFamily = d.value
+		case "font-size":
+			style.FontSize = d.value
+		case "color":
+			style.Color = d.value
+		case "font-style":
+			style.Italics = d.value == "italic"
+		case "font-weight":
+			style.Bold = d.value == "bold"
+		case "text-decoration":
+			style.Underline = d.value == "underline"
+		case "name":
+			info.Name = d.value
+		case "lang":
+			info.Lang = d.value
+		case "sami_type":
+			info.SAMIType = d.value
+		}
+	}
+	return info
+}
+
+// parseStyles turns the STYLE blocks into StyleProps keyed by selector and the
+// class metadata keyed by lowercased class name. The P rule is stored under "p"
+// with the "p" ID, "#id" rules under "#id" with their id and ".class" rules under
+// ".class" with the class name as both ID and Class, so a class and an id of the
+// same name are kept apart. Rules for the same selector are merged in order.
+func parseStyles(css string) (map[string]caps.StyleProps, map[string]classInfo) {
+	styles := map[string]caps.StyleProps{}
+	classes := map[string]classInfo{}
+	for _, rule := range parseCSS(css) {
+		var id, class string
+		key := rule.selector
+		switch {
+		case strings.HasPrefix(rule.selector, "#"):
+			id = rule.selector[1:]
+		case strings.HasPrefix(rule.selector, "."):
+			id = rule.selector[1:]
+			class = id
+		case strings.EqualFold(rule.selector, "p"):
+			id, key = "p", "p"
+		default:
+			continue
+		}
+		style, ok := styles[key]
+		if !ok {
+			style = caps.StyleProps{ID: id, Class: class}
+		}
+		info := applyDeclarations(&style, rule.declarations)
+		styles[key] = style
+		if class != "" {
+			previous := classes[strings.ToLower(class)]
+			if info.Name == "" {
+				info.Name = previous.Name
+			}
+			if info.Lang == "" {
+				info.Lang = previous.Lang
+			}
+			if info.SAMIType == "" {
+				info.SAMIType = previous.SAMIType
+			}
+			classes[strings.ToLower(class)] = info
+		}
+	}
+	return styles, classes
+}
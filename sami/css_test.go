@@ -0,0 +1,61 @@
+package sami
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vimeo/caps"
+)
+
+func TestParseCSS(t *testing.T) {
+	rules := parseCSS(`<!--
+    /* comment */
+    P, .ENCC { margin-left:  1pt; color: #ffeedd; }
+    #Big {Name:BigTxt; font-weight:bold}
+    -->`)
+	assert.Equal(t, []cssRule{
+		{"P", []cssDeclaration{{"margin-left", "1pt"}, {"color", "#ffeedd"}}},
+		{".ENCC", []cssDeclaration{{"margin-left", "1pt"}, {"color", "#ffeedd"}}},
+		{"#Big", []cssDeclaration{{"name", "BigTxt"}, {"font-weight", "bold"}}},
+	}, rules)
+}
+
+func TestParseStyles(t *testing.T) {
+	root, err := Parse(strings.NewReader(syntaxErrorSample))
+	assert.Nil(t, err)
+	styles, classes := parseStyles(styleText(root))
+	assert.Equal(t, map[string]caps.StyleProps{
+		"p": {
+			ID:         "p",
+			TextAlign:  "center",
+			FontFamily: "Arial",
+			FontSize:   "10pt",
+			Color:      "#ffffff",
+		},
+		"#Small": {
+			ID:         "Small",
+			FontFamily: "Arial",
+			FontSize:   "10pt",
+			Color:      "#ffffff",
+		},
+		"#Big": {
+			ID:         "Big",
+			FontFamily: "Arial",
+			FontSize:   "12pt",
+			Color:      "#ffffff",
+			Bold:       true,
+		},
+		".ENCC": {ID: "ENCC", Class: "ENCC"},
+	}, styles)
+	assert.Equal(t, map[string]classInfo{
+		"encc": {Name: "English", Lang: "en-US", SAMIType: "CC"},
+	}, classes)
+}
+
+func TestParseStylesMergesBlocks(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(sample1))
+	assert.Nil(t, err)
+	assert.Equal(t, []caps.StyleProps{{ID: "p", Color: "#ffeedd"}}, captionSet.GetStyles())
+	assert.Equal(t, "#ffeedd", captionSet.GetCaptions("en-US")[0].Style.Color)
+}
@@ -3,7 +3,9 @@ package sami
 import (
 	"io"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/vimeo/caps"
 	"golang.org/x/net/html"
 )
 
@@ -18,20 +20,40 @@ import (
 // they all end up messing with the resulting SAMI tree, which can lead to
 // weird/unexpected results, so this fixes that.
 //
-// The input is assumed to be UTF-8 encoded.
+// The input is assumed to be UTF-8 encoded, caps.DecodeInput transcodes the
+// content of files in other encodings.
+//
+// Errors reading the input are returned as a *caps.ParseError.
 func Parse(r io.Reader) (*html.Node, error) {
+	p, err := parseDocument(r)
+	if err != nil {
+		return nil, err
+	}
+	return p.root, nil
+}
+
+// parseDocument parses the document like Parse, keeping the position of the elements.
+func parseDocument(r io.Reader) (*parser, error) {
 	p := &parser{
 		tokenizer: html.NewTokenizer(r),
 		root: &html.Node{
 			Type: html.DocumentNode,
 		},
+		positions: map[*html.Node]position{},
+		next:      position{line: 1, column: 1},
 	}
 	// this is default value already, but lets force it anyways
 	p.tokenizer.AllowCDATA(false)
 	if err := p.parse(); err != nil {
 		return nil, err
 	}
-	return p.root, nil
+	return p, nil
+}
+
+// position is the 1-based line and column of a token in the document.
+type position struct {
+	line   int
+	column int
 }
 
 type parser struct {
@@ -43,6 +65,11 @@ type parser struct {
 	root *html.Node
 	// The stack of open elements
 	oe nodeStack
+	// positions holds the position of the start tag of each element
+	positions map[*html.Node]position
+	// current is the position of tok, next the one of the following token
+	current position
+	next    position
 }
 
 // top method returns the current open tag on the stack or the top most one(the root parent)
@@ -81,12 +108,14 @@ func (p *parser) addText(text string) {
 
 // addElement adds a child element based on the current token.
 func (p *parser) addElement() {
-	p.addChild(&html.Node{
+	n := &html.Node{
 		Type:     html.ElementNode,
 		DataAtom: p.tok.DataAtom,
 		Data:     p.tok.Data,
 		Attr:     p.tok.Attr,
-	})
+	}
+	p.positions[n] = p.current
+	p.addChild(n)
 }
 
 // parseCurrentToken runs the current token through the parsing routines
@@ -114,11 +143,12 @@ func (p *parser) parse() error {
 	var err error
 	for err != io.EOF {
 		p.tokenizer.Next()
+		p.advance(p.tokenizer.Raw())
 		p.tok = p.tokenizer.Token()
 		if p.tok.Type == html.ErrorToken {
 			err = p.tokenizer.Err()
 			if err != nil && err != io.EOF {
-				return err
+				return &caps.ParseError{Format: format, Line: p.current.line, Column: p.current.column, Code: caps.ErrCodeSyntax, Err: err}
 			}
 		}
 		p.parseCurrentToken()
@@ -126,6 +156,21 @@ func (p *parser) parse() error {
 	return nil
 }
 
+// advance moves the position past the raw text of the current token.
+func (p *parser) advance(raw []byte) {
+	p.current = p.next
+	for len(raw) > 0 {
+		r, size := utf8.DecodeRune(raw)
+		raw = raw[size:]
+		if r == '\n' {
+			p.next.line++
+			p.next.column = 1
+		} else {
+			p.next.column++
+		}
+	}
+}
+
 // nodeStack is a stack of nodes.
 type nodeStack []*html.Node
 
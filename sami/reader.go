@@ -0,0 +1,337 @@
+package sami
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/vimeo/caps"
+	"golang.org/x/net/html"
+)
+
+type Reader struct {
+	recovery caps.Recovery
+	warn     caps.WarningFunc
+}
+
+// syncBlock is the content of a single language inside a SYNC tag.
+type syncBlock struct {
+	start int64
+	nodes []caps.CaptionContent
+	style caps.StyleProps
+}
+
+func (Reader) Detect(content []byte) bool {
+	return bytes.Contains(bytes.ToLower(content), []byte("<sami"))
+}
+
+func (r Reader) Read(content []byte) (*caps.CaptionSet, error) {
+	return r.ReadStream(bytes.NewReader(content))
+}
+
+// ReadStream tokenizes the document as it's read from in.
+func (r Reader) ReadStream(in io.Reader) (*caps.CaptionSet, error) {
+	captionSet, warnings, err := r.read(in)
+	r.warn.Report(warnings)
+	return captionSet, err
+}
+
+// WithRecovery returns a copy of the reader skipping the SYNCs with an invalid start.
+func (r Reader) WithRecovery(recovery caps.Recovery, warn caps.WarningFunc) caps.CaptionReader {
+	r.recovery, r.warn = recovery, warn
+	return r
+}
+
+func (r Reader) read(in io.Reader) (*caps.CaptionSet, []caps.Warning, error) {
+	document, err := parseDocument(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := document.root
+	warnings := []caps.Warning{}
+	styles, classes := parseStyles(styleText(root))
+	pStyle := caps.DefaultStyleProps()
+	if style, ok := styles["p"]; ok {
+		pStyle = pStyle.Merge(style)
+		pStyle.ID = style.ID
+	}
+	// classStyles holds the class rules by lowercased class name, SAMI
+	// class names being case insensitive
+	classStyles := map[string]caps.StyleProps{}
+	for _, style := range styles {
+		if style.Class != "" {
+			classStyles[strings.ToLower(style.Class)] = style
+		}
+	}
+	blocks := map[string][]syncBlock{}
+	order := []string{}
+	for _, sync := range findElements(root, "sync") {
+		start, err := parseStart(sync, document.positions[sync])
+		if err != nil {
+			parseErr, ok := err.(*caps.ParseError)
+			if r.recovery == caps.Strict || !ok {
+				return nil, nil, err
+			}
+			warnings = append(warnings, caps.Warning{Err: parseErr, Action: caps.ActionSkipped})
+			continue
+		}
+		for _, p := range syncParagraphs(sync) {
+			lang := caps.DefaultLang
+			if info := classes[strings.ToLower(attr(p, "class"))]; info.Lang != "" {
+				lang = info.Lang
+			}
+			if _, ok := blocks[lang]; !ok {
+				order = append(order, lang)
+			}
+			blocks[lang] = append(blocks[lang], syncBlock{start, translateParagraph(p), paragraphStyle(p, pStyle, styles, classStyles)})
+		}
+	}
+	captionSet := caps.NewCaptionSet()
+	for _, style := range styles {
+		// the styles of the caption set are keyed by ID, the one of an id rule
+		// being referenced by the captions
+		if _, ok := styles["#"+style.Class]; ok && style.Class != "" {
+			style.ID = classStyleID(style.Class)
+		}
+		// classes that only carry SAMI metadata (e.g. the language) aren't styles
+		if style != (caps.StyleProps{ID: style.ID, Class: style.Class}) {
+			captionSet.AddStyle(style)
+		}
+		if info := classes[strings.ToLower(style.Class)]; style.Class != "" && info.Lang != "" {
+			captionSet.LanguageInfo[info.Lang] = caps.LanguageInfo{Name: info.Name, Class: style.Class, Type: info.SAMIType}
+		}
+	}
+	for _, lang := range order {
+		captions, timingWarnings := caps.RecoverTimings(format, toCaptions(blocks[lang]), nil, r.recovery)
+		warnings = append(warnings, timingWarnings...)
+		captionSet.SetCaptions(lang, captions)
+	}
+	if captionSet.IsEmpty() {
+		return nil, nil, caps.NewEmptyFileError(format)
+	}
+	return captionSet, warnings, nil
+}
+
+// paragraphStyle returns the style of a P tag: the P rule merged over the default
+// style, then the rule of its class and the one of its ID. The ID of the style is
+// the one of the P tag when it has a rule, and its class the one of the P tag.
+func paragraphStyle(p *html.Node, pStyle caps.StyleProps, styles, classStyles map[string]caps.StyleProps) caps.StyleProps {
+	style := pStyle
+	if class, ok := classStyles[strings.ToLower(attr(p, "class"))]; ok {
+		style = style.Merge(class)
+		style.Class = class.Class
+	}
+	if id, ok := styles["#"+attr(p, "id")]; ok {
+		style = style.Merge(id)
+		style.ID = id.ID
+	}
+	return style
+}
+
+// classStyleID returns the ID of the style of a class sharing its name with the
+// id of an other rule.
+func classStyleID(class string) string {
+	return class + "-class"
+}
+
+// toCaptions turns the SYNC blocks of a language into captions, the end of
+// each caption being the start of the following block.
+func toCaptions(blocks []syncBlock) []*caps.Caption {
+	captions := []*caps.Caption{}
+	for i, block := range blocks {
+		if len(block.nodes) == 0 {
+			continue
+		}
+		end := block.start + defaultDuration
+		if i+1 < len(blocks) {
+			end = blocks[i+1].start
+		}
+		c := caps.NewCaption(caps.NewTimestamp(block.start), caps.NewTimestamp(end), block.nodes, block.style)
+		captions = append(captions, &c)
+	}
+	return captions
+}
+
+// parseStart returns the start of the SYNC tag found at pos, in microseconds.
+func parseStart(sync *html.Node, pos position) (int64, error) {
+	value := strings.TrimSpace(attr(sync, "start"))
+	start, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, &caps.ParseError{Format: format, Line: pos.line, Column: pos.column, Snippet: fmt.Sprintf("Start=%q", value), Code: caps.ErrCodeTimestamp, Err: fmt.Errorf("invalid sync start")}
+	}
+	return start * microMilli, nil
+}
+
+// syncParagraphs returns the P tags that belong to a SYNC. Unclosed SYNC tags are
+// common in SAMI files, which makes the parser nest the following SYNC tags,
+// so those are skipped here as they are handled on their own.
+func syncParagraphs(sync *html.Node) []*html.Node {
+	paragraphs := []*html.Node{}
+	for child := sync.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || child.Data != "p" {
+			continue
+		}
+		paragraphs = append(paragraphs, child)
+	}
+	return paragraphs
+}
+
+func translateParagraph(p *html.Node) []caps.CaptionContent {
+	nodes := []caps.CaptionContent{}
+	for child := p.FirstChild; child != nil; child = child.NextSibling {
+		nodes = append(nodes, translateNode(child)...)
+	}
+	return trimNodes(nodes)
+}
+
+func translateNode(n *html.Node) []caps.CaptionContent {
+	switch n.Type {
+	case html.TextNode:
+		text := reWhitespace.ReplaceAllString(n.Data, " ")
+		if text == "" {
+			return nil
+		}
+		return []caps.CaptionContent{caps.NewCaptionText(text)}
+	case html.ElementNode:
+	default:
+		return nil
+	}
+	nodes := []caps.CaptionContent{}
+	switch n.Data {
+	case "br":
+		// an unclosed <br> ends up holding the rest of the line as its children
+		nodes = append(nodes, caps.NewLineBreak())
+	case "sync", "p":
+		return nil
+	}
+	style, isStyle := translateStyle(n)
+	if isStyle {
+		nodes = append(nodes, caps.NewCaptionStyle(true, style))
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		nodes = append(nodes, translateNode(child)...)
+	}
+	if isStyle {
+		nodes = append(nodes, caps.NewCaptionStyle(false, style))
+	}
+	return nodes
+}
+
+// translateStyle maps the inline tags and style attributes SAMI files use into StyleProps.
+func translateStyle(n *html.Node) (caps.StyleProps, bool) {
+	style := caps.StyleProps{}
+	isStyle := true
+	switch n.Data {
+	case "i":
+		style.Italics = true
+	case "b":
+		style.Bold = true
+	case "u":
+		style.Underline = true
+	case "font":
+		style.Color = attr(n, "color")
+		style.FontFamily = attr(n, "face")
+	case "span":
+		style.Class = attr(n, "class")
+	default:
+		isStyle = false
+	}
+	applyDeclarations(&style, parseDeclarations(attr(n, "style")))
+	if fontStyle := attr(n, "tts:fontstyle"); fontStyle != "" {
+		style.Italics = fontStyle == "italic"
+	}
+	return style, isStyle
+}
+
+// trimNodes removes the whitespace left around line breaks and at the edges of
+// a paragraph, dropping the paragraph content entirely when it has no text,
+// which is how SAMI files clear the screen (e.g. <P>&nbsp;</P>).
+func trimNodes(nodes []caps.CaptionContent) []caps.CaptionContent {
+	hasText := false
+	for _, node := range nodes {
+		if node.Text() && strings.TrimSpace(strings.ReplaceAll(node.Content(), "\u00a0", " ")) != "" {
+			hasText = true
+			break
+		}
+	}
+	if !hasText {
+		return []caps.CaptionContent{}
+	}
+	trimmed := []caps.CaptionContent{}
+	lineStart := true
+	for i, node := range nodes {
+		if !node.Text() {
+			if node.LineBreak() {
+				lineStart = true
+			}
+			trimmed = append(trimmed, node)
+			continue
+		}
+		text := node.Content()
+		if lineStart {
+			text = strings.TrimLeft(text, " ")
+		}
+		if lineEnd(nodes[i+1:]) {
+			text = strings.TrimRight(text, " ")
+		}
+		if text == "" {
+			continue
+		}
+		lineStart = false
+		trimmed = append(trimmed, caps.NewCaptionText(text))
+	}
+	return trimmed
+}
+
+// lineEnd reports whether there is no more text before the next line break.
+func lineEnd(nodes []caps.CaptionContent) bool {
+	for _, node := range nodes {
+		if node.LineBreak() {
+			return true
+		}
+		if node.Text() && node.Content() != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func styleText(root *html.Node) string {
+	var css strings.Builder
+	for _, style := range findElements(root, "style") {
+		for child := style.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == html.TextNode {
+				css.WriteString(child.Data)
+				css.WriteString("\n")
+			}
+		}
+	}
+	return css.String()
+}
+
+// findElements returns every element with the given tag name, in document order.
+func findElements(root *html.Node, tag string) []*html.Node {
+	found := []*html.Node{}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == tag {
+			found = append(found, n)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(root)
+	return found
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.ToLower(a.Key) == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,169 @@
+package sami
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vimeo/caps"
+)
+
+func TestSAMIDetection(t *testing.T) {
+	assert.True(t, NewReader().Detect([]byte(pycaptionSample)))
+	assert.True(t, NewReader().Detect([]byte(syntaxErrorSample)))
+	assert.False(t, NewReader().Detect([]byte("WEBVTT\n\n")))
+}
+
+func TestSAMICaptionLength(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(pycaptionSample))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"en-US"}, captionSet.Languages())
+	assert.Equal(t, 8, len(captionSet.GetCaptions("en-US")))
+}
+
+func TestSAMICaptions(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(pycaptionSample))
+	assert.Nil(t, err)
+	tests := []struct {
+		wantStart string
+		wantEnd   string
+		wantText  string
+	}{
+		{"00:00:09.209", "00:00:12.312", "( clock ticking )"},
+		{"00:00:14.848", "00:00:17.000", "MAN:\nWhen we think\nof \"E equals m c-squared\","},
+		{"00:00:17.000", "00:00:18.752", "we have this vision of Einstein"},
+		{"00:00:18.752", "00:00:20.887", "as an old, wrinkly man\nwith white hair."},
+		{"00:00:20.887", "00:00:26.760", "MAN 2:\nE equals m c-squared is\nnot about an old Einstein."},
+		{"00:00:26.760", "00:00:32.200", "MAN 2:\nIt's all about an eternal Einstein."},
+		{"00:00:32.200", "00:00:34.400", "<LAUGHING & WHOOPS!>"},
+		{"00:00:34.400", "00:00:38.400", "\nsome more text"},
+	}
+	captions := captionSet.GetCaptions("en-US")
+	for i, test := range tests {
+		assert.Equal(t, test.wantStart, captions[i].FormatStart())
+		assert.Equal(t, test.wantEnd, captions[i].FormatEnd())
+		assert.Equal(t, test.wantText, captions[i].Text())
+	}
+}
+
+func TestSAMIStyleNodes(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(ttsSample))
+	assert.Nil(t, err)
+	captions := captionSet.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, 1, len(captions))
+	nodes := captions[0].Nodes
+	assert.True(t, nodes[0].Style())
+	assert.True(t, nodes[0].(caps.CaptionStyle).Start)
+	assert.True(t, nodes[0].(caps.CaptionStyle).Props.Italics)
+	assert.Equal(t, "NOVA", nodes[1].Content())
+	assert.False(t, nodes[2].(caps.CaptionStyle).Start)
+	assert.Equal(t, "NOVA is a production\nof WGBH Boston.", captions[0].Text())
+}
+
+func TestSAMIUnclosedSyncs(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(syntaxErrorSample))
+	assert.Nil(t, err)
+	captions := captionSet.GetCaptions("en-US")
+	assert.Equal(t, 2, len(captions))
+	assert.Equal(t, ">>> PRESENTATION OF \"IDAHO\nREPORTS\" ON IDAHO PUBLIC", captions[0].Text())
+	assert.Equal(t, "00:00:05.905", captions[0].FormatStart())
+	assert.Equal(t, "00:00:07.073", captions[0].FormatEnd())
+}
+
+func TestSAMIMultipleLanguages(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(multiLangSample))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(captionSet.GetCaptions("en-US")))
+	assert.Equal(t, 1, len(captionSet.GetCaptions("fr-FR")))
+	french := captionSet.GetCaptions("fr-FR")[0]
+	assert.Equal(t, "Bonjour", french.Text())
+	assert.Equal(t, "00:00:03.000", french.FormatEnd())
+}
+
+func TestSAMIEmptyFile(t *testing.T) {
+	_, err := NewReader().Read([]byte(`<SAMI><BODY></BODY></SAMI>`))
+	assert.NotNil(t, err)
+}
+
+// failingReader is an io.Reader failing with err.
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestSAMIParseErrors(t *testing.T) {
+	_, err := NewReader().Read([]byte("<SAMI>\n<BODY>\n<SYNC Start=1000><P>Hello</P>\n  <SYNC Start=abc><P>World</P>\n</BODY>\n</SAMI>"))
+	var parseErr *caps.ParseError
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, caps.ErrCodeTimestamp, parseErr.Code)
+	assert.Equal(t, 4, parseErr.Line)
+	assert.Equal(t, 3, parseErr.Column)
+	assert.Equal(t, `Start="abc"`, parseErr.Snippet)
+
+	readErr := errors.New("connection reset")
+	_, err = Reader{}.ReadStream(failingReader{readErr})
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, caps.ErrCodeSyntax, parseErr.Code)
+	assert.True(t, errors.Is(err, readErr))
+}
+
+const multiLangSample = `<SAMI>
+<HEAD>
+<STYLE TYPE="text/css">
+<!--
+.ENUSCC {Name: English; lang: en-US; SAMI_Type: CC;}
+.FRFRCC {Name: French; lang: fr-FR; SAMI_Type: CC;}
+-->
+</STYLE>
+</HEAD>
+<BODY>
+<SYNC Start=1000><P Class=ENUSCC>Hello</P><P Class=FRFRCC>Bonjour</P></SYNC>
+<SYNC Start=3000><P Class=ENUSCC>World</P><P Class=FRFRCC>&nbsp;</P></SYNC>
+</BODY>
+</SAMI>`
+
+func TestSAMIClassStyles(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(`<SAMI><HEAD><STYLE TYPE="text/css"><!--
+P { margin-left: 1pt; }
+.ENCC {Name: English; lang: en-US; SAMI_Type: CC; color: yellow;}
+#Big {font-size: 12pt;}
+--></STYLE></HEAD>
+<BODY>
+<SYNC Start=1000><P Class=encc>Hello</P></SYNC>
+<SYNC Start=2000><P Class=ENCC ID=Big>World</P></SYNC>
+</BODY></SAMI>`))
+	assert.Nil(t, err)
+	captions := captionSet.GetCaptions("en-US")
+	assert.Equal(t, caps.StyleProps{ID: "p", Class: "ENCC", Color: "yellow", FontFamily: "monospace", FontSize: "1c"}, captions[0].Style)
+	assert.Equal(t, caps.StyleProps{ID: "Big", Class: "ENCC", Color: "yellow", FontFamily: "monospace", FontSize: "12pt"}, captions[1].Style)
+	assert.Equal(t, map[string]caps.LanguageInfo{"en-US": {Name: "English", Class: "ENCC", Type: "CC"}}, captionSet.LanguageInfo)
+
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), "#Big {font-size: 12pt;}\n.ENCC {color: yellow;}\n.ENCC {Name: English; lang: en-US; SAMI_Type: CC;}\n")
+	assert.Contains(t, string(result), `<P Class="ENCC" ID="Big">World</P>`)
+}
+
+func TestSAMIClassAndIDNames(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(`<SAMI><HEAD><STYLE TYPE="text/css"><!--
+.ENCC {Name: English; lang: en-US; SAMI_Type: CC;}
+.Big {color: yellow;}
+#Big {font-size: 12pt;}
+--></STYLE></HEAD>
+<BODY>
+<SYNC Start=1000><P Class=ENCC ID=Big>Hello</P></SYNC>
+<SYNC Start=2000><P Class=Big>World</P></SYNC>
+</BODY></SAMI>`))
+	assert.Nil(t, err)
+	assert.Equal(t, caps.StyleProps{ID: "Big", FontSize: "12pt"}, captionSet.Styles["Big"])
+	assert.Equal(t, caps.StyleProps{ID: "Big-class", Class: "Big", Color: "yellow"}, captionSet.Styles["Big-class"])
+	captions := captionSet.GetCaptions("en-US")
+	assert.Equal(t, "Big", captions[0].Style.ID)
+	assert.Equal(t, "12pt", captions[0].Style.FontSize)
+	assert.Equal(t, "white", captions[0].Style.Color)
+	assert.Equal(t, "Big", captions[1].Style.Class)
+	assert.Equal(t, "yellow", captions[1].Style.Color)
+}
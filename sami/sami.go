@@ -0,0 +1,32 @@
+package sami
+
+import (
+	"regexp"
+
+	"github.com/vimeo/caps"
+)
+
+const (
+	format = "sami"
+	// defaultDuration is used as the duration of the last caption of a language,
+	// since SAMI only has start times and the end of a caption is the start of the next SYNC.
+	defaultDuration int64 = 4000000
+	microMilli      int64 = 1000
+)
+
+var (
+	reCSSComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	reWhitespace = regexp.MustCompile(`[ \t\r\n\f]+`)
+)
+
+func init() {
+	caps.Register("sami", NewReader(), NewWriter())
+}
+
+func NewReader() caps.CaptionReader {
+	return Reader{}
+}
+
+func NewWriter() caps.CaptionWriter {
+	return Writer{}
+}
@@ -0,0 +1,308 @@
+package sami
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/vimeo/caps"
+	"golang.org/x/net/html"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+type Writer struct {
+	// encoding is the charset declared in the HEAD, none when empty
+	encoding string
+}
+
+// paragraph is a P tag of a single language inside a SYNC, an empty
+// content meaning a blank paragraph that clears the previous caption. id
+// references the "#id" style of the caption, if any.
+type paragraph struct {
+	class   string
+	id      string
+	content string
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	// cssRemover removes the characters ending a CSS value, its rule or the STYLE
+	// block from values
+	cssRemover = strings.NewReplacer("{", "", "}", "", ";", "", "<", "", ">", "")
+)
+
+func (w Writer) Write(captionSet *caps.CaptionSet) ([]byte, error) {
+	var output bytes.Buffer
+	err := w.WriteStream(&output, captionSet)
+	return output.Bytes(), err
+}
+
+// WriteStream writes the document to out. It doesn't stream the captions: those of
+// all languages are merged in memory into SYNCs by start time, which are then
+// written.
+func (w Writer) WriteStream(out io.Writer, captionSet *caps.CaptionSet) error {
+	output := bufio.NewWriter(out)
+	output.WriteString("<SAMI>\n<HEAD>\n")
+	if w.encoding != "" {
+		fmt.Fprintf(output, "<META HTTP-EQUIV=\"Content-Type\" CONTENT=\"text/html; charset=%s\">\n", w.encoding)
+	}
+	langs := captionSet.Languages()
+	sort.Strings(langs)
+	ids := idStyles(captionSet)
+	output.WriteString(writeStyles(captionSet, langs, ids))
+	output.WriteString("</HEAD>\n<BODY>\n")
+
+	syncs := map[int64][]paragraph{}
+	for _, lang := range langs {
+		class := langClass(captionSet, lang)
+		captions := captionSet.GetCaptions(lang)
+		for i, caption := range captions {
+			start := caption.Start.Milliseconds()
+			id := ""
+			if ids[caption.Style.ID] {
+				id = caption.Style.ID
+			}
+			syncs[start] = append(syncs[start], paragraph{class, id, writeNodes(caps.FlattenVoices(caption.Nodes))})
+			end := caption.End.Milliseconds()
+			if i+1 < len(captions) && captions[i+1].Start.Milliseconds() <= end {
+				continue
+			}
+			syncs[end] = append(syncs[end], paragraph{class: class})
+		}
+	}
+	times := []int64{}
+	for start := range syncs {
+		times = append(times, start)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	for _, start := range times {
+		fmt.Fprintf(output, "<SYNC Start=\"%d\">", start)
+		for _, p := range syncs[start] {
+			content := p.content
+			if content == "" {
+				content = "&nbsp;"
+			}
+			if p.id != "" {
+				fmt.Fprintf(output, "<P Class=\"%s\" ID=\"%s\">%s</P>", p.class, cssIdent(p.id), content)
+			} else {
+				fmt.Fprintf(output, "<P Class=\"%s\">%s</P>", p.class, content)
+			}
+		}
+		output.WriteString("</SYNC>\n")
+	}
+	output.WriteString("</BODY>\n</SAMI>\n")
+	return output.Flush()
+}
+
+// WithEncoding returns a copy of the writer declaring the named charset in a <META>
+// tag of the HEAD, for players that don't guess the encoding of the document.
+func (w Writer) WithEncoding(name string) caps.CaptionWriter {
+	w.encoding = name
+	return w
+}
+
+// langClass returns the class name used for the paragraphs of a language, the one
+// of its LanguageInfo or a generated one, e.g. en-US -> ENUSCC.
+func langClass(captionSet *caps.CaptionSet, lang string) string {
+	if info := captionSet.LanguageInfo[lang]; info.Class != "" {
+		return cssIdent(info.Class)
+	}
+	return cssIdent(strings.ToUpper(strings.ReplaceAll(lang, "-", "")) + "CC")
+}
+
+// idStyles returns the IDs of the styles written as "#id" rules: the styles
+// without a class referenced by captions, the paragraphs of which reference them.
+func idStyles(captionSet *caps.CaptionSet) map[string]bool {
+	ids := map[string]bool{}
+	for _, captions := range captionSet.Captions {
+		for _, caption := range captions {
+			id := caption.Style.ID
+			if style, ok := captionSet.Styles[id]; ok && style.Class == "" && !isPStyle(id) {
+				ids[id] = true
+			}
+		}
+	}
+	return ids
+}
+
+// isPStyle reports whether the style is written as the P rule.
+func isPStyle(id string) bool {
+	return strings.EqualFold(id, "p") || id == "default"
+}
+
+// langName returns the English name of the language, e.g. "American English" for
+// en-US, or an empty string when it's unknown.
+func langName(lang string) string {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return ""
+	}
+	return display.English.Tags().Name(tag)
+}
+
+// writeStyles returns the STYLE block: the P rule, the rules of the styles
+// referenced by paragraphs, through their ID or their language class, and the
+// metadata of the language classes.
+func writeStyles(captionSet *caps.CaptionSet, langs []string, ids map[string]bool) string {
+	output := bytes.NewBufferString("<STYLE TYPE=\"text/css\">\n<!--\n")
+	pStyle := "text-align: center;"
+	classes := map[string]bool{}
+	for _, lang := range langs {
+		classes[langClass(captionSet, lang)] = true
+	}
+	for _, style := range captionSet.GetStyles() {
+		if isPStyle(style.ID) {
+			if css := styleToCSS(style); css != "" {
+				pStyle = css
+			}
+		}
+	}
+	output.WriteString(fmt.Sprintf("P {%s}\n", pStyle))
+	for _, style := range captionSet.GetStyles() {
+		css := styleToCSS(style)
+		switch {
+		case css == "":
+		case style.Class != "" && classes[cssIdent(style.Class)]:
+			output.WriteString(fmt.Sprintf(".%s {%s}\n", cssIdent(style.Class), css))
+		case ids[style.ID]:
+			output.WriteString(fmt.Sprintf("#%s {%s}\n", cssIdent(style.ID), css))
+		}
+	}
+	for _, lang := range langs {
+		info := captionSet.LanguageInfo[lang]
+		if info.Name == "" {
+			info.Name = langName(lang)
+		}
+		if info.Type == "" {
+			info.Type = "CC"
+		}
+		name := ""
+		if info.Name != "" {
+			name = fmt.Sprintf("Name: %s; ", cssValue(info.Name))
+		}
+		output.WriteString(fmt.Sprintf(".%s {%slang: %s; SAMI_Type: %s;}\n", langClass(captionSet, lang), name, cssValue(lang), cssValue(info.Type)))
+	}
+	output.WriteString("-->\n</STYLE>\n")
+	return output.String()
+}
+
+// cssIdent returns the name as a CSS identifier, for classes and ids: characters
+// other than letters, digits, "-" and "_" are replaced with "_", as is a leading
+// digit.
+func cssIdent(name string) string {
+	ident := []rune(name)
+	for i, r := range ident {
+		valid := unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_'
+		if !valid || (i == 0 && unicode.IsDigit(r)) {
+			ident[i] = '_'
+		}
+	}
+	return string(ident)
+}
+
+// cssValue returns the value without the characters that would end its
+// declaration, its rule or the STYLE block.
+func cssValue(value string) string {
+	return strings.TrimSpace(cssRemover.Replace(value))
+}
+
+func styleToCSS(style caps.StyleProps) string {
+	declarations := []string{}
+	add := func(property, value string) {
+		if value = cssValue(value); value != "" {
+			declarations = append(declarations, fmt.Sprintf("%s: %s;", property, value))
+		}
+	}
+	add("text-align", style.TextAlign)
+	add("font-family", style.FontFamily)
+	add("font-size", style.FontSize)
+	add("color", style.Color)
+	if style.Italics {
+		add("font-style", "italic")
+	}
+	if style.Bold {
+		add("font-weight", "bold")
+	}
+	if style.Underline {
+		add("text-decoration", "underline")
+	}
+	return strings.Join(declarations, " ")
+}
+
+// writeNodes renders the caption nodes as SAMI markup, style nodes opening the
+// span, font and i, b, u tags their properties need.
+func writeNodes(nodes []caps.CaptionContent) string {
+	content := bytes.NewBufferString("")
+	open := caps.MarkupStack{}
+	for _, node := range nodes {
+		switch {
+		case node.Text():
+			content.WriteString(textEscaper.Replace(node.Content()))
+		case node.LineBreak():
+			content.WriteString("<br/>")
+		case node.Style():
+			style := node.(caps.CaptionStyle)
+			if style.Start {
+				tags, markup := openTags(style.Props)
+				content.WriteString(markup)
+				open.Push(closeTags(tags))
+			} else {
+				content.WriteString(open.Pop())
+			}
+		}
+	}
+	content.WriteString(open.PopAll())
+	return content.String()
+}
+
+func openTags(style caps.StyleProps) ([]string, string) {
+	tags := []string{}
+	markup := bytes.NewBufferString("")
+	if style.TextAlign != "" {
+		tags = append(tags, "span")
+		markup.WriteString(fmt.Sprintf("<span style=\"text-align:%s;\">", html.EscapeString(cssValue(style.TextAlign))))
+	}
+	// the default color and font are left to the P style
+	defaults := caps.DefaultStyleProps()
+	color, face := style.Color, style.FontFamily
+	if color == defaults.Color {
+		color = ""
+	}
+	if face == defaults.FontFamily {
+		face = ""
+	}
+	if color != "" || face != "" {
+		tags = append(tags, "font")
+		markup.WriteString("<font")
+		if color != "" {
+			markup.WriteString(fmt.Sprintf(" color=\"%s\"", html.EscapeString(color)))
+		}
+		if face != "" {
+			markup.WriteString(fmt.Sprintf(" face=\"%s\"", html.EscapeString(face)))
+		}
+		markup.WriteString(">")
+	}
+	for _, tag := range []struct {
+		name    string
+		enabled bool
+	}{{"i", style.Italics}, {"b", style.Bold}, {"u", style.Underline}} {
+		if tag.enabled {
+			tags = append(tags, tag.name)
+			markup.WriteString(fmt.Sprintf("<%s>", tag.name))
+		}
+	}
+	return tags, markup.String()
+}
+
+func closeTags(tags []string) string {
+	markup := bytes.NewBufferString("")
+	for i := len(tags) - 1; i >= 0; i-- {
+		markup.WriteString(fmt.Sprintf("</%s>", tags[i]))
+	}
+	return markup.String()
+}
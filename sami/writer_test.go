@@ -0,0 +1,128 @@
+package sami
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vimeo/caps"
+)
+
+func TestSAMItoSAMI(t *testing.T) {
+	captionSet, err := NewReader().Read([]byte(pycaptionSample))
+	assert.Nil(t, err)
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	roundTrip, err := NewReader().Read(result)
+	assert.Nil(t, err)
+	want := captionSet.GetCaptions("en-US")
+	got := roundTrip.GetCaptions("en-US")
+	assert.Equal(t, len(want), len(got))
+	for i := range want {
+		assert.Equal(t, want[i].String(), got[i].String())
+	}
+}
+
+func TestSAMIWriterEncoding(t *testing.T) {
+	captionSet := caps.NewCaptionSet()
+	captionSet.SetCaptions("en-US", []*caps.Caption{
+		newCaption(1000000, 2000000, caps.NewCaptionText("café")),
+	})
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(result), "<META")
+
+	writer, err := caps.NewEncodedWriter(NewWriter(), "latin1", false)
+	assert.Nil(t, err)
+	result, err = writer.Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), "<HEAD>\n<META HTTP-EQUIV=\"Content-Type\" CONTENT=\"text/html; charset=windows-1252\">\n")
+	assert.Contains(t, string(result), "caf\xe9")
+	assert.Equal(t, caps.EncodingWindows1252, caps.DetectEncoding(result))
+
+	content, _, err := caps.DecodeInput(result)
+	assert.Nil(t, err)
+	roundTrip, err := NewReader().Read(content)
+	assert.Nil(t, err)
+	assert.Equal(t, "café", roundTrip.GetCaptions("en-US")[0].Text())
+}
+
+func TestSAMIWriter(t *testing.T) {
+	captionSet := caps.NewCaptionSet()
+	captionSet.AddStyle(caps.StyleProps{ID: "p", TextAlign: "center", Color: "#ffeedd"})
+	italics := caps.StyleProps{Italics: true}
+	captionSet.SetCaptions("en-US", []*caps.Caption{
+		newCaption(1000000, 2000000,
+			caps.NewCaptionStyle(true, italics),
+			caps.NewCaptionText("Hello"),
+			caps.NewCaptionStyle(false, italics),
+			caps.NewLineBreak(),
+			caps.NewCaptionText("<world>"),
+		),
+		newCaption(3000000, 4000000, caps.NewCaptionText("again")),
+	})
+	captionSet.SetCaptions("fr-FR", []*caps.Caption{
+		newCaption(1000000, 4000000, caps.NewCaptionStyle(true, caps.StyleProps{Color: "yellow", Bold: true}), caps.NewCaptionText("Bonjour")),
+	})
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, `<SAMI>
+<HEAD>
+<STYLE TYPE="text/css">
+<!--
+P {text-align: center; color: #ffeedd;}
+.ENUSCC {Name: American English; lang: en-US; SAMI_Type: CC;}
+.FRFRCC {Name: French (France); lang: fr-FR; SAMI_Type: CC;}
+-->
+</STYLE>
+</HEAD>
+<BODY>
+<SYNC Start="1000"><P Class="ENUSCC"><i>Hello</i><br/>&lt;world&gt;</P><P Class="FRFRCC"><font color="yellow"><b>Bonjour</b></font></P></SYNC>
+<SYNC Start="2000"><P Class="ENUSCC">&nbsp;</P></SYNC>
+<SYNC Start="3000"><P Class="ENUSCC">again</P></SYNC>
+<SYNC Start="4000"><P Class="ENUSCC">&nbsp;</P><P Class="FRFRCC">&nbsp;</P></SYNC>
+</BODY>
+</SAMI>
+`, string(result))
+}
+
+// test helpers
+func newCaption(start, end int64, nodes ...caps.CaptionContent) *caps.Caption {
+	c := caps.NewCaption(caps.NewTimestamp(start), caps.NewTimestamp(end), nodes, caps.DefaultStyleProps())
+	return &c
+}
+
+func TestSAMIWriterIDStyles(t *testing.T) {
+	captionSet := caps.NewCaptionSet()
+	captionSet.AddStyle(caps.StyleProps{ID: "Big", FontSize: "12pt"})
+	captionSet.AddStyle(caps.StyleProps{ID: "unused", Color: "red"})
+	big := newCaption(1000000, 2000000, caps.NewCaptionText("big"))
+	big.Style.ID = "Big"
+	captionSet.SetCaptions("xx-unknown", []*caps.Caption{big})
+
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), "P {text-align: center;}\n#Big {font-size: 12pt;}\n.XXUNKNOWNCC {lang: xx-unknown; SAMI_Type: CC;}\n")
+	assert.NotContains(t, string(result), "unused")
+	assert.Contains(t, string(result), `<P Class="XXUNKNOWNCC" ID="Big">big</P>`)
+}
+
+func TestSAMIWriterEscaping(t *testing.T) {
+	captionSet := caps.NewCaptionSet()
+	captionSet.AddStyle(caps.StyleProps{ID: "a\"b", FontFamily: "Times}</STYLE>"})
+	captionSet.LanguageInfo["en-US"] = caps.LanguageInfo{Name: "English; color: red", Class: "EN\"CC"}
+	face := caps.StyleProps{FontFamily: `Times "New" <Roman>`, Color: "#fff\">"}
+	caption := newCaption(1000000, 2000000, caps.NewCaptionStyle(true, face), caps.NewCaptionText("hi"), caps.NewCaptionStyle(false, face))
+	caption.Style.ID = "a\"b"
+	captionSet.SetCaptions("en-US", []*caps.Caption{caption})
+
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), "#a_b {font-family: Times/STYLE;}\n.EN_CC {Name: English color: red; lang: en-US; SAMI_Type: CC;}\n")
+	assert.Contains(t, string(result), `<P Class="EN_CC" ID="a_b"><font color="#fff&#34;&gt;" face="Times &#34;New&#34; &lt;Roman&gt;">hi</font></P>`)
+
+	roundTrip, err := NewReader().Read(result)
+	assert.Nil(t, err)
+	captions := roundTrip.GetCaptions("en-US")
+	assert.Equal(t, "hi", captions[0].Text())
+	assert.Equal(t, "a_b", captions[0].Style.ID)
+}
@@ -1,12 +1,17 @@
 package scc
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/vimeo/caps"
+	"github.com/vimeo/caps/timecode"
 )
 
 type Reader struct {
@@ -17,8 +22,8 @@ type Reader struct {
 	lastCommand      string
 	rollRows         []string
 	rollRowsExpected int
-	paintTime        float64
-	popTime          float64
+	paintTime        caps.Timestamp
+	popTime          caps.Timestamp
 	popOn            bool
 	paintOn          bool
 	simulateRollUp   bool
@@ -26,51 +31,155 @@ type Reader struct {
 	firstElement     bool
 	frameCount       int
 	offset           int
+	// rows of the first and last PACs of the pop-on buffer
+	popFirstRow int
+	popLastRow  int
+	// lenient mode
+	recovery     caps.Recovery
+	warn         caps.WarningFunc
+	warnings     []caps.Warning
+	lineNumber   int
+	captionLines []int
+	// timeLine is the line number of time
+	timeLine int
 }
 
+// lastCaptionDuration is the duration of a caption left on screen by the last line of a file.
+const lastCaptionDuration = 4 * time.Second
+
 var timestampWords = regexp.MustCompile(`([0-9:;]*)([\s\t]*)((.)*)`)
 
 func (Reader) Detect(content []byte) bool {
 	return strings.HasPrefix(strings.TrimLeft(string(content), " "), header)
 }
 
+// Read decodes the content on a fresh copy of the reader, so a Reader can be reused
+// and shared (e.g. through caps.Register) without leaking state between files.
 func (r *Reader) Read(content []byte) (*caps.CaptionSet, error) {
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines[1:] {
-		r.translateLine(line)
+	return r.ReadStream(bytes.NewReader(content))
+}
+
+// ReadStream decodes the content line by line, on a fresh copy of the reader like Read.
+func (r *Reader) ReadStream(in io.Reader) (*caps.CaptionSet, error) {
+	captionSet, warnings, err := r.fresh().read(in)
+	r.warn.Report(warnings)
+	return captionSet, err
+}
+
+// WithRecovery returns a copy of the reader skipping the lines with invalid timecodes.
+func (r *Reader) WithRecovery(recovery caps.Recovery, warn caps.WarningFunc) caps.CaptionReader {
+	return &Reader{
+		simulateRollUp: r.simulateRollUp,
+		offset:         r.offset,
+		recovery:       recovery,
+		warn:           warn,
+	}
+}
+
+// fresh returns a copy of the reader without state.
+func (r *Reader) fresh() *Reader {
+	return &Reader{
+		simulateRollUp: r.simulateRollUp,
+		offset:         r.offset,
+		recovery:       r.recovery,
+		warnings:       []caps.Warning{},
+	}
+}
+
+func (r *Reader) read(in io.Reader) (*caps.CaptionSet, []caps.Warning, error) {
+	scanner := bufio.NewScanner(in)
+	// skip the header
+	scanner.Scan()
+	r.lineNumber = 1
+	for scanner.Scan() {
+		r.lineNumber++
+		if err := r.translateLine(scanner.Text(), r.lineNumber); err != nil {
+			if err := r.recover(err); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
 	}
 	if r.paintBuffer != "" {
-		r.rollUp()
+		if err := r.rollUp(); err != nil {
+			if err := r.recover(timecodeError(r.lineNumber, r.time, err)); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if r.recovery != caps.Strict {
+		r.closeLastCaption()
 	}
+	captions, warnings := caps.RecoverTimings(format, r.scc, r.captionLines, r.recovery)
 	set := caps.NewCaptionSet()
-	set.SetCaptions(caps.DefaultLang, r.scc)
+	set.SetCaptions(caps.DefaultLang, captions)
 	if set.IsEmpty() {
-		return set, fmt.Errorf("empty caption file")
+		return nil, nil, caps.NewEmptyFileError(format)
 	}
-	return set, nil
+	return set, append(r.warnings, warnings...), nil
 }
 
-func (r *Reader) translateLine(line string) {
-	if strings.Trim(line, " ") == "" {
+// closeLastCaption ends the last caption after the last word of the input when
+// the file ends without clearing it with a 942c, or after lastCaptionDuration
+// when it's displayed by the last line.
+func (r *Reader) closeLastCaption() {
+	if len(r.scc) == 0 || r.scc[len(r.scc)-1].End.IsSet() {
 		return
 	}
+	caption := r.scc[len(r.scc)-1]
+	end, err := r.translateCurrentTime()
+	if err != nil || r.timeLine == r.captionLines[len(r.captionLines)-1] || !end.After(caption.Start) {
+		end = caption.Start.Add(lastCaptionDuration)
+	}
+	caption.End = end
+	parseErr := &caps.ParseError{Format: format, Line: r.lineNumber, Column: 1, Snippet: r.time, Code: caps.ErrCodeTiming, Err: fmt.Errorf("caption not cleared before the end of the input")}
+	r.warnings = append(r.warnings, caps.Warning{Err: parseErr, Action: caps.ActionClamped})
+}
+
+// recover records a warning for the rest of a line skipped because of err,
+// or returns err in strict mode.
+func (r *Reader) recover(err error) error {
+	parseErr, ok := err.(*caps.ParseError)
+	if r.recovery == caps.Strict || !ok {
+		return err
+	}
+	r.warnings = append(r.warnings, caps.Warning{Err: parseErr, Action: caps.ActionSkipped})
+	return nil
+}
+
+func (r *Reader) translateLine(line string, lineNumber int) error {
+	if strings.Trim(line, " ") == "" {
+		return nil
+	}
 	parts := timestampWords.FindAllStringSubmatch(strings.ToLower(line), -1)
 	if len(parts) == 0 {
-		return
+		return nil
 	}
 	r.time = string(parts[0][1])
+	r.timeLine = lineNumber
 	r.frameCount = 0
 	for _, word := range strings.Split(parts[0][3], " ") {
-		if word != "" {
-			r.translateWord(word)
+		if word == "" {
+			continue
+		}
+		if err := r.translateWord(word); err != nil {
+			return timecodeError(lineNumber, strings.Fields(line)[0], err)
 		}
 	}
+	return nil
+}
+
+// timecodeError returns the ParseError for the invalid timecode of a line.
+func timecodeError(lineNumber int, stamp string, err error) error {
+	return &caps.ParseError{Format: format, Line: lineNumber, Column: 1, Snippet: stamp, Code: caps.ErrCodeTimestamp, Err: err}
 }
 
-func (r *Reader) translateWord(word string) {
+func (r *Reader) translateWord(word string) error {
 	r.frameCount += 1
 	if _, ok := commands[word]; ok {
-		r.translateCommand(word)
+		return r.translateCommand(word)
 	} else if _, ok := specialChars[word]; ok {
 		r.translateSpecialChar(word)
 	} else if _, ok := extendedChars[word]; ok {
@@ -78,6 +187,7 @@ func (r *Reader) translateWord(word string) {
 	} else {
 		r.translateCharacters(word)
 	}
+	return nil
 }
 
 func (r *Reader) translateExtendedChar(word string) {
@@ -154,7 +264,7 @@ func (r *Reader) translateCommand(word string) error {
 			r.rollRowsExpected = 4
 		}
 		if r.paintBuffer != "" {
-			r.convertToCaption(r.paintBuffer, r.paintTime)
+			r.convertToCaption(r.paintBuffer, r.paintTime, caps.Placement{})
 			r.paintBuffer = ""
 		}
 		r.rollRows = []string{}
@@ -165,40 +275,101 @@ func (r *Reader) translateCommand(word string) error {
 		r.paintTime = paintTime
 	} else if word == "94ae" {
 		r.popBuffer = ""
+		r.popFirstRow, r.popLastRow = 0, 0
 	} else if word == "942f" && r.popBuffer != "" {
 		popTime, err := r.translateCurrentTime()
 		if err != nil {
 			return err
 		}
 		r.popTime = popTime
-		r.convertToCaption(r.popBuffer, r.popTime)
+		r.convertToCaption(r.popBuffer, r.popTime, popPlacement(r.popFirstRow, r.popLastRow))
 		r.popBuffer = ""
+		r.popFirstRow, r.popLastRow = 0, 0
 	} else if word == "94ad" {
 		if r.paintBuffer != "" {
-			r.rollUp()
+			return r.rollUp()
 		}
 	} else if word == "942c" {
 		r.rollRows = []string{}
 		if r.paintBuffer != "" {
-			r.rollUp()
+			if err := r.rollUp(); err != nil {
+				return err
+			}
 		}
-		if len(r.scc) > 0 && *r.scc[len(r.scc)-1].End == 0 {
+		if len(r.scc) > 0 && !r.scc[len(r.scc)-1].End.IsSet() {
 			lastTime, err := r.translateCurrentTime()
 			if err != nil {
 				return err
 			}
-			r.scc[len(r.scc)-1].End = &lastTime
+			r.scc[len(r.scc)-1].End = lastTime
 		}
 	} else {
 		if r.paintOn {
 			r.paintBuffer += commands[word]
 			return nil
 		}
+		if row := pacRow(word); row > 0 {
+			if r.popFirstRow == 0 {
+				r.popFirstRow = row
+			}
+			r.popLastRow = row
+		}
 		r.popBuffer += commands[word]
 	}
 	return nil
 }
 
+// popPlacement returns the placement of a pop-on caption displayed from the first
+// to the last row, the default one for captions ending on the bottom row.
+func popPlacement(first, last int) caps.Placement {
+	if first == 0 || last == rows {
+		return caps.Placement{}
+	}
+	return caps.Placement{Line: caps.NewLineOffset(first - 1)}
+}
+
+// pacRow returns the row set by a preamble address code (PAC) of the first channel,
+// or 0 when the word isn't one.
+func pacRow(word string) int {
+	if len(word) != 4 {
+		return 0
+	}
+	code, err := strconv.ParseUint(word, 16, 16)
+	if err != nil {
+		return 0
+	}
+	// drop the parity bits
+	high, low := (code>>8)&0x7f, code&0x7f
+	if low < 0x40 {
+		return 0
+	}
+	second := 0
+	if low >= 0x60 {
+		second = 1
+	}
+	switch high {
+	case 0x11:
+		return 1 + second
+	case 0x12:
+		return 3 + second
+	case 0x15:
+		return 5 + second
+	case 0x16:
+		return 7 + second
+	case 0x17:
+		return 9 + second
+	case 0x10:
+		if second == 0 {
+			return 11
+		}
+	case 0x13:
+		return 12 + second
+	case 0x14:
+		return 14 + second
+	}
+	return 0
+}
+
 func (r *Reader) rollUp() error {
 	if !r.simulateRollUp {
 		r.rollRows = []string{}
@@ -208,7 +379,7 @@ func (r *Reader) rollUp() error {
 	}
 	r.rollRows = append(r.rollRows, r.paintBuffer)
 	r.paintBuffer = strings.Join(r.rollRows, " ")
-	r.convertToCaption(r.paintBuffer, r.paintTime)
+	r.convertToCaption(r.paintBuffer, r.paintTime, caps.Placement{})
 	r.paintBuffer = ""
 	paintTime, err := r.translateCurrentTime()
 	if err != nil {
@@ -218,7 +389,7 @@ func (r *Reader) rollUp() error {
 	if len(r.scc) == 0 {
 		return nil
 	}
-	r.scc[len(r.scc)-1].End = &r.paintTime
+	r.scc[len(r.scc)-1].End = r.paintTime
 	return nil
 }
 
@@ -231,14 +402,13 @@ func (r *Reader) handleDoubleCommand(word string) bool {
 	return false
 }
 
-func (r *Reader) convertToCaption(buffer string, start float64) {
-	if len(r.scc) > 0 && *r.scc[len(r.scc)-1].End == 0 {
+func (r *Reader) convertToCaption(buffer string, start caps.Timestamp, placement caps.Placement) {
+	if len(r.scc) > 0 && !r.scc[len(r.scc)-1].End.IsSet() {
 		r.scc[len(r.scc)-1].End = r.scc[len(r.scc)-1].Start
 	}
 	r.openItalic = false
 	r.firstElement = true
-	end := float64(0)
-	caption := &caps.Caption{Start: &start, End: &end}
+	caption := &caps.Caption{Start: start, Placement: placement}
 	for _, element := range strings.Split(buffer, "<$>") {
 		if strings.Trim(element, " ") == "" {
 			continue
@@ -270,6 +440,7 @@ func (r *Reader) convertToCaption(buffer string, start float64) {
 	r.removeExtraItalics(caption)
 	if len(caption.Nodes) > 0 {
 		r.scc = append(r.scc, caption)
+		r.captionLines = append(r.captionLines, r.lineNumber)
 	}
 }
 
@@ -287,63 +458,44 @@ func (r *Reader) translateBreak(caption *caps.Caption) {
 	caption.Nodes = append(caption.Nodes, caps.NewLineBreak())
 }
 
+// removeExtraItalics merges the italics closed before a line break and opened
+// again after it, since PACs starting rows reset the style.
 func (r *Reader) removeExtraItalics(caption *caps.Caption) {
-	i := 0
-	length := len(caption.Nodes)
-	if length < 0 {
-		length = 0
-	}
-	for i < length {
-		if caption.Nodes[i].Style() && caption.Nodes[i+1].LineBreak() && caption.Nodes[i+2].Style() {
-			style := caption.Nodes[i].(caps.CaptionStyle)
-			style2 := caption.Nodes[i+2].(caps.CaptionStyle)
-			if style.Props.Italics && style2.Props.Italics {
-				caption.Nodes[i] = caption.Nodes[len(caption.Nodes)-1]
-				caption.Nodes[i+1] = caption.Nodes[len(caption.Nodes)-2]
-				caption.Nodes = caption.Nodes[:len(caption.Nodes)-2]
+	nodes := []caps.CaptionContent{}
+	for i := 0; i < len(caption.Nodes); i++ {
+		if i+2 < len(caption.Nodes) && caption.Nodes[i+1].LineBreak() {
+			end, isEnd := caption.Nodes[i].(caps.CaptionStyle)
+			start, isStart := caption.Nodes[i+2].(caps.CaptionStyle)
+			if isEnd && isStart && !end.Start && start.Start && end.Props.Italics && start.Props.Italics {
+				nodes = append(nodes, caption.Nodes[i+1])
+				i += 2
+				continue
 			}
-			length -= 2
 		}
-		i += 1
+		nodes = append(nodes, caption.Nodes[i])
 	}
+	caption.Nodes = nodes
 }
 
-func (r *Reader) translateCurrentTime() (float64, error) {
-	n, err := strconv.Atoi(r.time[len(r.time)-2:])
+// translateCurrentTime returns the time of the word being read, which is one frame
+// after the previous word of the line. Timecodes using ';' are drop-frame,
+// all others are non-drop-frame, both at 29.97fps.
+func (r *Reader) translateCurrentTime() (caps.Timestamp, error) {
+	rate := timecode.Rate2997NDF
+	if strings.Contains(r.time, ";") {
+		rate = timecode.Rate2997DF
+	}
+	tc, err := timecode.Parse(r.time, rate)
 	if err != nil {
-		return 0, err
+		return caps.Timestamp{}, err
 	}
-	currStamp := fmt.Sprintf("%s%d", r.time[:len(r.time)-2], n+r.frameCount)
-	secondsPerTimestampSecond := 1001.0 / 1000.0
-	if strings.Contains(currStamp, ";") {
-		secondsPerTimestampSecond = 1.0
+	// the offset is stored in microseconds (NewReader takes seconds, e.g. 3600 for
+	// captions starting at 01:00:00:00) and is removed as whole timecode seconds
+	seconds := int64(r.offset) / 1000000
+	offset := timecode.Timecode{Hours: seconds / 3600, Minutes: seconds / 60 % 60, Seconds: seconds % 60, Rate: rate}
+	frames := tc.FrameNumber() + int64(r.frameCount) - offset.FrameNumber()
+	if frames < 0 {
+		return caps.NewTimestamp(0), nil
 	}
-	timesplit := strings.Split(strings.ReplaceAll(strings.Trim(currStamp, " "), ";", ":"), ":")
-	t0, err := strconv.ParseFloat(timesplit[0], 64)
-	if err != nil {
-		return 0, err
-	}
-	t1, err := strconv.ParseFloat(timesplit[1], 64)
-	if err != nil {
-		return 0, err
-	}
-	t2, err := strconv.ParseFloat(timesplit[2], 64)
-	if err != nil {
-		return 0, err
-	}
-	t3, err := strconv.ParseFloat(timesplit[3], 64)
-	if err != nil {
-		return 0, err
-	}
-	timestampSeconds := float64(t0*3600 +
-		t1*60 +
-		t2 +
-		t3/30.0)
-	microseconds := timestampSeconds * 1000.0 * 1000.0
-	microseconds -= float64(r.offset)
-	microseconds *= secondsPerTimestampSecond
-	if microseconds < 0 {
-		return 0, nil
-	}
-	return microseconds, nil
+	return caps.NewTimestamp(rate.FramesToMicroseconds(frames)), nil
 }
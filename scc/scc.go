@@ -1,6 +1,15 @@
 package scc
 
-import "github.com/vimeo/caps"
+import (
+	"time"
+
+	"github.com/vimeo/caps"
+	"github.com/vimeo/caps/timecode"
+)
+
+func init() {
+	caps.Register("scc", DefaultReader(), NewWriter())
+}
 
 func DefaultReader() caps.CaptionReader {
 	return &Reader{
@@ -20,6 +29,11 @@ func NewWriter() caps.CaptionWriter {
 	return &Writer{}
 }
 
+// NewDropFrameWriter returns a writer that emits drop-frame timecodes.
+func NewDropFrameWriter() caps.CaptionWriter {
+	return &Writer{dropFrame: true}
+}
+
 var commands = map[string]string{
 	"9420":  "",
 	"9429":  "",
@@ -855,6 +869,9 @@ var extendedChars = map[string]string{
 }
 
 // Cursor positioning codes
+// rows is the number of rows of text, numbered from 1 at the top.
+const rows = 15
+
 var pacHighByteByRow = []string{"xx", "91", "91", "92", "92", "15", "15", "16", "16", "97", "97", "10", "13", "13", "94", "94"}
 var pacLowByteByRow = []string{"xx", "d0", "70", "d0", "70", "d0", "70", "d0", "70", "d0", "70", "d0", "d0", "70", "d0", "70"}
 
@@ -942,6 +959,11 @@ var specialExtendedToCode = map[string]string{
 }
 
 // Time to transmit a single codeword = 1 second / 29.97
-var microsecondsPerCodeword = 1000.0 * 1000.0 / (30.0 * 1000.0 / 1001.0)
+// codewordsDuration returns how long it takes to transmit n codewords, one per 29.97fps frame.
+func codewordsDuration(n int64) time.Duration {
+	return time.Duration(timecode.Rate2997NDF.FramesToMicroseconds(n)) * time.Microsecond
+}
 
 var header = "Scenarist_SCC V1.0"
+
+const format = "scc"
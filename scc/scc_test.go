@@ -1,7 +1,9 @@
 package scc
 
 import (
+	"errors"
 	"math"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -36,7 +38,7 @@ var sccSamplePostCapsConvertion = []byte(`Scenarist_SCC V1.0
 
 00:00:09:23	94ae 94ae 9420 9420 9470 9470 a820 e3ec efe3 6b20 f4e9 e36b e96e 6720 2980 942c 942c 942f 942f
 
-00:00:12:08	942c 942c
+00:00:12:09	942c 942c
 
 00:00:14:12	94ae 94ae 9420 9420 1370 1370 cdc1 ceba 94d0 94d0 5768 e56e 20f7 e520 f468 e96e 6b80 9470 9470 efe6 20a2 4520 e5f1 7561 ec73 206d 20e3 ad73 f175 61f2 e564 a22c 942c 942c 942f 942f
 
@@ -44,13 +46,13 @@ var sccSamplePostCapsConvertion = []byte(`Scenarist_SCC V1.0
 
 00:00:18:12	94ae 94ae 9420 9420 94d0 94d0 6173 2061 6e20 efec 642c 20f7 f2e9 6e6b ec79 206d 616e 9470 9470 f7e9 f468 20f7 68e9 f4e5 2068 61e9 f2ae 942c 942c 942f 942f
 
-00:00:20:10	94ae 94ae 9420 9420 1370 1370 cdc1 ce20 32ba 94d0 94d0 4520 e5f1 7561 ec73 206d 20e3 ad73 f175 61f2 e564 20e9 7380 9470 9470 6eef f420 6162 ef75 f420 616e 20ef ec64 2045 e96e 73f4 e5e9 6eae 942c 942c 942f 942f
+00:00:20:11	94ae 94ae 9420 9420 1370 1370 cdc1 ce20 32ba 94d0 94d0 4520 e5f1 7561 ec73 206d 20e3 ad73 f175 61f2 e564 20e9 7380 9470 9470 6eef f420 6162 ef75 f420 616e 20ef ec64 2045 e96e 73f4 e5e9 6eae 942c 942c 942f 942f
 
 00:00:26:09	94ae 94ae 9420 9420 1370 1370 cdc1 ce20 32ba 94d0 94d0 49f4 a773 2061 ecec 2061 62ef 75f4 2061 6e20 e5f4 e5f2 6e61 ec80 9470 9470 45e9 6e73 f4e5 e96e ae80 942c 942c 942f 942f
 
-00:00:31:29	94ae 94ae 9420 9420 9470 9470 bc4c c1d5 c7c8 49ce c720 2620 57c8 4f4f d0d3 a13e 942c 942c 942f 942f
+00:00:32:00	94ae 94ae 9420 9420 9470 9470 bc4c c1d5 c7c8 49ce c720 2620 57c8 4f4f d0d3 a13e 942c 942c 942f 942f
 
-00:00:36:04	942c 942c
+00:00:36:05	942c 942c
 
 `)
 
@@ -81,10 +83,10 @@ func TestCaptionContent(t *testing.T) {
 	}
 	captions := captionSet.GetCaptions(caps.DefaultLang)
 	paragraph := captions[2]
-	if math.Abs(float64(*paragraph.Start)-17000000) > toleranceMicroseconds {
+	if math.Abs(float64(paragraph.Start.Microseconds())-17000000) > toleranceMicroseconds {
 		t.Error("paragraph start timestamp over microseconds tolerance")
 	}
-	if math.Abs(float64(*paragraph.End)-18752000) > toleranceMicroseconds {
+	if math.Abs(float64(paragraph.End.Microseconds())-18752000) > toleranceMicroseconds {
 		t.Error("paragraph end timestamp over microseconds tolerance")
 	}
 }
@@ -111,3 +113,110 @@ func TestWriter(t *testing.T) {
 		assert.Equal(t, test.wantSCC, result)
 	}
 }
+
+func TestWriterFrameTimes(t *testing.T) {
+	// The "942c" of the "00:00:12:08 942c 942c" line of sampleSCC is read one
+	// frame after the line timecode, at frame 369 (12.3123s), which is labeled
+	// 00:00:12:09. The float conversion of the previous writer truncated
+	// 12.3123 / 1.001 = 12.2999... and wrote it back as 00:00:12:08.
+	captionSet, err := DefaultReader().Read(sampleSCC)
+	assert.Nil(t, err)
+	captions := captionSet.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, int64(12312300), captions[0].End.Microseconds())
+	assert.Equal(t, "00:00:12:09", (&Writer{}).formatTimestamp(captions[0].End))
+	assert.Equal(t, "00:00:36:05", (&Writer{}).formatTimestamp(captions[len(captions)-1].End))
+}
+
+func TestDropFrameWriter(t *testing.T) {
+	captionSet := caps.NewCaptionSet()
+	caption := caps.NewCaption(caps.NewTimestamp(60060000), caps.NewTimestamp(70000000), []caps.CaptionContent{caps.NewCaptionText("hi")}, caps.DefaultStyleProps())
+	captionSet.SetCaptions(caps.DefaultLang, []*caps.Caption{&caption})
+	result, err := NewDropFrameWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), "\n00:01:09;29\t942c 942c\n")
+	roundTrip, err := DefaultReader().Read(result)
+	assert.Nil(t, err)
+	// the reader dates commands one frame after the timecode of their line
+	assert.Equal(t, int64(70003267), roundTrip.GetCaptions(caps.DefaultLang)[0].End.Microseconds())
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := DefaultReader().Read([]byte("Scenarist_SCC V1.0\n\n00:00:09:05 94ae 94ae 9420 9420 c8e9 942c 942c 942f 942f\n\n00:00:1x:08 942c 942c\n"))
+	var parseErr *caps.ParseError
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, caps.ErrCodeTimestamp, parseErr.Code)
+	assert.Equal(t, 5, parseErr.Line)
+	assert.Equal(t, "00:00:1x:08", parseErr.Snippet)
+
+	captionSet, err := DefaultReader().Read(sampleSCCempty)
+	assert.True(t, errors.Is(err, caps.ErrEmptyFile))
+	assert.Nil(t, captionSet)
+}
+
+func TestRecovery(t *testing.T) {
+	// the caption displayed at 00:00:01:00 is never cleared with a 942c
+	content := "Scenarist_SCC V1.0\n\n00:00:01:00 94ae 94ae 9420 9420 c8e9 942f 942f\n\n00:00:1x:08 942c 942c\n\n00:00:08:00 9420 9420\n"
+	warnings := []caps.Warning{}
+	reader := caps.WithRecovery(DefaultReader(), caps.Skip, func(warning caps.Warning) {
+		warnings = append(warnings, warning)
+	})
+	captionSet, err := caps.ReadStream(reader, strings.NewReader(content))
+	assert.Nil(t, err)
+	captions := captionSet.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, 1, len(captions))
+	assert.Equal(t, int64(1201200), captions[0].Start.Microseconds())
+	// the caption ends after the last word of the file, at 00:00:08:02
+	assert.Equal(t, int64(8074733), captions[0].End.Microseconds())
+	assert.Equal(t, 2, len(warnings))
+	assert.Equal(t, caps.ErrCodeTimestamp, warnings[0].Err.Code)
+	assert.Equal(t, caps.ErrCodeTiming, warnings[1].Err.Code)
+	assert.Equal(t, caps.ActionClamped, warnings[1].Action)
+
+	// when the last line displays it, the caption lasts lastCaptionDuration
+	captionSet, warnings, err = caps.ReadLenient(DefaultReader(), []byte("Scenarist_SCC V1.0\n\n00:00:01:00 94ae 94ae 9420 9420 c8e9 942f 942f\n"), caps.Skip)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(warnings))
+	captions = captionSet.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, int64(5201200), captions[0].End.Microseconds())
+
+	_, err = DefaultReader().Read([]byte(content))
+	assert.NotNil(t, err)
+}
+
+func TestPlacement(t *testing.T) {
+	top := caps.NewCaption(caps.NewTimestamp(1000000), caps.NewTimestamp(3000000), []caps.CaptionContent{caps.NewCaptionText("top"), caps.NewLineBreak(), caps.NewCaptionText("rows")}, caps.DefaultStyleProps())
+	top.Placement = caps.Placement{Line: caps.NewLineOffset(0)}
+	bottom := caps.NewCaption(caps.NewTimestamp(5000000), caps.NewTimestamp(7000000), []caps.CaptionContent{caps.NewCaptionText("bottom")}, caps.DefaultStyleProps())
+	bottom.Placement = caps.Placement{Line: caps.NewLineOffset(-1)}
+	captionSet := caps.NewCaptionSet()
+	captionSet.SetCaptions(caps.DefaultLang, []*caps.Caption{&top, &bottom})
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), "9420 9420 91d0 91d0 f4ef 7080 9170 9170 f2ef f773 ")
+	assert.Contains(t, string(result), "9420 9420 9470 9470 62ef f4f4 ef6d ")
+
+	roundTrip, err := DefaultReader().Read(result)
+	assert.Nil(t, err)
+	captions := roundTrip.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, 2, len(captions))
+	assert.Equal(t, top.Placement, captions[0].Placement)
+	assert.True(t, captions[1].Placement.IsDefault())
+}
+
+func TestFirstRow(t *testing.T) {
+	tests := []struct {
+		placement caps.Placement
+		lines     int
+		expected  int
+	}{
+		{caps.Placement{}, 2, 14},
+		{caps.Placement{Line: caps.NewLineOffset(2)}, 2, 3},
+		{caps.Placement{Line: caps.NewLineOffset(-3)}, 2, 12},
+		{caps.Placement{Line: caps.NewLineOffset(20)}, 2, 14},
+		{caps.Placement{Line: caps.NewPercentOffset(0)}, 1, 1},
+		{caps.Placement{Line: caps.NewPercentOffset(50), LineAlign: "end"}, 3, 6},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, firstRow(test.placement, test.lines))
+	}
+}
@@ -1,65 +1,85 @@
 package scc
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"math"
 	"strings"
 
 	"github.com/vimeo/caps"
+	"github.com/vimeo/caps/timecode"
 )
 
-type Writer struct{}
+type Writer struct {
+	// dropFrame makes the writer emit drop-frame timecodes (HH:MM:SS;FF)
+	dropFrame bool
+}
+
+// italicsOn and italicsOff mark the mid-row codes turning italics on and off in
+// the text laid out by layoutLine.
+const (
+	italicsOn      = '\x0e'
+	italicsOff     = '\x0f'
+	italicsOnCode  = "91ae 91ae "
+	italicsOffCode = "9120 9120 "
+)
 
 type codeMetadata struct {
 	Code  string
-	Start *float64
-	End   *float64
+	Start caps.Timestamp
+	End   caps.Timestamp
 }
 
 func (w *Writer) Write(captionSet *caps.CaptionSet) ([]byte, error) {
-	output := bytes.NewBufferString(header)
+	var output bytes.Buffer
+	err := w.WriteStream(&output, captionSet)
+	return output.Bytes(), err
+}
+
+// WriteStream writes the captions to out as they are encoded. Since the end of a
+// caption depends on when the next one starts, a caption is written once the
+// next one has been encoded.
+func (w *Writer) WriteStream(out io.Writer, captionSet *caps.CaptionSet) error {
+	output := bufio.NewWriter(out)
+	output.WriteString(header)
 	output.WriteString("\n\n")
 	if captionSet.IsEmpty() || len(captionSet.Languages()) <= 0 {
-		return output.Bytes(), nil
+		return output.Flush()
 	}
 	// support only one language
 	lang := captionSet.Languages()[0]
-	captions := captionSet.GetCaptions(lang)
-	codes := []codeMetadata{}
-	for _, caption := range captions {
-		code := w.textToCode(caption)
-		codes = append(codes, codeMetadata{code, caption.Start, caption.End})
-	}
-
-	for index, metadata := range codes {
-		codeWords := len(metadata.Code) / 13
-		codeTimeMicroseconds := float64(codeWords) * microsecondsPerCodeword
-		codeStart := *metadata.Start - codeTimeMicroseconds
-		if index == 0 {
-			continue
-		}
-		prevMetadata := codes[index-1]
-		if prevMetadata.End != nil && *prevMetadata.End+3*microsecondsPerCodeword >= codeStart {
-			codes[index-1] = codeMetadata{prevMetadata.Code, prevMetadata.Start, nil}
+	var prev *codeMetadata
+	for index, caption := range captionSet.GetCaptions(lang) {
+		metadata := codeMetadata{w.textToCode(caption), caption.Start, caption.End}
+		if index > 0 {
+			codeWords := int64(len(metadata.Code) / 13)
+			metadata.Start = metadata.Start.Add(-codewordsDuration(codeWords))
+			if prev.End.IsSet() && !prev.End.Add(codewordsDuration(3)).Before(metadata.Start) {
+				prev.End = caps.Timestamp{}
+			}
+			w.writeCode(output, *prev)
 		}
-		codeStartCast := codeStart
-		codes[index] = codeMetadata{metadata.Code, &codeStartCast, metadata.End}
+		prev = &metadata
+	}
+	if prev != nil {
+		w.writeCode(output, *prev)
 	}
+	return output.Flush()
+}
 
-	for _, metadata := range codes {
-		if metadata.Start == nil {
-			continue
-		}
-		output.WriteString(fmt.Sprintf("%s\t", w.formatTimestamp(*metadata.Start)))
-		output.WriteString("94ae 94ae 9420 9420 ")
-		output.WriteString(metadata.Code)
-		output.WriteString("942c 942c 942f 942f\n\n")
-		if metadata.End != nil {
-			output.WriteString(fmt.Sprintf("%s\t942c 942c\n\n", w.formatTimestamp(*metadata.End)))
-		}
+func (w *Writer) writeCode(output *bufio.Writer, metadata codeMetadata) {
+	if !metadata.Start.IsSet() {
+		return
+	}
+	output.WriteString(fmt.Sprintf("%s\t", w.formatTimestamp(metadata.Start)))
+	output.WriteString("94ae 94ae 9420 9420 ")
+	output.WriteString(metadata.Code)
+	output.WriteString("942c 942c 942f 942f\n\n")
+	if metadata.End.IsSet() {
+		output.WriteString(fmt.Sprintf("%s\t942c 942c\n\n", w.formatTimestamp(metadata.End)))
 	}
-	return output.Bytes(), nil
 }
 
 func (w *Writer) textToCode(caption *caps.Caption) string {
@@ -70,14 +90,31 @@ func (w *Writer) textToCode(caption *caps.Caption) string {
 			lines = append(lines, line)
 		}
 	}
+	first := firstRow(caption.Placement, len(lines))
+	italics := false
 	for row, line := range lines {
-		index := 16 - len(lines) + row
+		index := first + row
 		for i := 0; i < 2; i++ {
 			value := fmt.Sprintf("%s%s ", pacHighByteByRow[index], pacLowByteByRow[index])
 			code.WriteString(value)
 		}
+		// PACs reset the style, italics continuing on the next row are turned on again
+		if italics {
+			code.WriteString(italicsOnCode)
+		}
 
 		for _, char := range line {
+			switch char {
+			case italicsOn, italicsOff:
+				italics = char == italicsOn
+				w.maybeAlign(code)
+				if italics {
+					code.WriteString(italicsOnCode)
+				} else {
+					code.WriteString(italicsOffCode)
+				}
+				continue
+			}
 			w.printCharacter(code, string(char))
 			w.maybeSpace(code)
 		}
@@ -86,6 +123,35 @@ func (w *Writer) textToCode(caption *caps.Caption) string {
 	return code.String()
 }
 
+// firstRow returns the row of the first of the n lines of a caption, the lines being
+// at the bottom unless placed elsewhere by the line of placement.
+func firstRow(placement caps.Placement, n int) int {
+	row := rows - n + 1
+	line := placement.Line
+	switch {
+	case !line.IsSet():
+	case line.IsPercent():
+		row = 1 + int(line.Value()*rows/100)
+		switch placement.LineAlign {
+		case "center":
+			row -= n / 2
+		case "end":
+			row -= n - 1
+		}
+	case line.Value() >= 0:
+		row = int(line.Value()) + 1
+	default:
+		row = rows + int(line.Value()) - n + 2
+	}
+	if row > rows-n+1 {
+		row = rows - n + 1
+	}
+	if row < 1 {
+		row = 1
+	}
+	return row
+}
+
 func (w *Writer) printCharacter(buf *bytes.Buffer, char string) {
 	var charCode string
 	if code, ok := charactersToCode[char]; ok {
@@ -103,19 +169,12 @@ func (w *Writer) printCharacter(buf *bytes.Buffer, char string) {
 		buf.WriteString(charCode)
 	}
 }
-func (w *Writer) formatTimestamp(microseconds float64) string {
-	secondsFloat := float64(microseconds) / 1000.0 / 1000.0
-	// convert to non-drop-frame timecode
-	secondsFloat *= 1000.0 / 1001.0
-	hours := math.Floor(secondsFloat / 3600)
-	secondsFloat -= hours * 3600
-	minutes := math.Floor(secondsFloat / 60)
-	secondsFloat -= minutes * 60
-
-	seconds := math.Floor(secondsFloat)
-	secondsFloat -= seconds
-	frames := math.Floor(secondsFloat * 30)
-	return fmt.Sprintf("%02d:%02d:%02d:%02d", int(hours), int(minutes), int(seconds), int(frames))
+func (w *Writer) formatTimestamp(timestamp caps.Timestamp) string {
+	rate := timecode.Rate2997NDF
+	if w.dropFrame {
+		rate = timecode.Rate2997DF
+	}
+	return timecode.FromMicroseconds(timestamp.Microseconds(), rate).String()
 }
 
 func (w *Writer) maybeSpace(buf *bytes.Buffer) {
@@ -133,9 +192,16 @@ func (w *Writer) maybeAlign(buf *bytes.Buffer) {
 
 func (w *Writer) layoutLine(caption *caps.Caption) string {
 	capText := bytes.NewBufferString("")
-	for _, node := range caption.Nodes {
+	for _, node := range caps.FlattenVoices(caption.Nodes) {
 		if node.Text() || node.LineBreak() {
 			capText.WriteString(node.Content())
+		} else if style, ok := node.(caps.CaptionStyle); ok && style.Props.Italics {
+			// mid-row codes take a column, like characters
+			if style.Start {
+				capText.WriteRune(italicsOn)
+			} else {
+				capText.WriteRune(italicsOff)
+			}
 		}
 	}
 	innerLines := strings.Split(capText.String(), "\n")
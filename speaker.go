@@ -0,0 +1,95 @@
+package caps
+
+import (
+	"regexp"
+	"strings"
+)
+
+// speakerPrefix matches the "NAME:" speaker identification of formats without voice
+// markup, an uppercase name starting a line.
+var speakerPrefix = regexp.MustCompile(`^([A-Z][A-Z0-9 .'\-]{0,30}):(?:\s+|$)`)
+
+// Speakers returns the names of the voices of the caption, in order of appearance.
+func (c Caption) Speakers() []string {
+	speakers := []string{}
+	seen := map[string]bool{}
+	for _, node := range c.Nodes {
+		if span, ok := node.(CaptionSpan); ok && span.Start && span.Kind == SpanVoice && !seen[span.Value] {
+			seen[span.Value] = true
+			speakers = append(speakers, span.Value)
+		}
+	}
+	return speakers
+}
+
+// DetectSpeakers turns the "NAME:" prefixes starting the lines of the captions into
+// voice spans, for formats identifying speakers in the text like srt, scc and sami.
+// A voice span lasts until the next prefix or the end of the caption, and a name
+// alone on its line is removed with the line. Captions that already have voices
+// are left untouched.
+func DetectSpeakers(captionSet *CaptionSet) {
+	for _, captions := range captionSet.Captions {
+		for _, caption := range captions {
+			if len(caption.Speakers()) == 0 {
+				caption.Nodes = detectSpeakers(caption.Nodes)
+			}
+		}
+	}
+}
+
+func detectSpeakers(nodes []CaptionContent) []CaptionContent {
+	detected := []CaptionContent{}
+	speaker := ""
+	lineStart := true
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		if lineStart && node.Text() {
+			if matches := speakerPrefix.FindStringSubmatch(node.Content()); matches != nil {
+				if speaker != "" {
+					detected = append(detected, NewCaptionSpan(false, SpanVoice, speaker, ""))
+				}
+				speaker = strings.TrimSpace(matches[1])
+				detected = append(detected, NewCaptionSpan(true, SpanVoice, speaker, ""))
+				rest := node.Content()[len(matches[0]):]
+				if rest != "" {
+					detected = append(detected, NewCaptionText(rest))
+					lineStart = false
+				} else if i+1 < len(nodes) && nodes[i+1].LineBreak() {
+					// the name is alone on its line
+					i++
+					lineStart = true
+				}
+				continue
+			}
+		}
+		lineStart = node.LineBreak()
+		detected = append(detected, node)
+	}
+	if speaker != "" {
+		detected = append(detected, NewCaptionSpan(false, SpanVoice, speaker, ""))
+	}
+	return detected
+}
+
+// FlattenVoices returns the nodes with the voice spans replaced by "Name: " text
+// prefixes, for writers of formats without voice markup. When a caption has
+// several voices, each one is introduced by a dash, as in "- Name: ".
+func FlattenVoices(nodes []CaptionContent) []CaptionContent {
+	caption := Caption{Nodes: nodes}
+	dash := ""
+	if len(caption.Speakers()) > 1 {
+		dash = "- "
+	}
+	flattened := []CaptionContent{}
+	for _, node := range nodes {
+		span, ok := node.(CaptionSpan)
+		if !ok || span.Kind != SpanVoice {
+			flattened = append(flattened, node)
+			continue
+		}
+		if span.Start && span.Value != "" {
+			flattened = append(flattened, NewCaptionText(dash+span.Value+": "))
+		}
+	}
+	return flattened
+}
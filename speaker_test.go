@@ -0,0 +1,58 @@
+package caps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectSpeakers(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []CaptionContent
+		want  []CaptionContent
+	}{
+		{
+			"name alone on its line",
+			[]CaptionContent{NewCaptionText("MAN 2:"), NewLineBreak(), NewCaptionText("E equals m c-squared is")},
+			[]CaptionContent{NewCaptionSpan(true, SpanVoice, "MAN 2", ""), NewCaptionText("E equals m c-squared is"), NewCaptionSpan(false, SpanVoice, "MAN 2", "")},
+		},
+		{
+			"dialogue",
+			[]CaptionContent{NewCaptionText("BOB: Hi."), NewLineBreak(), NewCaptionText("ALICE: Hello.")},
+			[]CaptionContent{
+				NewCaptionSpan(true, SpanVoice, "BOB", ""), NewCaptionText("Hi."), NewLineBreak(), NewCaptionSpan(false, SpanVoice, "BOB", ""),
+				NewCaptionSpan(true, SpanVoice, "ALICE", ""), NewCaptionText("Hello."), NewCaptionSpan(false, SpanVoice, "ALICE", ""),
+			},
+		},
+		{
+			"text before the first speaker",
+			[]CaptionContent{NewCaptionText("( clock ticking )"), NewLineBreak(), NewCaptionText("MAN: Now.")},
+			[]CaptionContent{NewCaptionText("( clock ticking )"), NewLineBreak(), NewCaptionSpan(true, SpanVoice, "MAN", ""), NewCaptionText("Now."), NewCaptionSpan(false, SpanVoice, "MAN", "")},
+		},
+		{
+			"not a speaker",
+			[]CaptionContent{NewCaptionText("Meet me at 10:30 - Bob: ok")},
+			[]CaptionContent{NewCaptionText("Meet me at 10:30 - Bob: ok")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			caption := NewCaption(NewTimestamp(0), NewTimestamp(1000000), test.input, DefaultStyleProps())
+			captionSet := NewCaptionSet()
+			captionSet.SetCaptions(DefaultLang, []*Caption{&caption})
+			DetectSpeakers(captionSet)
+			assert.Equal(t, test.want, caption.Nodes)
+		})
+	}
+}
+
+func TestFlattenVoices(t *testing.T) {
+	single := []CaptionContent{NewCaptionSpan(true, SpanVoice, "Bob", ""), NewCaptionText("Hi."), NewCaptionSpan(false, SpanVoice, "Bob", "")}
+	assert.Equal(t, []string{"Bob"}, Caption{Nodes: single}.Speakers())
+	assert.Equal(t, "Bob: Hi.", Caption{Nodes: FlattenVoices(single)}.Text())
+
+	dialogue := append(append([]CaptionContent{}, single...), NewLineBreak(), NewCaptionSpan(true, SpanVoice, "Alice", ""), NewCaptionText("Hello."), NewCaptionSpan(false, SpanVoice, "Alice", ""))
+	assert.Equal(t, []string{"Bob", "Alice"}, Caption{Nodes: dialogue}.Speakers())
+	assert.Equal(t, "- Bob: Hi.\n- Alice: Hello.", Caption{Nodes: FlattenVoices(dialogue)}.Text())
+}
@@ -0,0 +1,130 @@
+package srt
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/vimeo/caps"
+)
+
+// The X1, X2, Y1 and Y2 coordinates are pixels of a frame whose size isn't stored
+// in the file, assumed to be 640x480.
+const (
+	frameWidth  = 640
+	frameHeight = 480
+)
+
+var (
+	// reAlignment matches the {\anN} override of ASS, N being the position of the
+	// caption on a numeric keypad, from 7 (top left) to 3 (bottom right)
+	reAlignment  = regexp.MustCompile(`\{\\an([1-9])\}`)
+	reCoordinate = regexp.MustCompile(`(?i)^([XY][12]):(\d+)$`)
+)
+
+// alignmentPlacement returns the placement of the {\anN} override.
+func alignmentPlacement(n int) caps.Placement {
+	placement := caps.Placement{}
+	switch (n - 1) / 3 {
+	case 1:
+		placement.Line, placement.LineAlign = caps.NewPercentOffset(50), "center"
+	case 2:
+		placement.Line = caps.NewLineOffset(0)
+	}
+	switch (n - 1) % 3 {
+	case 0:
+		placement.Align = "left"
+	case 2:
+		placement.Align = "right"
+	}
+	return placement
+}
+
+// alignment returns the N of the {\anN} override closest to the placement, 2
+// (bottom center) being the default.
+func alignment(placement caps.Placement) int {
+	row := 0
+	if line := placement.Line; line.IsSet() {
+		percent := line.Value()
+		if !line.IsPercent() {
+			if percent >= 0 {
+				percent = percent * 100 / caps.DefaultRows
+			} else {
+				percent = 100 + (percent+1)*100/caps.DefaultRows
+			}
+		}
+		switch {
+		case percent < 100.0/3:
+			row = 2
+		case percent < 200.0/3:
+			row = 1
+		}
+	}
+	column := 1
+	switch placement.Align {
+	case "left", "start":
+		column = 0
+	case "right", "end":
+		column = 2
+	}
+	return row*3 + column + 1
+}
+
+// parseCoordinates returns the placement of the caption box set by the X1, X2, Y1
+// and Y2 coordinates of a timing line, false when they're missing. The bottom of
+// the box, Y2, is left to the text.
+func parseCoordinates(fields []string) (caps.Placement, bool) {
+	coordinates := map[string]float64{}
+	for _, field := range fields {
+		if matches := reCoordinate.FindStringSubmatch(field); matches != nil {
+			value, _ := strconv.ParseFloat(matches[2], 64)
+			coordinates[strings.ToUpper(matches[1])] = value
+		}
+	}
+	x1, okX1 := coordinates["X1"]
+	x2, okX2 := coordinates["X2"]
+	y1, okY1 := coordinates["Y1"]
+	if !okX1 || !okX2 || !okY1 || x2 < x1 {
+		return caps.Placement{}, false
+	}
+	percent := func(value, size float64) caps.Offset {
+		return caps.NewPercentOffset(math.Round(math.Min(value, size)*10000/size) / 100)
+	}
+	return caps.Placement{
+		Position:      percent(x1, frameWidth),
+		PositionAlign: "line-left",
+		Size:          percent(x2-x1, frameWidth),
+		Line:          percent(y1, frameHeight),
+		LineAlign:     "start",
+	}, true
+}
+
+// formatCoordinates returns the coordinates of the caption box, preceded by a
+// space, when the placement sets its position, size and line as percentages,
+// or an empty string. Y2 is computed for lines of text of caps.DefaultRows of
+// the frame height.
+func formatCoordinates(placement caps.Placement, lines int) string {
+	if !placement.Position.IsPercent() || !placement.Size.IsPercent() || !placement.Line.IsPercent() {
+		return ""
+	}
+	x1 := placement.Position.Value() * frameWidth / 100
+	switch placement.PositionAlign {
+	case "center":
+		x1 -= placement.Size.Value() * frameWidth / 200
+	case "line-right":
+		x1 -= placement.Size.Value() * frameWidth / 100
+	}
+	x1 = math.Max(0, x1)
+	height := float64(lines) * frameHeight / caps.DefaultRows
+	y1 := placement.Line.Value() * frameHeight / 100
+	switch placement.LineAlign {
+	case "center":
+		y1 -= height / 2
+	case "end":
+		y1 -= height
+	}
+	y1 = math.Max(0, y1)
+	return fmt.Sprintf(" X1:%.0f X2:%.0f Y1:%.0f Y2:%.0f", x1, math.Min(x1+placement.Size.Value()*frameWidth/100, frameWidth), y1, math.Min(y1+height, frameHeight))
+}
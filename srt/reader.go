@@ -1,14 +1,22 @@
 package srt
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 
 	"github.com/vimeo/caps"
 )
 
-type Reader struct{}
+type Reader struct {
+	// lang is the language of the captions, caps.DefaultLang when empty
+	lang     string
+	recovery caps.Recovery
+	warn     caps.WarningFunc
+}
 
 func (Reader) Detect(content []byte) bool {
 	lines := splitLines(string(content))
@@ -18,65 +26,260 @@ func (Reader) Detect(content []byte) bool {
 	return isDigit(lines[0]) && strings.Contains(lines[1], timecodeSeparator)
 }
 func (r Reader) Read(content []byte) (*caps.CaptionSet, error) {
+	return r.ReadStream(bytes.NewReader(content))
+}
+
+// ReadStream decodes the captions one at a time, only holding the lines of the
+// caption being read besides the resulting caption set.
+func (r Reader) ReadStream(in io.Reader) (*caps.CaptionSet, error) {
+	captionSet, warnings, err := (&cueParser{recovery: r.recovery, lang: r.lang}).read(in)
+	r.warn.Report(warnings)
+	return captionSet, err
+}
+
+// WithRecovery returns a copy of the reader recovering from the invalid captions.
+// Blocks that don't start with a caption number are skipped instead of ending the file.
+func (r Reader) WithRecovery(recovery caps.Recovery, warn caps.WarningFunc) caps.CaptionReader {
+	r.recovery, r.warn = recovery, warn
+	return r
+}
+
+// cueParser reads the captions of a file, recovering from the invalid ones
+// unless recovery is caps.Strict.
+type cueParser struct {
+	recovery caps.Recovery
+	lang     string
+	warnings []caps.Warning
+	captions []*caps.Caption
+	// timingLines holds the line number of the timing of each caption
+	timingLines []int
+}
+
+func (p *cueParser) read(in io.Reader) (*caps.CaptionSet, []caps.Warning, error) {
+	lines := []string{}
+	// firstLine is the line number of lines[0]
+	firstLine := 1
+	scanner := caps.NewLineScanner(in)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		// the caption is complete once the first line of the next one is read
+		endLine := findTextLine(0, lines)
+		if endLine >= len(lines) {
+			continue
+		}
+		if err := p.addCaption(lines, endLine, firstLine); err != nil {
+			if err == errNotCaption {
+				lines = nil
+				break
+			}
+			return nil, nil, err
+		}
+		lines = lines[endLine:]
+		firstLine += endLine
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(lines) > 0 {
+		if err := p.addCaption(lines, findTextLine(0, lines), firstLine); err != nil && err != errNotCaption {
+			return nil, nil, err
+		}
+	}
+	captions, warnings := caps.RecoverTimings(format, p.captions, p.timingLines, p.recovery)
 	captionSet := caps.NewCaptionSet()
-	captions := []*caps.Caption{}
-	lines := splitLines(string(content))
-	startLine := 0
+	lang := p.lang
+	if lang == "" {
+		lang = caps.DefaultLang
+	}
+	captionSet.SetCaptions(lang, captions)
+	if captionSet.IsEmpty() {
+		return nil, nil, caps.NewEmptyFileError(format)
+	}
+	return captionSet, append(p.warnings, warnings...), nil
+}
 
-	for startLine < len(lines) {
-		if !isDigit(lines[startLine]) {
-			break
+// errNotCaption is returned by addCaption in strict mode when the lines don't
+// start with a caption number, which ends the parsing of the file.
+var errNotCaption = errors.New("not a caption")
+
+// addCaption parses the caption of the lines, recovering from errors unless strict.
+func (p *cueParser) addCaption(lines []string, endLine, lineNumber int) error {
+	caption, err := p.parseCaption(lines, endLine, lineNumber)
+	if err == errNotCaption && p.recovery != caps.Strict {
+		err = &caps.ParseError{Format: format, Line: lineNumber, Column: 1, Snippet: lines[0], Code: caps.ErrCodeMalformed, Err: fmt.Errorf("expected a caption number")}
+	}
+	if err != nil {
+		parseErr, ok := err.(*caps.ParseError)
+		if !ok || p.recovery == caps.Strict {
+			return err
 		}
-		var capStart int64
-		var capEnd int64
-		var err error
-		endLine := findTextLine(startLine, lines)
-		if matches := reTiming.FindAllString(lines[startLine+1], -1); len(matches) >= 3 {
-			capStart, err = srtToMicro(matches[1])
-			if err != nil {
-				return nil, err
+		p.warnings = append(p.warnings, caps.Warning{Err: parseErr, Action: caps.ActionSkipped})
+		return nil
+	}
+	if caption != nil {
+		p.captions = append(p.captions, caption)
+		p.timingLines = append(p.timingLines, lineNumber+1)
+	}
+	return nil
+}
+
+// parseCaption parses the caption starting at the first line, endLine being the line
+// after the caption as returned by findTextLine and lineNumber the line number of
+// the first line in the file. It returns errNotCaption when the lines don't start
+// with a caption number.
+func (p *cueParser) parseCaption(lines []string, endLine, lineNumber int) (*caps.Caption, error) {
+	if !isDigit(lines[0]) {
+		return nil, errNotCaption
+	}
+	if len(lines) < 2 {
+		return nil, &caps.ParseError{Format: format, Line: lineNumber, Column: 1, Snippet: lines[0], Code: caps.ErrCodeMalformed, Err: fmt.Errorf("malformed srt file")}
+	}
+	timingLine := lines[1]
+	parseTimestamp := func(stamp string) (int64, error) {
+		micro, err := srtToMicro(stamp)
+		if err == nil {
+			return micro, nil
+		}
+		column := strings.Index(timingLine, stamp) + 1
+		parseErr := &caps.ParseError{Format: format, Line: lineNumber + 1, Column: column, Snippet: stamp, Code: caps.ErrCodeTimestamp, Err: err}
+		if p.recovery == caps.Repair {
+			if micro, err := srtToMicro(repairTimestamp(stamp)); err == nil {
+				p.warnings = append(p.warnings, caps.Warning{Err: parseErr, Action: caps.ActionRepaired})
+				return micro, nil
 			}
-			capEnd, err = srtToMicro(matches[2])
-			if err != nil {
-				return nil, err
+		}
+		return 0, parseErr
+	}
+	var capStart int64
+	var capEnd int64
+	var err error
+	// coordinates holds the X1, X2, Y1 and Y2 fields following the end timestamp
+	coordinates := []string{}
+	if matches := reTiming.FindAllString(timingLine, -1); len(matches) >= 3 {
+		capStart, err = parseTimestamp(matches[1])
+		if err != nil {
+			return nil, err
+		}
+		capEnd, err = parseTimestamp(matches[2])
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		timing := strings.Split(timingLine, timecodeSeparator)
+		if len(timing) < 2 {
+			return nil, &caps.ParseError{Format: format, Line: lineNumber + 1, Column: 1, Snippet: timingLine, Code: caps.ErrCodeMalformed, Err: fmt.Errorf("malformed srt file")}
+		}
+		capStart, err = parseTimestamp(strings.Trim(timing[0], " \r\n"))
+		if err != nil {
+			return nil, err
+		}
+		end := []string{}
+		for _, field := range strings.Fields(timing[1]) {
+			if reCoordinate.MatchString(field) {
+				coordinates = append(coordinates, field)
+			} else {
+				end = append(end, field)
 			}
-		} else {
-			timing := strings.Split(lines[startLine+1], timecodeSeparator)
-			if len(timing) < 2 {
-				return nil, fmt.Errorf("malformed srt file")
+		}
+		capEnd, err = parseTimestamp(strings.Join(end, " "))
+		if err != nil {
+			return nil, err
+		}
+	}
+	textEnd := endLine - 1
+	if textEnd > len(lines) {
+		textEnd = len(lines)
+	}
+	text := []string{}
+	if textEnd > 2 {
+		for _, line := range lines[2:textEnd] {
+			if len(text) == 0 || line != "" {
+				text = append(text, line)
 			}
-			capStart, err = srtToMicro(strings.Trim(timing[0], " \r\n"))
-			if err != nil {
-				return nil, err
+		}
+	}
+	if len(text) == 0 {
+		return nil, nil
+	}
+	content := strings.Join(text, "\n")
+	placement := caps.Placement{}
+	if matches := reAlignment.FindStringSubmatch(content); matches != nil {
+		n, _ := strconv.Atoi(matches[1])
+		placement = alignmentPlacement(n)
+		content = reAlignment.ReplaceAllString(content, "")
+	}
+	if box, ok := parseCoordinates(coordinates); ok {
+		box.Align = placement.Align
+		placement = box
+	}
+	capNodes := parseText(content)
+	c := caps.NewCaption(caps.NewTimestamp(capStart), caps.NewTimestamp(capEnd), capNodes, caps.DefaultStyleProps())
+	c.Number, _ = strconv.Atoi(strings.TrimSpace(lines[0]))
+	c.Placement = placement
+	return &c, nil
+}
+
+// parseText returns the nodes of the text of a caption, with a style node for each
+// <i>, <b>, <u> and <font color> tag. Players are forgiving with SRT markup, so
+// misnested and unclosed tags are closed like caps.TagStack does. Other tags, like
+// "<LAUGHING>", are kept as text.
+func parseText(text string) []caps.CaptionContent {
+	nodes := []caps.CaptionContent{}
+	addText := func(text string) {
+		for i, line := range strings.Split(text, "\n") {
+			if i > 0 {
+				nodes = append(nodes, caps.NewLineBreak())
 			}
-			capEnd, err = srtToMicro(strings.Trim(timing[1], " \r\n"))
-			if err != nil {
-				return nil, err
+			if line != "" {
+				nodes = append(nodes, caps.NewCaptionText(line))
 			}
 		}
-		capNodes := []caps.CaptionContent{}
-		for _, line := range lines[startLine+2 : endLine-1] {
-			cleanLine := reFont.ReplaceAllString(line, "")
-			cleanLine = reEndFont.ReplaceAllString(cleanLine, "")
-			if len(capNodes) == 0 || line != "" {
-				capNodes = append(capNodes, caps.NewCaptionText(cleanLine))
-				capNodes = append(capNodes, caps.NewLineBreak())
-			}
+	}
+	open := caps.TagStack{}
+	for {
+		match := reTag.FindStringSubmatchIndex(text)
+		if match == nil {
+			addText(text)
+			break
+		}
+		addText(text[:match[0]])
+		end, name := text[match[2]:match[3]] == "/", strings.ToLower(text[match[4]:match[5]])
+		attributes := ""
+		if match[6] >= 0 {
+			attributes = text[match[6]:match[7]]
 		}
-		if len(capNodes) > 0 {
-			capNodes = capNodes[:len(capNodes)-1]
-			start := float64(capStart)
-			end := float64(capEnd)
-			c := caps.NewCaption(&start, &end, capNodes, caps.DefaultStyleProps())
-			captions = append(captions, &c)
+		text = text[match[1]:]
+		if end {
+			nodes = append(nodes, open.Close(name)...)
+			continue
+		}
+		style := caps.StyleProps{}
+		switch name {
+		case "i":
+			style.Italics = true
+		case "b":
+			style.Bold = true
+		case "u":
+			style.Underline = true
+		case "font":
+			if color := reColor.FindStringSubmatch(attributes); color != nil {
+				style.Color = color[1]
+			}
 		}
-		startLine = endLine
+		nodes = append(nodes, caps.NewCaptionStyle(true, style))
+		open.Open(name, caps.NewCaptionStyle(false, style))
 	}
-	captionSet.SetCaptions(caps.DefaultLang, captions)
-	if captionSet.IsEmpty() {
-		return nil, fmt.Errorf("empty srt file")
+	return append(nodes, open.CloseAll()...)
+}
+
+// repairTimestamp fixes common mistakes in SRT timestamps: WebVTT style '.'
+// separators, missing hours and spaces.
+func repairTimestamp(stamp string) string {
+	stamp = strings.Replace(strings.Join(strings.Fields(stamp), ""), ".", ",", 1)
+	if strings.Count(stamp, ":") == 1 {
+		stamp = "00:" + stamp
 	}
-	return captionSet, nil
+	return stamp
 }
 
 func findTextLine(startLine int, lines []string) int {
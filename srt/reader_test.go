@@ -1,9 +1,11 @@
 package srt
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vimeo/caps"
 )
 
 func TestFindTextLine(t *testing.T) {
@@ -90,3 +92,139 @@ func TestSplitLines(t *testing.T) {
 		})
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  caps.ParseError
+	}{
+		{"invalid end timestamp", "1\n00:00:01,000 --> 00:00:02,000\nfirst\n\n2\n00:00:03,000 --> 00:00:0x,000\nsecond\n", caps.ParseError{Format: "srt", Line: 6, Column: 18, Snippet: "00:00:0x,000", Code: caps.ErrCodeTimestamp}},
+		{"missing separator", "1\n00:00:01,000 00:00:02,000\nfirst\n", caps.ParseError{Format: "srt", Line: 2, Column: 1, Snippet: "00:00:01,000 00:00:02,000", Code: caps.ErrCodeMalformed}},
+		{"empty", "\n\n", caps.ParseError{Format: "srt", Code: caps.ErrCodeEmpty}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewReader().Read([]byte(test.input))
+			var parseErr *caps.ParseError
+			assert.True(t, errors.As(err, &parseErr))
+			parseErr.Err = nil
+			assert.Equal(t, test.want, *parseErr)
+		})
+	}
+}
+
+func TestReadLenient(t *testing.T) {
+	input := "1\n00:00:01.000 --> 00:00:02.000\nfirst\n\n2\n00:00:03,000 --> 00:00:0x,000\nsecond\n\n3\n00:00:05,000 --> 00:00:04,000\nthird\n\n4\n00:00:06,000 --> 00:00:07,000\nfourth\n"
+	tests := []struct {
+		recovery    caps.Recovery
+		wantTimings []string
+		wantActions []string
+	}{
+		{caps.Skip, []string{"00:00:06.000 --> 00:00:07.000"}, []string{caps.ActionSkipped, caps.ActionSkipped, caps.ActionSkipped}},
+		{caps.Clamp, []string{"00:00:05.000 --> 00:00:05.000", "00:00:06.000 --> 00:00:07.000"}, []string{caps.ActionSkipped, caps.ActionSkipped, caps.ActionClamped}},
+		{caps.Repair, []string{"00:00:01.000 --> 00:00:02.000", "00:00:04.000 --> 00:00:05.000", "00:00:06.000 --> 00:00:07.000"}, []string{caps.ActionRepaired, caps.ActionRepaired, caps.ActionSkipped, caps.ActionRepaired}},
+	}
+	for _, test := range tests {
+		t.Run(test.recovery.String(), func(t *testing.T) {
+			captionSet, warnings, err := caps.ReadLenient(NewReader(), []byte(input), test.recovery)
+			assert.Nil(t, err)
+			timings := []string{}
+			for _, caption := range captionSet.GetCaptions(caps.DefaultLang) {
+				timings = append(timings, caption.FormatStart()+" --> "+caption.FormatEnd())
+			}
+			assert.Equal(t, test.wantTimings, timings)
+			actions := []string{}
+			for _, warning := range warnings {
+				actions = append(actions, warning.Action)
+			}
+			assert.Equal(t, test.wantActions, actions)
+		})
+	}
+
+	_, err := NewReader().Read([]byte(input))
+	assert.NotNil(t, err)
+}
+
+func TestParseText(t *testing.T) {
+	italics := caps.StyleProps{Italics: true}
+	yellow := caps.StyleProps{Color: "#ffff00"}
+	tests := []struct {
+		name     string
+		input    string
+		expected []caps.CaptionContent
+	}{
+		{"italics across lines", "<i>one\ntwo</i>", []caps.CaptionContent{
+			caps.NewCaptionStyle(true, italics), caps.NewCaptionText("one"), caps.NewLineBreak(), caps.NewCaptionText("two"), caps.NewCaptionStyle(false, italics),
+		}},
+		{"nested tags", `<font color="#ffff00">a <B>b</B></font>`, []caps.CaptionContent{
+			caps.NewCaptionStyle(true, yellow), caps.NewCaptionText("a "), caps.NewCaptionStyle(true, caps.StyleProps{Bold: true}), caps.NewCaptionText("b"),
+			caps.NewCaptionStyle(false, caps.StyleProps{Bold: true}), caps.NewCaptionStyle(false, yellow),
+		}},
+		{"unclosed and misnested tags", "<u>a <i>b</u> c</i>", []caps.CaptionContent{
+			caps.NewCaptionStyle(true, caps.StyleProps{Underline: true}), caps.NewCaptionText("a "), caps.NewCaptionStyle(true, italics), caps.NewCaptionText("b"),
+			caps.NewCaptionStyle(false, italics), caps.NewCaptionStyle(false, caps.StyleProps{Underline: true}), caps.NewCaptionText(" c"),
+		}},
+		{"other tags", "<LAUGHING> <i>", []caps.CaptionContent{
+			caps.NewCaptionText("<LAUGHING> "), caps.NewCaptionStyle(true, italics), caps.NewCaptionStyle(false, italics),
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, parseText(test.input))
+		})
+	}
+}
+
+func TestFormattingRoundTrip(t *testing.T) {
+	input := "1\n00:00:01,000 --> 00:00:02,000\n<i>one\n<font color=\"yellow\"><b>two</b></font></i> <u>three</u>\n"
+	captionSet, err := NewReader().Read([]byte(input))
+	assert.Nil(t, err)
+	output, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, input, string(output))
+}
+
+func TestPlacement(t *testing.T) {
+	input := `1
+00:00:01,000 --> 00:00:02,000
+{\an8}top
+
+2
+00:00:03,000 --> 00:00:04,000
+{\an4}<i>middle left</i>
+
+3
+00:00:05,000 --> 00:00:06,000 X1:64 X2:576 Y1:48 Y2:112
+box
+on two lines
+
+4
+00:00:07,000 --> 00:00:08,000
+bottom
+`
+	captionSet, err := NewReader().Read([]byte(input))
+	assert.Nil(t, err)
+	captions := captionSet.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, caps.Placement{Line: caps.NewLineOffset(0)}, captions[0].Placement)
+	assert.Equal(t, "top", captions[0].Text())
+	assert.Equal(t, caps.Placement{Line: caps.NewPercentOffset(50), LineAlign: "center", Align: "left"}, captions[1].Placement)
+	assert.Equal(t, caps.Placement{
+		Position: caps.NewPercentOffset(10), PositionAlign: "line-left", Size: caps.NewPercentOffset(80),
+		Line: caps.NewPercentOffset(10), LineAlign: "start",
+	}, captions[2].Placement)
+	assert.True(t, captions[3].Placement.IsDefault())
+
+	output, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, input, string(output))
+}
+
+func TestAlignment(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		assert.Equal(t, n, alignment(alignmentPlacement(n)))
+	}
+	assert.Equal(t, 8, alignment(caps.Placement{Line: caps.NewLineOffset(1)}))
+	assert.Equal(t, 2, alignment(caps.Placement{Line: caps.NewLineOffset(-1)}))
+	assert.Equal(t, 9, alignment(caps.Placement{Line: caps.NewPercentOffset(10), Align: "end"}))
+}
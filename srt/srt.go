@@ -1,12 +1,16 @@
 package srt
 
 import (
+	"errors"
+	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/vimeo/caps"
 )
 
 const (
+	format            string = "srt"
 	base10            int    = 10
 	bitSize64         int    = 64
 	microHr           int64  = 3600000000
@@ -17,16 +21,55 @@ const (
 )
 
 var (
-	re        = regexp.MustCompile("^[0-9]{1,}$")
-	reTiming  = regexp.MustCompile("^([0-9]{1,}:[0-9]{1,}:[0-9]{1,},[0-9]{1,}) --> ([0-9]{1,}:[0-9]{1,}:[0-9]{1,},[0-9]{1,})")
-	reFont    = regexp.MustCompile("(?i)<font color=\"[0-9a-zA-Z]*\">")
-	reEndFont = regexp.MustCompile("(?i)</font>")
+	re       = regexp.MustCompile("^[0-9]{1,}$")
+	reTiming = regexp.MustCompile("^([0-9]{1,}:[0-9]{1,}:[0-9]{1,},[0-9]{1,}) --> ([0-9]{1,}:[0-9]{1,}:[0-9]{1,},[0-9]{1,})")
+	// reTag matches the formatting tags of the text, other tags being kept as text
+	reTag = regexp.MustCompile(`(?i)<(/?)(i|b|u|font)(\s[^>]*)?>`)
+	// reLang matches the BCP 47 language tags of file name suffixes, e.g. "en" or "pt-BR"
+	reLang  = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+	reColor = regexp.MustCompile(`(?i)color\s*=\s*["']?([^"'\s>]+)`)
 )
 
+// ErrMultipleLanguages is returned by the writer for caption sets of several
+// languages, which WriteLanguages writes to separate documents.
+var ErrMultipleLanguages = errors.New("srt holds a single language, use srt.WriteLanguages")
+
+func init() {
+	caps.Register("srt", NewReader(), NewWriter())
+}
+
 func NewReader() caps.CaptionReader {
 	return Reader{}
 }
 
+// NewLangReader returns a reader setting the captions to lang rather than caps.DefaultLang,
+// e.g. the language found by LangFromFilename.
+func NewLangReader(lang string) caps.CaptionReader {
+	return Reader{lang: lang}
+}
+
+// LangFilename returns the name of the file holding the captions of lang, the
+// language being inserted before the extension, e.g. "movie.fr.srt" for "movie.srt".
+func LangFilename(name, lang string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + lang + ext
+}
+
+// LangFromFilename returns the language of the suffix of a file name like
+// "movie.fr.srt" or "movie.pt_BR.srt", or an empty string when there's none.
+func LangFromFilename(name string) string {
+	name = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return ""
+	}
+	lang := strings.ReplaceAll(name[i+1:], "_", "-")
+	if !reLang.MatchString(lang) {
+		return ""
+	}
+	return lang
+}
+
 func NewWriter() caps.CaptionWriter {
 	return Writer{}
 }
@@ -1,6 +1,9 @@
 package srt
 
 import (
+	"bytes"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,17 +28,19 @@ func TestSRTTimestamp(t *testing.T) {
 	captions, err := reader.Read(SampleSRT)
 	assert.Nil(t, err)
 	p := captions.GetCaptions(caps.DefaultLang)[2]
-	assert.Equal(t, 17000000, int(*p.Start))
-	assert.Equal(t, 18752000, int(*p.End))
+	assert.Equal(t, 17000000, int(p.Start.Microseconds()))
+	assert.Equal(t, 18752000, int(p.End.Microseconds()))
 }
 
-func TestSRTStripFontColor(t *testing.T) {
+func TestSRTFontColor(t *testing.T) {
 	reader := NewReader()
 	captions, err := reader.Read(SampleSRTFontColor)
-	text := captions.GetCaptions(caps.DefaultLang)[3].Nodes[0].Content()
 	assert.Nil(t, err)
 	assert.Equal(t, 4, len(captions.GetCaptions(caps.DefaultLang)))
-	assert.Equal(t, "as an old, wrinkly man", text)
+	nodes := captions.GetCaptions(caps.DefaultLang)[3].Nodes
+	assert.Equal(t, caps.NewCaptionStyle(true, caps.StyleProps{Color: "white"}), nodes[0])
+	assert.Equal(t, "as an old, wrinkly man", nodes[1].Content())
+	assert.Equal(t, "<LAUGHING & WHOOPS!>", captions.GetCaptions(caps.DefaultLang)[2].Text())
 }
 
 func TestSRTNumeric(t *testing.T) {
@@ -254,3 +259,62 @@ var SampleSRTBlankLines []byte = []byte(`35
 YOU  HAVE  ANY  INFORMATION
 
 `)
+
+func TestSRTKeepsNumbers(t *testing.T) {
+	captionSet, err := NewReader().Read(SampleSRTNumeric)
+	assert.Nil(t, err)
+	// the index is kept as the caption number, not as an identifier other
+	// formats would write, e.g. as a WebVTT cue identifier
+	assert.Equal(t, 35, captionSet.GetCaptions(caps.DefaultLang)[0].Number)
+	assert.Equal(t, "", captionSet.GetCaptions(caps.DefaultLang)[0].ID)
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(result), "35\n"))
+
+	captionSet.GetCaptions(caps.DefaultLang)[1].Number = 0
+	captionSet.GetCaptions(caps.DefaultLang)[1].ID = "chapter-2"
+	result, err = NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(result), "1\n"))
+}
+
+func TestLangFromFilename(t *testing.T) {
+	tests := map[string]string{
+		"movie.fr.srt":            "fr",
+		"/videos/movie.pt_BR.srt": "pt-BR",
+		"movie.en-US.srt":         "en-US",
+		"movie.srt":               "",
+		"movie.final.srt":         "",
+		"movie.2019.srt":          "",
+	}
+	for name, lang := range tests {
+		assert.Equal(t, lang, LangFromFilename(name), name)
+	}
+}
+
+func TestSRTLanguages(t *testing.T) {
+	french, err := NewLangReader("fr").Read(SampleSRT)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"fr"}, french.Languages())
+	english, err := NewReader().Read(SampleSRTNumeric)
+	assert.Nil(t, err)
+	french.SetCaptions(caps.DefaultLang, english.GetCaptions(caps.DefaultLang))
+
+	documents, err := WriteLanguages(french)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(documents))
+	assert.True(t, strings.HasPrefix(string(documents["fr"]), "1\n00:00:09,209"))
+	assert.True(t, strings.HasPrefix(string(documents[caps.DefaultLang]), "35\n"))
+
+	// a single SRT file holds a single language
+	var output bytes.Buffer
+	err = NewWriter().(caps.StreamWriter).WriteStream(&output, french)
+	assert.True(t, errors.Is(err, ErrMultipleLanguages))
+	assert.EqualError(t, err, "srt holds a single language, use srt.WriteLanguages: the captions are in en-US, fr")
+	assert.Equal(t, 0, output.Len())
+	_, err = NewWriter().Write(french)
+	assert.True(t, errors.Is(err, ErrMultipleLanguages))
+
+	assert.Equal(t, "out/movie.fr.srt", LangFilename("out/movie.srt", "fr"))
+	assert.Equal(t, "movie.pt-BR", LangFilename("movie", "pt-BR"))
+}
@@ -1,7 +1,10 @@
 package srt
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 
@@ -11,44 +14,132 @@ import (
 type Writer struct{}
 
 func (w Writer) Write(captionSet *caps.CaptionSet) ([]byte, error) {
-	content, err := w.WriteString(captionSet)
-	return []byte(content), err
+	var output bytes.Buffer
+	err := w.WriteStream(&output, captionSet)
+	return output.Bytes(), err
 }
 
-func (Writer) WriteString(captionSet *caps.CaptionSet) (string, error) {
-	contents := []string{}
+func (w Writer) WriteString(captionSet *caps.CaptionSet) (string, error) {
+	var output strings.Builder
+	err := w.WriteStream(&output, captionSet)
+	return output.String(), err
+}
+
+// WriteStream writes the captions one at a time to out. An SRT file holds a single
+// language: for caption sets of several languages, ErrMultipleLanguages is returned
+// before anything is written, WriteLanguages writing each of them.
+func (Writer) WriteStream(out io.Writer, captionSet *caps.CaptionSet) error {
+	languages := captionSet.Languages()
+	if len(languages) > 1 {
+		return fmt.Errorf("%w: the captions are in %s", ErrMultipleLanguages, strings.Join(languages, ", "))
+	}
+	output := bufio.NewWriter(out)
+	if len(languages) > 0 {
+		recreateLang(output, captionSet.GetCaptions(languages[0]))
+	}
+	return output.Flush()
+}
+
+// WriteLanguages returns an SRT document for each language of the caption set, by
+// language, to be written to separate files named by LangFilename.
+func WriteLanguages(captionSet *caps.CaptionSet) (map[string][]byte, error) {
+	documents := map[string][]byte{}
 	for _, lang := range captionSet.Languages() {
-		contents = append(contents, recreateLang(captionSet.GetCaptions(lang)))
+		var output bytes.Buffer
+		writer := bufio.NewWriter(&output)
+		recreateLang(writer, captionSet.GetCaptions(lang))
+		if err := writer.Flush(); err != nil {
+			return nil, err
+		}
+		documents[lang] = output.Bytes()
 	}
-	return strings.Join(contents, "MULTI-LANGUAGE SRT\n"), nil
+	return documents, nil
 }
 
-func recreateLang(captions []*caps.Caption) string {
-	content := ""
-	count := 1
-	for _, caption := range captions {
-		content += fmt.Sprintf("%s\n", strconv.Itoa(count))
+func recreateLang(output *bufio.Writer, captions []*caps.Caption) {
+	numbers := captionNumbers(captions)
+	for i, caption := range captions {
+		if i > 0 {
+			output.WriteString("\n")
+		}
+		fmt.Fprintf(output, "%d\n", numbers[i])
+		text := strings.ReplaceAll(formatNodes(caps.FlattenVoices(caption.Nodes)), "\n\n", "\n")
+		coordinates := formatCoordinates(caption.Placement, strings.Count(text, "\n")+1)
+		fmt.Fprintf(output, "%s %s %s%s\n", caption.Start.FormatSRT(), timecodeSeparator, caption.End.FormatSRT(), coordinates)
 
-		start := caption.FormatStartWithSeparator(",")
-		end := caption.FormatEndWithSeparator(",")
-		content += fmt.Sprintf("%s %s %s\n", start[:12], timecodeSeparator, end[:12])
+		// the coordinates are more precise than the {\anN} override
+		if n := alignment(caption.Placement); n != 2 && coordinates == "" {
+			fmt.Fprintf(output, "{\\an%d}", n)
+		}
+		output.WriteString(text)
+		output.WriteString("\n")
+	}
+}
 
-		lines := ""
-		for _, node := range caption.Nodes {
-			lines += recreateLine(node)
+// formatNodes renders the caption nodes as SRT text. SRT players only know the
+// <font>, <i>, <b> and <u> tags, so each style node opens the ones it needs and
+// its closing node closes them.
+func formatNodes(nodes []caps.CaptionContent) string {
+	content := strings.Builder{}
+	open := caps.MarkupStack{}
+	for _, node := range nodes {
+		switch {
+		case node.Text():
+			content.WriteString(node.Content())
+		case node.LineBreak():
+			content.WriteString("\n")
+		case node.Style():
+			style := node.(caps.CaptionStyle)
+			if style.Start {
+				markup, closing := styleMarkup(style.Props)
+				content.WriteString(markup)
+				open.Push(closing)
+			} else {
+				content.WriteString(open.Pop())
+			}
 		}
-		content += fmt.Sprintf("%s\n\n", strings.ReplaceAll(lines, "\n\n", "\n"))
-		count++
 	}
-	return content[:len(content)-1]
+	content.WriteString(open.PopAll())
+	return content.String()
 }
 
-func recreateLine(node caps.CaptionContent) string {
-	if node.Text() {
-		return node.Content()
+// styleMarkup returns the tags opening the style and the ones closing them. The
+// default white color is left to the player.
+func styleMarkup(style caps.StyleProps) (string, string) {
+	markup, closing := "", ""
+	if style.Color != "" && style.Color != caps.DefaultStyleProps().Color {
+		markup += fmt.Sprintf("<font color=\"%s\">", style.Color)
+		closing = "</font>"
+	}
+	for _, tag := range []struct {
+		name    string
+		enabled bool
+	}{{"i", style.Italics}, {"b", style.Bold}, {"u", style.Underline}} {
+		if tag.enabled {
+			markup += fmt.Sprintf("<%s>", tag.name)
+			closing = fmt.Sprintf("</%s>", tag.name) + closing
+		}
 	}
-	if node.LineBreak() {
-		return "\n"
+	return markup, closing
+}
+
+// captionNumbers returns the numbers of the captions, as read from an SRT file,
+// or their IDs when they are numeric, when they are all increasing, or the
+// numbers from 1 otherwise.
+func captionNumbers(captions []*caps.Caption) []int {
+	numbers := make([]int, len(captions))
+	for i, caption := range captions {
+		n, err := caption.Number, error(nil)
+		if n == 0 {
+			n, err = strconv.Atoi(caption.ID)
+		}
+		if err != nil || n <= 0 || (i > 0 && n <= numbers[i-1]) {
+			for i := range numbers {
+				numbers[i] = i + 1
+			}
+			return numbers
+		}
+		numbers[i] = n
 	}
-	return ""
+	return numbers
 }
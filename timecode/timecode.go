@@ -0,0 +1,242 @@
+// Package timecode converts SMPTE timecodes (HH:MM:SS:FF) from and to microseconds,
+// handling fractional NTSC frame rates and drop-frame counting.
+//
+// A timecode labels frames: its frame number is what matters, and the time of a
+// frame depends on the real frame rate of the video. For NTSC rates (e.g. 29.97fps)
+// non-drop-frame timecodes count 30 frames per timecode second, slowly drifting
+// away from the wall clock, while drop-frame timecodes skip some frame labels
+// (never frames) to stay in sync with it: the first 2 labels of every minute
+// (4 at 59.94fps), except for every tenth minute.
+package timecode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const microSecond int64 = 1000000
+
+// Rate is a frame rate and the way timecodes count frames at that rate.
+type Rate struct {
+	// Num and Den are the real frame rate as a fraction, e.g. 30000/1001 for 29.97fps.
+	Num int64
+	Den int64
+	// DropFrame is true for drop-frame timecodes, only valid for 29.97 and 59.94 rates.
+	DropFrame bool
+}
+
+var (
+	Rate23976    = Rate{24000, 1001, false}
+	Rate24       = Rate{24, 1, false}
+	Rate25       = Rate{25, 1, false}
+	Rate2997DF   = Rate{30000, 1001, true}
+	Rate2997NDF  = Rate{30000, 1001, false}
+	Rate30       = Rate{30, 1, false}
+	Rate50       = Rate{50, 1, false}
+	Rate5994DF   = Rate{60000, 1001, true}
+	Rate5994NDF  = Rate{60000, 1001, false}
+	Rate60       = Rate{60, 1, false}
+	supportedFPS = []Rate{Rate23976, Rate24, Rate25, Rate2997NDF, Rate30, Rate50, Rate5994NDF, Rate60}
+)
+
+// NewRate returns the rate for a nominal frame rate (the frames per timecode second)
+// and a multiplier, as used by TTML's ttp:frameRate and ttp:frameRateMultiplier,
+// e.g. NewRate(30, 1000, 1001, true) is 29.97 drop-frame.
+func NewRate(nominal, multiplierNum, multiplierDen int64, dropFrame bool) (Rate, error) {
+	if nominal <= 0 || multiplierNum <= 0 || multiplierDen <= 0 {
+		return Rate{}, fmt.Errorf("invalid frame rate %d*%d/%d", nominal, multiplierNum, multiplierDen)
+	}
+	r := Rate{nominal * multiplierNum, multiplierDen, dropFrame}
+	r.Num, r.Den = reduce(r.Num, r.Den)
+	if dropFrame && r.dropFrames() == 0 {
+		return Rate{}, fmt.Errorf("drop-frame is only supported at 29.97 and 59.94fps, not %s", r.FPSString())
+	}
+	return r, nil
+}
+
+// ParseRate parses a frame rate such as "29.97", "25" or "30000/1001".
+func ParseRate(s string, dropFrame bool) (Rate, error) {
+	var r Rate
+	if parts := strings.SplitN(s, "/", 2); len(parts) == 2 {
+		num, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+		if err != nil {
+			return Rate{}, fmt.Errorf("invalid frame rate %q", s)
+		}
+		den, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil || den == 0 {
+			return Rate{}, fmt.Errorf("invalid frame rate %q", s)
+		}
+		r = Rate{num, den, dropFrame}
+	} else {
+		fps, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return Rate{}, fmt.Errorf("invalid frame rate %q", s)
+		}
+		found := false
+		for _, supported := range supportedFPS {
+			if diff := supported.FPS() - fps; diff < 0.01 && diff > -0.01 {
+				r, found = supported, true
+				break
+			}
+		}
+		if !found {
+			return Rate{}, fmt.Errorf("unsupported frame rate %q", s)
+		}
+		r.DropFrame = dropFrame
+	}
+	return NewRate(r.Num, 1, r.Den, r.DropFrame)
+}
+
+// FPS returns the real frame rate.
+func (r Rate) FPS() float64 {
+	return float64(r.Num) / float64(r.Den)
+}
+
+// FPSString returns the frame rate with two decimals, e.g. "29.97".
+func (r Rate) FPSString() string {
+	return strconv.FormatFloat(r.FPS(), 'f', 2, 64)
+}
+
+// Nominal returns the number of frames per timecode second, e.g. 30 for 29.97fps.
+func (r Rate) Nominal() int64 {
+	return (r.Num + r.Den - 1) / r.Den
+}
+
+// dropFrames returns how many frame labels are skipped every minute, 0 when
+// drop-frame counting isn't supported by the rate.
+func (r Rate) dropFrames() int64 {
+	switch {
+	case r.Den != 1001:
+		return 0
+	case r.Num == 30000:
+		return 2
+	case r.Num == 60000:
+		return 4
+	}
+	return 0
+}
+
+// FramesToMicroseconds returns the time of the frame number n, rounded to microseconds.
+func (r Rate) FramesToMicroseconds(n int64) int64 {
+	return (n*r.Den*microSecond + r.Num/2) / r.Num
+}
+
+// MicrosecondsToFrames returns the number of the frame being displayed at the time us.
+// Since frame boundaries are rarely whole microseconds, times that were rounded
+// down to the microsecond still land in the frame they were computed from.
+func (r Rate) MicrosecondsToFrames(us int64) int64 {
+	n := us*r.Num + r.Num/2
+	d := r.Den * microSecond
+	if n < 0 {
+		return (n - d + 1) / d
+	}
+	return n / d
+}
+
+// Timecode is a SMPTE timecode at a given rate.
+type Timecode struct {
+	Hours   int64
+	Minutes int64
+	Seconds int64
+	Frames  int64
+	Rate    Rate
+}
+
+// Parse parses a "HH:MM:SS:FF" timecode. The separator before the frames can be
+// ';' or '.', which usually denotes drop-frame, but the rate decides how frames
+// are counted. Frames over the nominal rate are accepted and carried over.
+func Parse(s string, rate Rate) (Timecode, error) {
+	s = strings.TrimSpace(s)
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ':' || r == ';' || r == '.'
+	})
+	if len(fields) != 4 {
+		return Timecode{}, fmt.Errorf("invalid timecode %q", s)
+	}
+	values := make([]int64, 4)
+	for i, field := range fields {
+		v, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || v < 0 {
+			return Timecode{}, fmt.Errorf("invalid timecode %q", s)
+		}
+		values[i] = v
+	}
+	return Timecode{values[0], values[1], values[2], values[3], rate}, nil
+}
+
+// IsDropFrame reports whether the timecode string uses a drop-frame separator (';' or '.').
+func IsDropFrame(s string) bool {
+	return strings.ContainsAny(s, ";.")
+}
+
+// FromFrames returns the timecode labeling the frame number n.
+func FromFrames(n int64, rate Rate) Timecode {
+	if n < 0 {
+		n = 0
+	}
+	nominal := rate.Nominal()
+	if drop := rate.dropFrames(); rate.DropFrame && drop > 0 {
+		framesPerMinute := nominal*60 - drop
+		framesPer10Minutes := framesPerMinute*10 + drop
+		tens := n / framesPer10Minutes
+		rest := n % framesPer10Minutes
+		n += drop * 9 * tens
+		if rest > drop {
+			n += drop * ((rest - drop) / framesPerMinute)
+		}
+	}
+	return Timecode{
+		Hours:   n / (nominal * 3600),
+		Minutes: n / (nominal * 60) % 60,
+		Seconds: n / nominal % 60,
+		Frames:  n % nominal,
+		Rate:    rate,
+	}
+}
+
+// FromMicroseconds returns the timecode of the frame displayed at the time us.
+func FromMicroseconds(us int64, rate Rate) Timecode {
+	return FromFrames(rate.MicrosecondsToFrames(us), rate)
+}
+
+// FrameNumber returns the number of the frame labeled by the timecode.
+func (tc Timecode) FrameNumber() int64 {
+	nominal := tc.Rate.Nominal()
+	n := ((tc.Hours*60+tc.Minutes)*60+tc.Seconds)*nominal + tc.Frames
+	if drop := tc.Rate.dropFrames(); tc.Rate.DropFrame && drop > 0 {
+		minutes := tc.Hours*60 + tc.Minutes
+		n -= drop * (minutes - minutes/10)
+	}
+	return n
+}
+
+// Microseconds returns the time of the frame labeled by the timecode.
+func (tc Timecode) Microseconds() int64 {
+	return tc.Rate.FramesToMicroseconds(tc.FrameNumber())
+}
+
+// AddFrames returns the timecode n frames later.
+func (tc Timecode) AddFrames(n int64) Timecode {
+	return FromFrames(tc.FrameNumber()+n, tc.Rate)
+}
+
+// String returns the timecode as "HH:MM:SS:FF", or "HH:MM:SS;FF" for drop-frame timecodes.
+func (tc Timecode) String() string {
+	sep := ":"
+	if tc.Rate.DropFrame {
+		sep = ";"
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", tc.Hours, tc.Minutes, tc.Seconds, sep, tc.Frames)
+}
+
+func reduce(a, b int64) (int64, int64) {
+	x, y := a, b
+	for y != 0 {
+		x, y = y, x%y
+	}
+	if x == 0 {
+		return a, b
+	}
+	return a / x, b / x
+}
@@ -0,0 +1,100 @@
+package timecode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames int64
+		rate   Rate
+		want   string
+	}{
+		{"29.97 NDF", 1800, Rate2997NDF, "00:01:00:00"},
+		{"29.97 DF last frame of minute 0", 1799, Rate2997DF, "00:00:59;29"},
+		{"29.97 DF first minute", 1800, Rate2997DF, "00:01:00;02"},
+		{"29.97 DF tenth minute", 17982, Rate2997DF, "00:10:00;00"},
+		{"29.97 DF one hour", 107892, Rate2997DF, "01:00:00;00"},
+		{"59.94 DF last frame of minute 0", 3599, Rate5994DF, "00:00:59;59"},
+		{"59.94 DF first minute", 3600, Rate5994DF, "00:01:00;04"},
+		{"25", 90000, Rate25, "01:00:00:00"},
+		{"23.976", 1441, Rate23976, "00:01:00:01"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tc := FromFrames(test.frames, test.rate)
+			assert.Equal(t, test.want, tc.String())
+			assert.Equal(t, test.frames, tc.FrameNumber())
+		})
+	}
+}
+
+func TestDropFrameRoundTrip(t *testing.T) {
+	for _, rate := range []Rate{Rate2997DF, Rate5994DF} {
+		for n := int64(0); n < 200000; n += 7 {
+			tc := FromFrames(n, rate)
+			assert.Equal(t, n, tc.FrameNumber())
+			assert.Equal(t, n, FromMicroseconds(tc.Microseconds(), rate).FrameNumber())
+		}
+	}
+}
+
+func TestMicroseconds(t *testing.T) {
+	tests := []struct {
+		input string
+		rate  Rate
+		want  int64
+	}{
+		{"01:00:00:00", Rate2997NDF, 3603600000},
+		{"01:00:00;00", Rate2997DF, 3599996400},
+		{"00:00:01:00", Rate30, 1000000},
+		{"00:00:01:12", Rate25, 1480000},
+		{"00:00:00:01", Rate23976, 41708},
+		{"00:00:00:30", Rate60, 500000},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			tc, err := Parse(test.input, test.rate)
+			assert.Nil(t, err)
+			assert.Equal(t, test.want, tc.Microseconds())
+			assert.Equal(t, test.input, FromMicroseconds(test.want, test.rate).String())
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tc, err := Parse("00:00:09;05", Rate2997DF)
+	assert.Nil(t, err)
+	assert.Equal(t, Timecode{0, 0, 9, 5, Rate2997DF}, tc)
+	assert.True(t, IsDropFrame("00:00:09;05"))
+	assert.False(t, IsDropFrame("00:00:09:05"))
+	assert.Equal(t, "00:00:10;05", tc.AddFrames(30).String())
+
+	_, err = Parse("00:00:09", Rate30)
+	assert.Equal(t, `invalid timecode "00:00:09"`, err.Error())
+	_, err = Parse("00:00:xx:00", Rate30)
+	assert.Equal(t, `invalid timecode "00:00:xx:00"`, err.Error())
+}
+
+func TestRate(t *testing.T) {
+	rate, err := ParseRate("29.97", true)
+	assert.Nil(t, err)
+	assert.Equal(t, Rate2997DF, rate)
+	rate, err = ParseRate("30000/1001", false)
+	assert.Nil(t, err)
+	assert.Equal(t, Rate2997NDF, rate)
+	assert.Equal(t, int64(30), rate.Nominal())
+	assert.Equal(t, "29.97", rate.FPSString())
+
+	rate, err = NewRate(30, 1000, 1001, true)
+	assert.Nil(t, err)
+	assert.Equal(t, Rate2997DF, rate)
+
+	_, err = NewRate(25, 1, 1, true)
+	assert.Equal(t, "drop-frame is only supported at 29.97 and 59.94fps, not 25.00", err.Error())
+	_, err = ParseRate("12.5", false)
+	assert.Equal(t, `unsupported frame rate "12.5"`, err.Error())
+}
@@ -0,0 +1,143 @@
+package caps
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	microMilli  int64 = 1000
+	microSecond int64 = 1000 * microMilli
+	microMinute int64 = 60 * microSecond
+	microHour   int64 = 60 * microMinute
+)
+
+// Timestamp is a caption time with microsecond precision.
+// The zero value is an unset timestamp, which is different from a timestamp at 0.
+// Arithmetic on an unset timestamp returns an unset timestamp and formatting
+// it formats the time 0.
+type Timestamp struct {
+	micro int64
+	set   bool
+}
+
+// NewTimestamp returns a timestamp set to the given amount of microseconds.
+func NewTimestamp(microseconds int64) Timestamp {
+	return Timestamp{microseconds, true}
+}
+
+// TimestampFromDuration returns a timestamp set to d, truncated to microseconds.
+func TimestampFromDuration(d time.Duration) Timestamp {
+	return NewTimestamp(d.Microseconds())
+}
+
+// IsSet reports whether the timestamp has a value.
+func (t Timestamp) IsSet() bool {
+	return t.set
+}
+
+// Microseconds returns the timestamp in microseconds, 0 if it's unset.
+func (t Timestamp) Microseconds() int64 {
+	return t.micro
+}
+
+// Milliseconds returns the timestamp in milliseconds, 0 if it's unset.
+func (t Timestamp) Milliseconds() int64 {
+	return t.micro / microMilli
+}
+
+// Duration returns the timestamp as a time.Duration from the time 0.
+func (t Timestamp) Duration() time.Duration {
+	return time.Duration(t.micro) * time.Microsecond
+}
+
+// Add returns the timestamp shifted by d.
+func (t Timestamp) Add(d time.Duration) Timestamp {
+	if !t.set {
+		return t
+	}
+	return NewTimestamp(t.micro + d.Microseconds())
+}
+
+// Sub returns the duration t-u, 0 if any of them is unset.
+func (t Timestamp) Sub(u Timestamp) time.Duration {
+	if !t.set || !u.set {
+		return 0
+	}
+	return time.Duration(t.micro-u.micro) * time.Microsecond
+}
+
+// Compare returns -1, 0 or 1 if t is before, equal or after u.
+// Unset timestamps are before any set timestamp.
+func (t Timestamp) Compare(u Timestamp) int {
+	switch {
+	case t.set != u.set:
+		if t.set {
+			return 1
+		}
+		return -1
+	case t.micro < u.micro:
+		return -1
+	case t.micro > u.micro:
+		return 1
+	}
+	return 0
+}
+
+// Before reports whether t is before u.
+func (t Timestamp) Before(u Timestamp) bool {
+	return t.Compare(u) < 0
+}
+
+// After reports whether t is after u.
+func (t Timestamp) After(u Timestamp) bool {
+	return t.Compare(u) > 0
+}
+
+// Equal reports whether t and u are the same time, or both unset.
+func (t Timestamp) Equal(u Timestamp) bool {
+	return t.Compare(u) == 0
+}
+
+// Format returns the timestamp as "HH:MM:SS.mmm", using sep between the seconds and the milliseconds.
+func (t Timestamp) Format(sep string) string {
+	value := t.micro
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	hours := value / microHour
+	minutes := value % microHour / microMinute
+	seconds := value % microMinute / microSecond
+	millis := value % microSecond / microMilli
+	return fmt.Sprintf("%s%02d:%02d:%02d%s%03d", sign, hours, minutes, seconds, sep, millis)
+}
+
+// FormatSRT returns the timestamp in the SRT syntax, "HH:MM:SS,mmm".
+func (t Timestamp) FormatSRT() string {
+	return t.Format(",")
+}
+
+// FormatWebVTT returns the timestamp in the WebVTT syntax, "HH:MM:SS.mmm".
+func (t Timestamp) FormatWebVTT() string {
+	return t.Format(".")
+}
+
+// FormatDFXP returns the timestamp as a TTML clock time, "HH:MM:SS.mmm".
+func (t Timestamp) FormatDFXP() string {
+	return t.Format(".")
+}
+
+// FormatSAMI returns the timestamp as used by SAMI SYNC tags, in milliseconds.
+func (t Timestamp) FormatSAMI() string {
+	return fmt.Sprintf("%d", t.Milliseconds())
+}
+
+// String returns the timestamp as "HH:MM:SS.mmm", or "unset".
+func (t Timestamp) String() string {
+	if !t.set {
+		return "unset"
+	}
+	return t.Format(".")
+}
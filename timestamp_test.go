@@ -0,0 +1,59 @@
+package caps
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampUnset(t *testing.T) {
+	var unset Timestamp
+	assert.False(t, unset.IsSet())
+	assert.True(t, NewTimestamp(0).IsSet())
+	assert.False(t, unset.Equal(NewTimestamp(0)))
+	assert.True(t, unset.Before(NewTimestamp(0)))
+	assert.False(t, unset.Add(time.Second).IsSet())
+	assert.Equal(t, time.Duration(0), unset.Sub(NewTimestamp(10)))
+	assert.Equal(t, "00:00:00.000", unset.FormatWebVTT())
+	assert.Equal(t, "unset", unset.String())
+}
+
+func TestTimestampArithmetic(t *testing.T) {
+	start := NewTimestamp(1500000)
+	end := start.Add(2500 * time.Millisecond)
+	assert.Equal(t, int64(4000000), end.Microseconds())
+	assert.Equal(t, 2500*time.Millisecond, end.Sub(start))
+	assert.Equal(t, -2500*time.Millisecond, start.Sub(end))
+	assert.True(t, start.Before(end))
+	assert.True(t, end.After(start))
+	assert.Equal(t, 0, end.Compare(TimestampFromDuration(4*time.Second)))
+	assert.Equal(t, 4*time.Second, end.Duration())
+	assert.Equal(t, int64(4000), end.Milliseconds())
+}
+
+func TestTimestampFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     Timestamp
+		wantSRT   string
+		wantVTT   string
+		wantDFXP  string
+		wantSAMI  string
+		wantOther string
+	}{
+		{"zero", NewTimestamp(0), "00:00:00,000", "00:00:00.000", "00:00:00.000", "0", "00:00:00:000"},
+		{"milliseconds", NewTimestamp(9209999), "00:00:09,209", "00:00:09.209", "00:00:09.209", "9209", "00:00:09:209"},
+		{"hours", NewTimestamp(86399999000), "23:59:59,999", "23:59:59.999", "23:59:59.999", "86399999", "23:59:59:999"},
+		{"over a day", NewTimestamp(90000000000), "25:00:00,000", "25:00:00.000", "25:00:00.000", "90000000", "25:00:00:000"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.wantSRT, test.input.FormatSRT())
+			assert.Equal(t, test.wantVTT, test.input.FormatWebVTT())
+			assert.Equal(t, test.wantDFXP, test.input.FormatDFXP())
+			assert.Equal(t, test.wantSAMI, test.input.FormatSAMI())
+			assert.Equal(t, test.wantOther, test.input.Format(":"))
+		})
+	}
+}
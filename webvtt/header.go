@@ -0,0 +1,236 @@
+package webvtt
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vimeo/caps"
+)
+
+// Header blocks, found between the WEBVTT line and the first cue, and NOTE
+// blocks, found anywhere between cues.
+const (
+	regionBlock = "REGION"
+	styleBlock  = "STYLE"
+	noteBlock   = "NOTE"
+	// cueStyleID is the ID of the style of the "::cue" selector, applying to all cues.
+	cueStyleID = "cue"
+)
+
+var (
+	cssCommentPattern = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cueSelector       = regexp.MustCompile(`^::cue(?:\(\s*\.([^\s()]+)\s*\))?$`)
+)
+
+// parseRegion returns the region defined by the settings of a REGION block, one
+// "name:value" per line or separated by spaces. Invalid settings are ignored and
+// regions without an ID are dropped.
+func parseRegion(lines []string) (caps.Region, bool) {
+	region := caps.NewRegion("")
+	for _, line := range lines {
+		for _, setting := range strings.Fields(line) {
+			parts := strings.SplitN(setting, ":", 2)
+			if len(parts) != 2 || parts[1] == "" {
+				continue
+			}
+			name, value := parts[0], parts[1]
+			switch name {
+			case "id":
+				if !strings.Contains(value, webvttTiming) {
+					region.ID = value
+				}
+			case "width":
+				if offset, ok := parsePercent(value); ok {
+					region.Width = offset.Value()
+				}
+			case "lines":
+				if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+					region.Lines = n
+				}
+			case "regionanchor":
+				if point, ok := parsePoint(value); ok {
+					region.RegionAnchor = point
+				}
+			case "viewportanchor":
+				if point, ok := parsePoint(value); ok {
+					region.ViewportAnchor = point
+				}
+			case "scroll":
+				region.Scroll = value == "up"
+			}
+		}
+	}
+	return region, region.ID != ""
+}
+
+// parsePoint parses a "x%,y%" anchor.
+func parsePoint(value string) (caps.Point, bool) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return caps.Point{}, false
+	}
+	x, ok := parsePercent(parts[0])
+	if !ok {
+		return caps.Point{}, false
+	}
+	y, ok := parsePercent(parts[1])
+	if !ok {
+		return caps.Point{}, false
+	}
+	return caps.Point{X: x.Value(), Y: y.Value()}, true
+}
+
+// formatRegion returns the REGION block of the region, without the settings
+// left to their default value.
+func formatRegion(region caps.Region) string {
+	defaults := caps.NewRegion(region.ID)
+	output := strings.Builder{}
+	output.WriteString(regionBlock + "\n")
+	output.WriteString("id:" + region.ID + "\n")
+	if region.Width != defaults.Width {
+		output.WriteString("width:" + caps.NewPercentOffset(region.Width).String() + "\n")
+	}
+	if region.Lines != defaults.Lines {
+		output.WriteString("lines:" + strconv.Itoa(region.Lines) + "\n")
+	}
+	if region.RegionAnchor != defaults.RegionAnchor {
+		output.WriteString("regionanchor:" + formatPoint(region.RegionAnchor) + "\n")
+	}
+	if region.ViewportAnchor != defaults.ViewportAnchor {
+		output.WriteString("viewportanchor:" + formatPoint(region.ViewportAnchor) + "\n")
+	}
+	if region.Scroll {
+		output.WriteString("scroll:up\n")
+	}
+	return output.String()
+}
+
+func formatPoint(point caps.Point) string {
+	return caps.NewPercentOffset(point.X).String() + "," + caps.NewPercentOffset(point.Y).String()
+}
+
+// parseStyles parses the CSS of STYLE blocks. Only "::cue" rules, stored with the
+// "cue" ID, and "::cue(.class)" rules, stored with the class name as both ID and
+// Class, are kept: other selectors can't be represented by caps.StyleProps.
+// Rules for the same selector are merged in order.
+func parseStyles(css string) []caps.StyleProps {
+	css = cssCommentPattern.ReplaceAllString(css, "")
+	styles := map[string]caps.StyleProps{}
+	order := []string{}
+	for {
+		open := strings.Index(css, "{")
+		if open < 0 {
+			break
+		}
+		end := strings.Index(css[open:], "}")
+		if end < 0 {
+			end = len(css) - open
+		}
+		declarations := css[open+1 : open+end]
+		for _, selector := range strings.Split(css[:open], ",") {
+			matches := cueSelector.FindStringSubmatch(strings.TrimSpace(selector))
+			if matches == nil {
+				continue
+			}
+			id, class := cueStyleID, matches[1]
+			if class != "" {
+				id = class
+			}
+			style, ok := styles[id]
+			if !ok {
+				style = caps.StyleProps{ID: id, Class: class}
+				order = append(order, id)
+			}
+			applyDeclarations(&style, declarations)
+			styles[id] = style
+		}
+		if open+end+1 >= len(css) {
+			break
+		}
+		css = css[open+end+1:]
+	}
+	parsed := []caps.StyleProps{}
+	for _, id := range order {
+		parsed = append(parsed, styles[id])
+	}
+	return parsed
+}
+
+// applyDeclarations sets the StyleProps fields matching a "property: value; ..." list.
+func applyDeclarations(style *caps.StyleProps, declarations string) {
+	for _, declaration := range strings.Split(declarations, ";") {
+		parts := strings.SplitN(declaration, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.ToLower(strings.TrimSpace(parts[0])) {
+		case "font-family":
+			style.FontFamily = value
+		case "font-size":
+			style.FontSize = value
+		case "color":
+			style.Color = value
+		case "font-style":
+			style.Italics = value == "italic"
+		case "font-weight":
+			style.Bold = value == "bold"
+		case "text-decoration":
+			style.Underline = value == "underline"
+		}
+	}
+}
+
+// formatStyles returns the STYLE block of the "cue" style and of the styles with
+// a class, sorted by ID, or an empty string when there are none.
+func formatStyles(styles map[string]caps.StyleProps) string {
+	ids := []string{}
+	for id, style := range styles {
+		if id == cueStyleID || style.Class != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+	sort.Strings(ids)
+	output := strings.Builder{}
+	output.WriteString(styleBlock + "\n")
+	for _, id := range ids {
+		style := styles[id]
+		selector := "::cue"
+		if id != cueStyleID {
+			selector = fmt.Sprintf("::cue(.%s)", style.Class)
+		}
+		output.WriteString(fmt.Sprintf("%s {%s}\n", selector, styleToCSS(style)))
+	}
+	return output.String()
+}
+
+func styleToCSS(style caps.StyleProps) string {
+	css := strings.Builder{}
+	add := func(property, value string) {
+		if value != "" {
+			css.WriteString(fmt.Sprintf(" %s: %s;", property, value))
+		}
+	}
+	add("font-family", style.FontFamily)
+	add("font-size", style.FontSize)
+	add("color", style.Color)
+	if style.Italics {
+		add("font-style", "italic")
+	}
+	if style.Bold {
+		add("font-weight", "bold")
+	}
+	if style.Underline {
+		add("text-decoration", "underline")
+	}
+	if css.Len() == 0 {
+		return ""
+	}
+	return css.String() + " "
+}
@@ -0,0 +1,167 @@
+package webvtt
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/vimeo/caps"
+)
+
+// colorClasses are the classes of the default WebVTT stylesheet setting the text color.
+var colorClasses = map[string]bool{
+	"white": true, "lime": true, "cyan": true, "red": true,
+	"yellow": true, "magenta": true, "blue": true, "black": true,
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// cueTag is a tag of the cue text, e.g. "<v.loud Bob>" has the "v" name, the
+// "loud" class and the "Bob" annotation.
+type cueTag struct {
+	name       string
+	class      string
+	annotation string
+}
+
+// parseTag parses the inside of a start tag, e.g. "c.yellow.bg_blue".
+func parseTag(inside string) cueTag {
+	tag := cueTag{}
+	if i := strings.IndexAny(inside, " \t\n\f"); i >= 0 {
+		tag.annotation = html.UnescapeString(strings.TrimSpace(inside[i+1:]))
+		inside = inside[:i]
+	}
+	parts := strings.Split(inside, ".")
+	tag.name = parts[0]
+	classes := []string{}
+	for _, class := range parts[1:] {
+		if class != "" {
+			classes = append(classes, class)
+		}
+	}
+	tag.class = strings.Join(classes, " ")
+	return tag
+}
+
+// node returns the node opening (or closing) the tag, false for unknown tags.
+func (t cueTag) node(start bool) (caps.CaptionContent, bool) {
+	switch t.name {
+	case "c", "i", "b", "u":
+		style := caps.StyleProps{Class: t.class}
+		style.Italics = t.name == "i"
+		style.Bold = t.name == "b"
+		style.Underline = t.name == "u"
+		return caps.NewCaptionStyle(start, style), true
+	case "v":
+		return caps.NewCaptionSpan(start, caps.SpanVoice, t.annotation, t.class), true
+	case "lang":
+		return caps.NewCaptionSpan(start, caps.SpanLang, t.annotation, t.class), true
+	case "ruby":
+		return caps.NewCaptionSpan(start, caps.SpanRuby, "", t.class), true
+	case "rt":
+		return caps.NewCaptionSpan(start, caps.SpanRubyText, "", t.class), true
+	}
+	return nil, false
+}
+
+// parseCueText returns the nodes of the text of a cue, with a style node for each
+// <c>, <i>, <b> and <u> tag and a span node for each <v>, <lang>, <ruby> and <rt>
+// tag. Unknown tags are ignored and, as in the WebVTT rendering rules, misnested
+// and unclosed tags are closed like caps.TagStack does. Timestamp tags are kept
+// as caps.CaptionTimestamp nodes.
+func parseCueText(text string) []caps.CaptionContent {
+	nodes := []caps.CaptionContent{}
+	open := caps.TagStack{}
+	addText := func(text string) {
+		for i, line := range strings.Split(html.UnescapeString(text), "\n") {
+			if i > 0 {
+				nodes = append(nodes, caps.NewLineBreak())
+			}
+			if line != "" {
+				nodes = append(nodes, caps.NewCaptionText(line))
+			}
+		}
+	}
+	for text != "" {
+		start := strings.Index(text, "<")
+		if start < 0 {
+			addText(text)
+			break
+		}
+		addText(text[:start])
+		end := strings.Index(text[start:], ">")
+		if end < 0 {
+			break
+		}
+		inside := text[start+1 : start+end]
+		text = text[start+end+1:]
+		if strings.HasPrefix(inside, "/") {
+			nodes = append(nodes, open.Close(strings.TrimSpace(inside[1:]))...)
+			continue
+		}
+		if timestamp, err := parseTimestamp(inside); err == nil && timestamp.IsSet() {
+			nodes = append(nodes, caps.NewCaptionTimestamp(timestamp))
+			continue
+		}
+		tag := parseTag(inside)
+		if node, ok := tag.node(true); ok {
+			closing, _ := tag.node(false)
+			nodes = append(nodes, node)
+			open.Open(tag.name, closing)
+		}
+	}
+	return append(nodes, open.CloseAll()...)
+}
+
+// styleTags returns the tags rendering a style: <i>, <b> and <u> for the matching
+// properties, or <c> when none is set, the first one holding the classes of the
+// style. Colors of the default stylesheet are rendered as classes.
+func styleTags(style caps.StyleProps) []cueTag {
+	tags := []cueTag{}
+	for _, tag := range []struct {
+		name    string
+		enabled bool
+	}{{"i", style.Italics}, {"b", style.Bold}, {"u", style.Underline}} {
+		if tag.enabled {
+			tags = append(tags, cueTag{name: tag.name})
+		}
+	}
+	if len(tags) == 0 {
+		tags = append(tags, cueTag{name: "c"})
+	}
+	tags[0].class = style.Class
+	if style.Class == "" && colorClasses[style.Color] && style.Color != caps.DefaultStyleProps().Color {
+		tags[0].class = style.Color
+	}
+	return tags
+}
+
+func spanTag(span caps.CaptionSpan) cueTag {
+	tag := cueTag{class: span.Class}
+	switch span.Kind {
+	case caps.SpanVoice:
+		tag.name, tag.annotation = "v", span.Value
+	case caps.SpanLang:
+		tag.name, tag.annotation = "lang", span.Value
+	case caps.SpanRuby:
+		tag.name = "ruby"
+	case caps.SpanRubyText:
+		tag.name = "rt"
+	}
+	return tag
+}
+
+func (t cueTag) start() string {
+	tag := t.name
+	if t.class != "" {
+		tag += "." + strings.ReplaceAll(t.class, " ", ".")
+	}
+	if t.annotation != "" {
+		tag += " " + textEscaper.Replace(t.annotation)
+	}
+	return fmt.Sprintf("<%s>", tag)
+}
+
+func (t cueTag) end() string {
+	return fmt.Sprintf("</%s>", t.name)
+}
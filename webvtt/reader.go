@@ -1,8 +1,10 @@
 package webvtt
 
 import (
+	"bufio"
 	"bytes"
-	"fmt"
+	"errors"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
@@ -12,76 +14,256 @@ import (
 
 type Reader struct {
 	ignoreTimingErrors bool
+	recovery           caps.Recovery
+	warn               caps.WarningFunc
 }
 
 const (
-	bitSize64  int     = 64
-	secHr      float64 = 3600
-	secMin     float64 = 60
-	microSec   float64 = 1000000
-	microMilli float64 = 1000
+	format     string = "webvtt"
+	base10     int    = 10
+	bitSize64  int    = 64
+	secHr      int64  = 3600
+	secMin     int64  = 60
+	microSec   int64  = 1000000
+	microMilli int64  = 1000
 )
 
 var (
 	timingPattern    = regexp.MustCompile("^(.+?) --> (.+)")
 	timestampPattern = regexp.MustCompile(`^(\d+):(\d{2}):?(\d{2})?\.(\d{3})`)
-	voiceSpanPattern = regexp.MustCompile(`<v(\\.\\w+)* ([^>]*)>`)
-	otherSpanPattern = regexp.MustCompile("</?([cibuv]|ruby|rt|lang).*?>")
 	webvttTiming     = "-->"
 )
 
+var (
+	errInvalidTiming       = errors.New("invalid timing format")
+	errInvalidStart        = errors.New("invalid cue start timestamp")
+	errInvalidEnd          = errors.New("invalid cue end timestamp")
+	errEndBeforeStart      = errors.New("end timestamp is not greater than start timestamp")
+	errStartBeforePrevious = errors.New("start timestamp is not greater to start timestamp of previous cue")
+)
+
 func (r *Reader) Read(content []byte) (*caps.CaptionSet, error) {
+	return r.ReadStream(bytes.NewReader(content))
+}
+
+// ReadStream decodes the cues as their lines are read from in.
+func (r *Reader) ReadStream(in io.Reader) (*caps.CaptionSet, error) {
+	captionSet, warnings, err := r.read(in, r.recovery)
+	r.warn.Report(warnings)
+	return captionSet, err
+}
+
+// WithRecovery returns a copy of the reader recovering from the invalid cues.
+// Timings are always validated, whatever the ignoreTimingErrors option.
+func (r *Reader) WithRecovery(recovery caps.Recovery, warn caps.WarningFunc) caps.CaptionReader {
+	return &Reader{ignoreTimingErrors: r.ignoreTimingErrors, recovery: recovery, warn: warn}
+}
+
+func (r *Reader) read(in io.Reader, recovery caps.Recovery) (*caps.CaptionSet, []caps.Warning, error) {
 	captionSet := caps.NewCaptionSet()
-	captions, err := r.parse(caps.SplitLines(string(content)))
+	captions, warnings, err := r.parse(caps.NewLineScanner(in), recovery, captionSet)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing webvtt: %w", err)
+		return nil, nil, err
 	}
 	captionSet.SetCaptions(caps.DefaultLang, captions)
 	if captionSet.IsEmpty() {
-		return nil, fmt.Errorf("empty caption file")
+		return nil, nil, caps.NewEmptyFileError(format)
 	}
-	return captionSet, nil
+	return captionSet, warnings, nil
 }
 
-func (r *Reader) parse(lines []string) ([]*caps.Caption, error) {
+// parse returns the cues read by scanner, adding the regions and styles defined
+// by the header blocks to captionSet.
+func (r *Reader) parse(scanner *bufio.Scanner, recovery caps.Recovery, captionSet *caps.CaptionSet) ([]*caps.Caption, []caps.Warning, error) {
 	captions := []*caps.Caption{}
+	warnings := []caps.Warning{}
+	// timingLines holds the line number of the timing of each caption
+	timingLines := []int{}
+	timingLine := 0
 	foundTiming := false
 	var caption *caps.Caption
+	// payload holds the lines of the text of caption
+	payload := []string{}
 	var err error
-	for i, line := range lines {
-		line = strings.TrimSpace(line)
+	// block is the REGION, STYLE or NOTE block being read, made of blockLines
+	block := ""
+	blockLines := []string{}
+	foundCue := false
+	// blockStart is true when the line follows a blank line, where identifiers
+	// and blocks may start
+	blockStart := false
+	cueID := ""
+	// notes holds the notes waiting for the start of the next cue
+	notes := []caps.Note{}
+	addNotes := func(time caps.Timestamp) {
+		for _, note := range notes {
+			note.Time = time
+			captionSet.Notes = append(captionSet.Notes, note)
+		}
+		notes = []caps.Note{}
+	}
+	addBlock := func() {
+		if block == noteBlock {
+			notes = append(notes, caps.Note{Text: strings.Join(blockLines, "\n")})
+		} else {
+			addHeaderBlock(captionSet, block, blockLines)
+		}
+		block = ""
+	}
+	addCaption := func() {
+		if caption != nil {
+			caption.Nodes = parseCueText(strings.Join(payload, "\n"))
+		}
+		payload = []string{}
+		if caption != nil && !caption.IsEmpty() {
+			captions = append(captions, caption)
+			timingLines = append(timingLines, timingLine)
+		}
+	}
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		isBlockStart := blockStart
+		blockStart = line == ""
+		if block != "" {
+			if line != "" && !strings.Contains(line, webvttTiming) {
+				blockLines = append(blockLines, line)
+				continue
+			}
+			addBlock()
+			if line == "" {
+				continue
+			}
+		}
+		if !foundCue && (line == regionBlock || line == styleBlock) {
+			block, blockLines = line, []string{}
+			continue
+		}
+		if isBlockStart && !foundTiming && isNote(line) {
+			block, blockLines = noteBlock, []string{}
+			if text := strings.TrimSpace(strings.TrimPrefix(line, noteBlock)); text != "" {
+				blockLines = append(blockLines, text)
+			}
+			continue
+		}
 		if strings.Contains(line, webvttTiming) {
+			foundCue = true
 			foundTiming = true
-			timingLine := i
-			lastStartTime := 0.0
+			timingLine = lineNumber
+			payload = []string{}
+			if recovery != caps.Strict {
+				caption, err = parseLenientTimingLine(line, recovery)
+				if caption != nil {
+					caption.ID = cueID
+					addNotes(caption.Start)
+				}
+				cueID = ""
+				if err != nil {
+					parseErr := timingError(scanner.Text(), lineNumber, err)
+					action := caps.ActionSkipped
+					if caption != nil {
+						action = caps.ActionRepaired
+					}
+					warnings = append(warnings, caps.Warning{Err: parseErr, Action: action})
+					// the text of a skipped cue is ignored
+					foundTiming = caption != nil
+				}
+				continue
+			}
+			lastStartTime := caps.NewTimestamp(0)
 			if len(captions) != 0 {
-				lastStartTime = *captions[len(captions)-1].Start
+				lastStartTime = captions[len(captions)-1].Start
 			}
 			caption, err = parseTimingLine(line, lastStartTime, r.ignoreTimingErrors)
 			if err != nil {
-				return nil, fmt.Errorf("error parsing timing line %d: %w", timingLine, err)
+				return nil, nil, timingError(scanner.Text(), lineNumber, err)
 			}
+			caption.ID = cueID
+			cueID = ""
+			addNotes(caption.Start)
 		} else if line == "" {
+			cueID = ""
 			if foundTiming {
 				foundTiming = false
-				if caption != nil && !caption.IsEmpty() {
-					captions = append(captions, caption)
-				}
+				addCaption()
 				caption = nil
 			}
+		} else if foundTiming {
+			payload = append(payload, line)
+		} else if isBlockStart {
+			// the first line of a cue block is its identifier
+			cueID = line
 		} else {
-			if foundTiming {
-				if caption != nil && !caption.IsEmpty() {
-					caption.Nodes = append(caption.Nodes, caps.NewLineBreak())
-				}
-				caption.Nodes = append(caption.Nodes, caps.NewCaptionText(removeStyles(line)))
-			}
+			cueID = ""
 		}
 	}
-	if caption != nil && !caption.IsEmpty() {
-		captions = append(captions, caption)
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if block != "" {
+		addBlock()
+	}
+	addCaption()
+	// the notes following the last cue are placed at its end
+	if len(captions) > 0 {
+		addNotes(captions[len(captions)-1].End)
+	} else {
+		addNotes(caps.Timestamp{})
+	}
+	captions, timingWarnings := caps.RecoverTimings(format, captions, timingLines, recovery)
+	return captions, append(warnings, timingWarnings...), nil
+}
+
+// addHeaderBlock adds the region or the styles defined by a header block to captionSet.
+func addHeaderBlock(captionSet *caps.CaptionSet, block string, lines []string) {
+	if block == styleBlock {
+		for _, style := range parseStyles(strings.Join(lines, "\n")) {
+			captionSet.AddStyle(style)
+		}
+		return
+	}
+	if region, ok := parseRegion(lines); ok {
+		captionSet.AddRegion(region)
 	}
-	return captions, nil
+}
+
+// parseLenientTimingLine parses a timing line without validating the timings, which is
+// left to caps.RecoverTimings. With caps.Repair, timestamps using ',' as the decimal
+// separator are accepted, the repaired caption being returned along with the error.
+func parseLenientTimingLine(line string, recovery caps.Recovery) (*caps.Caption, error) {
+	caption, err := parseTimingLine(line, caps.Timestamp{}, true)
+	if err == nil && caption.Start.IsSet() && caption.End.IsSet() {
+		return caption, nil
+	}
+	if err == nil {
+		err = errInvalidStart
+		if caption.Start.IsSet() {
+			err = errInvalidEnd
+		}
+	}
+	if recovery == caps.Repair {
+		repaired, repairErr := parseTimingLine(repairTimingLine(line), caps.Timestamp{}, true)
+		if repairErr == nil && repaired.Start.IsSet() && repaired.End.IsSet() {
+			return repaired, err
+		}
+	}
+	return nil, err
+}
+
+// repairTimingLine replaces ',' with '.' in the timestamps of the line, leaving the
+// cue settings untouched.
+func repairTimingLine(line string) string {
+	matches := timingPattern.FindStringSubmatch(line)
+	if len(matches) < 3 || strings.TrimSpace(matches[2]) == "" {
+		return line
+	}
+	fields := strings.Fields(matches[2])
+	fields[0] = strings.ReplaceAll(fields[0], ",", ".")
+	return strings.ReplaceAll(matches[1], ",", ".") + " --> " + strings.Join(fields, " ")
+}
+
+// isNote reports whether the line starts a NOTE block.
+func isNote(line string) bool {
+	return line == noteBlock || strings.HasPrefix(line, noteBlock+" ") || strings.HasPrefix(line, noteBlock+"\t")
 }
 
 func (r Reader) Detect(content []byte) bool {
@@ -89,40 +271,64 @@ func (r Reader) Detect(content []byte) bool {
 }
 
 // Reader helpers
-func microseconds(h, m, s, f string) (float64, error) {
-	hh, err := strconv.ParseFloat(h, bitSize64)
+
+// timingError returns the ParseError for an error returned by parseTimingLine,
+// pointing at the start or end timestamp of the line when it's the culprit.
+func timingError(line string, lineNumber int, err error) *caps.ParseError {
+	parseErr := &caps.ParseError{Format: format, Line: lineNumber, Column: 1, Snippet: strings.TrimSpace(line), Code: caps.ErrCodeTimestamp, Err: err}
+	matches := timingPattern.FindStringSubmatch(strings.TrimSpace(line))
+	switch {
+	case errors.Is(err, errInvalidTiming):
+		parseErr.Code = caps.ErrCodeMalformed
+	case errors.Is(err, errEndBeforeStart), errors.Is(err, errStartBeforePrevious):
+		parseErr.Code = caps.ErrCodeTiming
+	case errors.Is(err, errInvalidEnd) && len(matches) == 3 && strings.TrimSpace(matches[2]) != "":
+		parseErr.Snippet = strings.Fields(matches[2])[0]
+	case len(matches) == 3:
+		parseErr.Snippet = matches[1]
+	}
+	if column := strings.Index(line, parseErr.Snippet); column >= 0 {
+		parseErr.Column = column + 1
+	}
+	return parseErr
+}
+
+func microseconds(h, m, s, f string) (int64, error) {
+	hh, err := strconv.ParseInt(h, base10, bitSize64)
 	if err != nil {
 		return 0, err
 	}
-	mm, err := strconv.ParseFloat(m, bitSize64)
+	mm, err := strconv.ParseInt(m, base10, bitSize64)
 	if err != nil {
 		return 0, err
 	}
-	ss, err := strconv.ParseFloat(s, bitSize64)
+	ss, err := strconv.ParseInt(s, base10, bitSize64)
 	if err != nil {
 		return 0, err
 	}
-	ff, err := strconv.ParseFloat(f, bitSize64)
+	ff, err := strconv.ParseInt(f, base10, bitSize64)
 	if err != nil {
 		return 0, err
 	}
 	return (hh*secHr+mm*secMin+ss)*microSec + ff*microMilli, nil
 }
 
-func parseTimingLine(line string, lastStartTime float64, ignoreTimingErrors bool) (*caps.Caption, error) {
+func parseTimingLine(line string, lastStartTime caps.Timestamp, ignoreTimingErrors bool) (*caps.Caption, error) {
 	matches := timingPattern.FindStringSubmatch(line)
-	if len(matches) < 3 {
-		return nil, fmt.Errorf("invalid timing format")
+	if len(matches) < 3 || strings.TrimSpace(matches[2]) == "" {
+		return nil, errInvalidTiming
 	}
 	start, err := parseTimestamp(matches[1])
 	if err != nil {
 		return nil, err
 	}
-	end, err := parseTimestamp(matches[2])
+	// the end timestamp is followed by the cue settings
+	fields := strings.Fields(matches[2])
+	end, err := parseTimestamp(fields[0])
 	if err != nil {
 		return nil, err
 	}
-	caption := &caps.Caption{Start: start, End: end}
+	caption := &caps.Caption{Start: start, End: end, Placement: parseSettings(fields[1:])}
 	if !ignoreTimingErrors {
 		err := validateTimings(caption, lastStartTime)
 		if err != nil {
@@ -132,38 +338,36 @@ func parseTimingLine(line string, lastStartTime float64, ignoreTimingErrors bool
 	return caption, nil
 }
 
-func parseTimestamp(input string) (*float64, error) {
+// parseTimestamp returns an unset timestamp when the input isn't a WebVTT timestamp.
+func parseTimestamp(input string) (caps.Timestamp, error) {
 	matches := timestampPattern.FindStringSubmatch(input)
 	if len(matches) < 5 {
-		return nil, nil
+		return caps.Timestamp{}, nil
 	}
+	h, m, s := "0", matches[1], matches[2]
 	if matches[3] != "" {
-		tmstp, err := microseconds(matches[1], matches[2], strings.ReplaceAll(matches[3], ":", ""), matches[4])
-		return &tmstp, err
+		h, m, s = matches[1], matches[2], strings.ReplaceAll(matches[3], ":", "")
 	}
-	tmstp, err := microseconds("0", matches[1], matches[2], matches[4])
-	return &tmstp, err
-}
-
-func removeStyles(line string) string {
-	partialResult := voiceSpanPattern.ReplaceAllString(line, "\\2: ")
-	return otherSpanPattern.ReplaceAllString(partialResult, "")
+	tmstp, err := microseconds(h, m, s, matches[4])
+	if err != nil {
+		return caps.Timestamp{}, err
+	}
+	return caps.NewTimestamp(tmstp), nil
 }
 
-func validateTimings(caption *caps.Caption, lastStartTime float64) error {
-	// FIXME: we might need to use a *float64 for Start/End so we can check for unset values.
-	if caption.Start == nil {
-		return fmt.Errorf("invalid cue start timestamp")
+func validateTimings(caption *caps.Caption, lastStartTime caps.Timestamp) error {
+	if !caption.Start.IsSet() {
+		return errInvalidStart
 	}
-	if caption.End == nil {
-		return fmt.Errorf("invalid cue end timestamp")
+	if !caption.End.IsSet() {
+		return errInvalidEnd
 	}
-	if *caption.Start > *caption.End {
-		return fmt.Errorf("end timestamp is not greater than start timestamp")
+	if caption.Start.After(caption.End) {
+		return errEndBeforeStart
 	}
 
-	if *caption.Start < lastStartTime {
-		return fmt.Errorf("start timestamp is not greater to start timestamp of previous cue")
+	if caption.Start.Before(lastStartTime) {
+		return errStartBeforePrevious
 	}
 	return nil
 }
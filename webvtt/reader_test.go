@@ -1,6 +1,8 @@
 package webvtt
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -81,7 +83,7 @@ func TestMicroseconds(t *testing.T) {
 	var tests = []struct {
 		name     string
 		input    []string
-		expected float64
+		expected int64
 		err      string
 	}{
 		{"parse hh:mm:ss.ttt - milliseconds", []string{"00", "00", "00", "999"}, 999000, ""},
@@ -89,10 +91,10 @@ func TestMicroseconds(t *testing.T) {
 		{"parse hh:mm:ss.ttt - mins", []string{"00", "59", "00", "000"}, 3540000000, ""},
 		{"parse hh:mm:ss.ttt - hour", []string{"23", "00", "00", "000"}, 82800000000, ""},
 		{"parse hh:mm:ss.ttt", []string{"23", "59", "59", "999"}, 86399999000, ""},
-		{"parse invalid milliseconds", []string{"23", "59", "59", "9z9"}, 0, "strconv.ParseFloat: parsing \"9z9\": invalid syntax"},
-		{"parse invalid seconds", []string{"23", "59", "5z", "999"}, 0, "strconv.ParseFloat: parsing \"5z\": invalid syntax"},
-		{"parse invalid minutes", []string{"23", "5z", "59", "999"}, 0, "strconv.ParseFloat: parsing \"5z\": invalid syntax"},
-		{"parse invalid hours", []string{"2z", "59", "59", "999"}, 0, "strconv.ParseFloat: parsing \"2z\": invalid syntax"},
+		{"parse invalid milliseconds", []string{"23", "59", "59", "9z9"}, 0, "strconv.ParseInt: parsing \"9z9\": invalid syntax"},
+		{"parse invalid seconds", []string{"23", "59", "5z", "999"}, 0, "strconv.ParseInt: parsing \"5z\": invalid syntax"},
+		{"parse invalid minutes", []string{"23", "5z", "59", "999"}, 0, "strconv.ParseInt: parsing \"5z\": invalid syntax"},
+		{"parse invalid hours", []string{"2z", "59", "59", "999"}, 0, "strconv.ParseInt: parsing \"2z\": invalid syntax"},
 	}
 
 	for _, tt := range tests {
@@ -113,25 +115,26 @@ func TestParseTimingLine(t *testing.T) {
 	var tests = []struct {
 		name               string
 		line               string
-		lastTime           float64
+		lastTime           int64
 		ignoreTimingErrors bool
 		expected           caps.Caption
 		err                string
 	}{
-		{"parse valid cue - without validation", "00:00:50.000 --> 00:00:51.999", 49000000, true, caps.Caption{Start: floatPtr(50000000), End: floatPtr(51999000)}, ""},
-		{"parse valid cue - with validation", "00:00:50.000 --> 00:00:51.999", 49000000, false, caps.Caption{Start: floatPtr(50000000), End: floatPtr(51999000)}, ""},
-		{"parse invalid cue - without validation", "00:00:50.000 --> 00:00:51.999", 59000000, true, caps.Caption{Start: floatPtr(50000000), End: floatPtr(51999000)}, ""},
+		{"parse valid cue - without validation", "00:00:50.000 --> 00:00:51.999", 49000000, true, caps.Caption{Start: caps.NewTimestamp(50000000), End: caps.NewTimestamp(51999000)}, ""},
+		{"parse valid cue - with validation", "00:00:50.000 --> 00:00:51.999", 49000000, false, caps.Caption{Start: caps.NewTimestamp(50000000), End: caps.NewTimestamp(51999000)}, ""},
+		{"parse invalid cue - without validation", "00:00:50.000 --> 00:00:51.999", 59000000, true, caps.Caption{Start: caps.NewTimestamp(50000000), End: caps.NewTimestamp(51999000)}, ""},
 		{"parse invalid cue - with validation", "00:00:50.000 --> 00:00:51.999", 59000000, false, caps.Caption{}, "start timestamp is not greater to start timestamp of previous cue"},
 		{"parse invalid cue - with validation", "00:00:52.000 --> 00:00:51.999", 49000000, false, caps.Caption{}, "end timestamp is not greater than start timestamp"},
 		{"parse invalid timing line - missing end cue", "00:00:50.000 -->", 49000000, false, caps.Caption{}, "invalid timing format"},
 		{"parse invalid timing line - missing start cue", "--> 00:00:51.999", 49000000, false, caps.Caption{}, "invalid timing format"},
 		{"parse invalid timing line - invalid end cue", "00:00:50.000 --> 00:00:5x.999", 49000000, false, caps.Caption{}, "invalid cue end timestamp"},
 		{"parse invalid timing line - invalid start cue", "00:00:5x.000 --> 00:00:51.999", 49000000, false, caps.Caption{}, "invalid cue start timestamp"},
+		{"parse cue settings", "00:00:50.000 --> 00:00:51.999 line:0 align:start", 49000000, false, caps.Caption{Start: caps.NewTimestamp(50000000), End: caps.NewTimestamp(51999000), Placement: caps.Placement{Line: caps.NewLineOffset(0), Align: "start"}}, ""},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual, err := parseTimingLine(tt.line, tt.lastTime, tt.ignoreTimingErrors)
+			actual, err := parseTimingLine(tt.line, caps.NewTimestamp(tt.lastTime), tt.ignoreTimingErrors)
 			if tt.err == "" {
 				assert.NoError(t, err)
 				assert.Equal(t, tt.expected, *actual)
@@ -147,7 +150,7 @@ func TestParseTimestamp(t *testing.T) {
 	var tests = []struct {
 		name     string
 		input    string
-		expected float64
+		expected int64
 		err      string
 	}{
 		{"parse hh:mm:ss.ttt - milliseconds", "00:00:00.999", 999000, ""},
@@ -168,41 +171,269 @@ func TestParseTimestamp(t *testing.T) {
 			actual, err := parseTimestamp(tt.input)
 			if tt.err == "" {
 				assert.NoError(t, err)
-				assert.Equal(t, tt.expected, *actual)
+				assert.Equal(t, caps.NewTimestamp(tt.expected), actual)
 			} else {
 				assert.Equal(t, nil, err)
+				assert.False(t, actual.IsSet())
 			}
 
 		})
 	}
 }
 
-func TestRemoveStyles(t *testing.T) {
+func TestParseCueText(t *testing.T) {
+	italics := caps.StyleProps{Italics: true}
 	var tests = []struct {
 		name     string
 		input    string
-		expected string
-		err      string
+		expected []caps.CaptionContent
 	}{
-		{"remove styles - voice span", "<v Bob>text</v>", "\\2: text", ""},
-		{"remove styles - italic span", "<i>Yellow!</i>", "Yellow!", ""},
-		{"remove styles - bold span", "<b>Yellow!</b>", "Yellow!", ""},
-		{"remove styles - underline span", "<u>Yellow!</u>", "Yellow!", ""},
-		{"remove styles - language span", "<lang en>Yellow!</lang>", "Yellow!", ""},
-		{"remove styles - ruby span", "<ruby.loud>Yellow! <rt.loud>Yellow!</rt></ruby>", "Yellow! Yellow!", ""},
-		{"remove styles - color span", "<c.yellow.bg_blue.magenta.bg_black>Yellow!</c>", "Yellow!", ""},
-		{"remove styles - nested style spans", "Sur les <i.foreignphrase><lang en>playground</lang></i>, ici à Montpellier", "Sur les playground, ici à Montpellier", ""},
+		{"voice span", "<v Bob>text</v>", []caps.CaptionContent{caps.NewCaptionSpan(true, caps.SpanVoice, "Bob", ""), caps.NewCaptionText("text"), caps.NewCaptionSpan(false, caps.SpanVoice, "Bob", "")}},
+		{"unclosed voice span", "<v.loud Bob Smith>text", []caps.CaptionContent{caps.NewCaptionSpan(true, caps.SpanVoice, "Bob Smith", "loud"), caps.NewCaptionText("text"), caps.NewCaptionSpan(false, caps.SpanVoice, "Bob Smith", "loud")}},
+		{"italic span", "<i>Yellow!</i>", []caps.CaptionContent{caps.NewCaptionStyle(true, italics), caps.NewCaptionText("Yellow!"), caps.NewCaptionStyle(false, italics)}},
+		{"bold span", "<b>Yellow!</b>", []caps.CaptionContent{caps.NewCaptionStyle(true, caps.StyleProps{Bold: true}), caps.NewCaptionText("Yellow!"), caps.NewCaptionStyle(false, caps.StyleProps{Bold: true})}},
+		{"underline span", "<u>Yellow!</u>", []caps.CaptionContent{caps.NewCaptionStyle(true, caps.StyleProps{Underline: true}), caps.NewCaptionText("Yellow!"), caps.NewCaptionStyle(false, caps.StyleProps{Underline: true})}},
+		{"language span", "<lang en>Yellow!</lang>", []caps.CaptionContent{caps.NewCaptionSpan(true, caps.SpanLang, "en", ""), caps.NewCaptionText("Yellow!"), caps.NewCaptionSpan(false, caps.SpanLang, "en", "")}},
+		{"ruby span", "<ruby.loud>Yellow! <rt.loud>Yellow!</rt></ruby>", []caps.CaptionContent{
+			caps.NewCaptionSpan(true, caps.SpanRuby, "", "loud"), caps.NewCaptionText("Yellow! "),
+			caps.NewCaptionSpan(true, caps.SpanRubyText, "", "loud"), caps.NewCaptionText("Yellow!"), caps.NewCaptionSpan(false, caps.SpanRubyText, "", "loud"),
+			caps.NewCaptionSpan(false, caps.SpanRuby, "", "loud"),
+		}},
+		{"color span", "<c.yellow.bg_blue.magenta.bg_black>Yellow!</c>", []caps.CaptionContent{
+			caps.NewCaptionStyle(true, caps.StyleProps{Class: "yellow bg_blue magenta bg_black"}), caps.NewCaptionText("Yellow!"), caps.NewCaptionStyle(false, caps.StyleProps{Class: "yellow bg_blue magenta bg_black"}),
+		}},
+		{"nested style spans", "Sur les <i.foreignphrase><lang en>playground</i>, ici à Montpellier", []caps.CaptionContent{
+			caps.NewCaptionText("Sur les "), caps.NewCaptionStyle(true, caps.StyleProps{Italics: true, Class: "foreignphrase"}), caps.NewCaptionSpan(true, caps.SpanLang, "en", ""),
+			caps.NewCaptionText("playground"), caps.NewCaptionSpan(false, caps.SpanLang, "en", ""), caps.NewCaptionStyle(false, caps.StyleProps{Italics: true, Class: "foreignphrase"}),
+			caps.NewCaptionText(", ici à Montpellier"),
+		}},
+		{"lines, entities and unknown tags", "<i>a &lt;b&gt; &amp;\nc</i> <00:00:01.000>d<x>e</x>", []caps.CaptionContent{
+			caps.NewCaptionStyle(true, italics), caps.NewCaptionText("a <b> &"), caps.NewLineBreak(), caps.NewCaptionText("c"), caps.NewCaptionStyle(false, italics),
+			caps.NewCaptionText(" "), caps.NewCaptionTimestamp(caps.NewTimestamp(1000000)), caps.NewCaptionText("d"), caps.NewCaptionText("e"),
+		}},
+		{"inline timestamps", "Never <00:00:01.500>drink <01:02.250><c>liquid</c>", []caps.CaptionContent{
+			caps.NewCaptionText("Never "), caps.NewCaptionTimestamp(caps.NewTimestamp(1500000)), caps.NewCaptionText("drink "),
+			caps.NewCaptionTimestamp(caps.NewTimestamp(62250000)), caps.NewCaptionStyle(true, caps.StyleProps{}), caps.NewCaptionText("liquid"), caps.NewCaptionStyle(false, caps.StyleProps{}),
+		}},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual := removeStyles(tt.input)
+			assert.Equal(t, tt.expected, parseCueText(tt.input))
+		})
+	}
+}
+
+func TestMarkupRoundTrip(t *testing.T) {
+	input := "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\n<v.loud Bob>Sur les <i.foreignphrase><lang en>playground</lang></i>,\n<ruby>漢<rt>kan</rt></ruby> &amp; <c.yellow><b>co</b></c></v>\n"
+	captionSet, err := NewReader(false).Read([]byte(input))
+	assert.Nil(t, err)
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, input, string(result))
+	assert.Equal(t, "Sur les playground,\n漢kan & co", captionSet.GetCaptions(caps.DefaultLang)[0].Text())
+}
+
+func TestInlineTimestampsRoundTrip(t *testing.T) {
+	input := "WEBVTT\n\n00:00:01.000 --> 00:00:03.000\nNever <00:00:01.500>drink <00:00:02.250><i>liquid</i> nitrogen.\n"
+	captionSet, err := NewReader(false).Read([]byte(input))
+	assert.Nil(t, err)
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, input, string(result))
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  caps.ParseError
+	}{
+		{"invalid end", "WEBVTT\n\n00:01.000 --> 00:02.000\nfirst\n\n00:03.000 --> 00:0x.000\nsecond\n", caps.ParseError{Format: "webvtt", Line: 6, Column: 15, Snippet: "00:0x.000", Code: caps.ErrCodeTimestamp}},
+		{"out of order", "WEBVTT\n\n00:05.000 --> 00:06.000\nfirst\n\n00:03.000 --> 00:04.000\nsecond\n", caps.ParseError{Format: "webvtt", Line: 6, Column: 1, Snippet: "00:03.000 --> 00:04.000", Code: caps.ErrCodeTiming}},
+		{"missing end", "WEBVTT\n\n00:01.000 -->\nfirst\n", caps.ParseError{Format: "webvtt", Line: 3, Column: 1, Snippet: "00:01.000 -->", Code: caps.ErrCodeMalformed}},
+		{"empty", "WEBVTT\n\n", caps.ParseError{Format: "webvtt", Code: caps.ErrCodeEmpty}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(false).Read([]byte(tt.input))
+			var parseErr *caps.ParseError
+			assert.True(t, errors.As(err, &parseErr))
+			parseErr.Err = nil
+			assert.Equal(t, tt.want, *parseErr)
+		})
+	}
+}
+
+func TestReadLenient(t *testing.T) {
+	input := "WEBVTT\n\n00:05.000 --> 00:06.000\nfirst\n\n00:03,000 --> 00:04,000\nsecond\n\n00:07.000 --> 00:08.000\nthird\n"
+	tests := []struct {
+		recovery caps.Recovery
+		expected []string
+	}{
+		{caps.Skip, []string{"00:00:05.000 --> 00:00:06.000", "00:00:07.000 --> 00:00:08.000"}},
+		{caps.Clamp, []string{"00:00:05.000 --> 00:00:06.000", "00:00:07.000 --> 00:00:08.000"}},
+		{caps.Repair, []string{"00:00:03.000 --> 00:00:04.000", "00:00:05.000 --> 00:00:06.000", "00:00:07.000 --> 00:00:08.000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.recovery.String(), func(t *testing.T) {
+			captionSet, warnings, err := caps.ReadLenient(NewReader(false), []byte(input), tt.recovery)
+			assert.Nil(t, err)
+			assert.NotEmpty(t, warnings)
+			actual := []string{}
+			for _, caption := range captionSet.GetCaptions(caps.DefaultLang) {
+				actual = append(actual, caption.FormatStart()+" --> "+caption.FormatEnd())
+			}
 			assert.Equal(t, tt.expected, actual)
 		})
 	}
 }
 
-// test helpers
-func floatPtr(x float64) *float64 {
-	return &x
+func TestParseSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		expected caps.Placement
+	}{
+		{"none", "", caps.Placement{}},
+		{"line number", "line:-2", caps.Placement{Line: caps.NewLineOffset(-2)}},
+		{"line percentage and alignment", "line:10%,end", caps.Placement{Line: caps.NewPercentOffset(10), LineAlign: "end"}},
+		{"position and size", "position:10%,line-left size:35.5%", caps.Placement{Position: caps.NewPercentOffset(10), PositionAlign: "line-left", Size: caps.NewPercentOffset(35.5)}},
+		{"vertical and align", "vertical:rl align:middle", caps.Placement{Vertical: "rl", Align: "center"}},
+		{"invalid settings are ignored", "line:top position:110% size:50 align:top vertical:tb foo:bar line", caps.Placement{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parseSettings(strings.Fields(tt.settings)))
+		})
+	}
+}
+
+func TestCueSettingsRoundTrip(t *testing.T) {
+	input := "WEBVTT\n\n00:00:01.000 --> 00:00:02.000 vertical:lr line:0,end position:10%,line-left size:80% align:start\nfirst\n\n00:00:03.000 --> 00:00:04.000\nsecond\n"
+	captionSet, err := NewReader(false).Read([]byte(input))
+	assert.Nil(t, err)
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, input, string(result))
+}
+
+const sampleWebVTTHeader = `WEBVTT
+
+REGION
+id:fred
+width:40%
+lines:3
+regionanchor:0%,100%
+viewportanchor:10%,90%
+scroll:up
+
+REGION
+id:bill width:40% lines:2 regionanchor:100%,100% viewportanchor:90%,90%
+
+STYLE
+/* all cues */
+::cue {
+  color: white;
+  font-family: sans-serif;
+}
+::cue(.yellow), ::cue(b) {
+  color: yellow;
+  font-style: italic;
+}
+
+00:00:00.000 --> 00:00:20.000 region:fred align:left
+Hi, my name is Fred
+
+00:00:02.500 --> 00:00:22.500 region:bill align:right
+Hi, I'm Bill
+`
+
+func TestHeaderBlocks(t *testing.T) {
+	captionSet, err := NewReader(false).Read([]byte(sampleWebVTTHeader))
+	assert.Nil(t, err)
+	assert.Equal(t, []caps.Region{
+		{ID: "bill", Width: 40, Lines: 2, RegionAnchor: caps.Point{X: 100, Y: 100}, ViewportAnchor: caps.Point{X: 90, Y: 90}},
+		{ID: "fred", Width: 40, Lines: 3, RegionAnchor: caps.Point{X: 0, Y: 100}, ViewportAnchor: caps.Point{X: 10, Y: 90}, Scroll: true},
+	}, captionSet.GetRegions())
+	assert.Equal(t, map[string]caps.StyleProps{
+		"cue":    {ID: "cue", Color: "white", FontFamily: "sans-serif"},
+		"yellow": {ID: "yellow", Class: "yellow", Color: "yellow", Italics: true},
+	}, captionSet.Styles)
+	captions := captionSet.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, 2, len(captions))
+	assert.Equal(t, caps.Placement{Region: "fred", Align: "left"}, captions[0].Placement)
+
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, `WEBVTT
+
+REGION
+id:bill
+width:40%
+lines:2
+regionanchor:100%,100%
+viewportanchor:90%,90%
+
+REGION
+id:fred
+width:40%
+viewportanchor:10%,90%
+scroll:up
+
+STYLE
+::cue { font-family: sans-serif; color: white; }
+::cue(.yellow) { color: yellow; font-style: italic; }
+
+00:00:00.000 --> 00:00:20.000 region:fred align:left
+Hi, my name is Fred
+
+00:00:02.500 --> 00:00:22.500 region:bill align:right
+Hi, I'm Bill
+`, string(result))
+	roundTrip, err := NewReader(false).Read(result)
+	assert.Nil(t, err)
+	assert.Equal(t, captionSet, roundTrip)
+}
+
+const sampleWebVTTNotes = `WEBVTT
+
+NOTE This file has chapters
+
+chapter-1
+00:00:01.000 --> 00:00:02.000
+Hello
+
+NOTE
+written by
+the captioner
+
+chapter-2
+00:00:03.000 --> 00:00:04.000
+NOTE is not a note here
+
+00:00:05.000 --> 00:00:06.000
+World
+
+NOTE the end
+`
+
+func TestCueIDsAndNotes(t *testing.T) {
+	captionSet, err := NewReader(false).Read([]byte(sampleWebVTTNotes))
+	assert.Nil(t, err)
+	captions := captionSet.GetCaptions(caps.DefaultLang)
+	assert.Equal(t, 3, len(captions))
+	assert.Equal(t, "chapter-1", captions[0].ID)
+	assert.Equal(t, "chapter-2", captions[1].ID)
+	assert.Equal(t, "NOTE is not a note here", captions[1].Text())
+	assert.Equal(t, "", captions[2].ID)
+	assert.Equal(t, []caps.Note{
+		{Text: "This file has chapters", Time: caps.NewTimestamp(1000000)},
+		{Text: "written by\nthe captioner", Time: caps.NewTimestamp(3000000)},
+		{Text: "the end", Time: caps.NewTimestamp(6000000)},
+	}, captionSet.Notes)
+
+	result, err := NewWriter().Write(captionSet)
+	assert.Nil(t, err)
+	assert.Equal(t, sampleWebVTTNotes, string(result))
 }
@@ -0,0 +1,147 @@
+package webvtt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vimeo/caps"
+)
+
+// mpegtsClock is the frequency of MPEG-2 timestamps, 90kHz.
+const mpegtsClock = 90000
+
+var errSegmentDuration = errors.New("segment duration must be positive")
+
+// SegmentOptions configures the splitting of captions in HLS segments.
+type SegmentOptions struct {
+	// Duration is the target duration of the segments. Every segment lasts Duration
+	// but the last one, ending with the media.
+	Duration time.Duration
+	// MediaDuration is the duration of the media, the end of the last cue when shorter.
+	MediaDuration time.Duration
+	// MPEGTS is the MPEG-2 timestamp, in 90kHz ticks, of the start of the media in
+	// the video segments, written in the X-TIMESTAMP-MAP header of every segment.
+	MPEGTS int64
+	// NameFormat is the format of the segment file names, given the segment index
+	// starting at 0. "segment%d.vtt" when empty.
+	NameFormat string
+	// Lang is the language of the captions to segment, the first one when empty.
+	Lang string
+}
+
+// Segment is a WebVTT file holding the cues displayed during a part of the media.
+type Segment struct {
+	Name     string
+	Start    caps.Timestamp
+	Duration time.Duration
+	Content  []byte
+}
+
+// Segments splits the cues of the caption set in WebVTT segments for HLS. Cues
+// spanning several segments are repeated in each one, with the same timings, as
+// players remove the duplicates. The regions and styles of the caption set are
+// written in every segment.
+func Segments(captionSet *caps.CaptionSet, options SegmentOptions) ([]Segment, error) {
+	if options.Duration <= 0 {
+		return nil, errSegmentDuration
+	}
+	nameFormat := options.NameFormat
+	if nameFormat == "" {
+		nameFormat = "segment%d.vtt"
+	}
+	lang := options.Lang
+	if lang == "" && len(captionSet.Languages()) > 0 {
+		lang = captionSet.Languages()[0]
+	}
+	captions := captionSet.GetCaptions(lang)
+	total := options.MediaDuration
+	for _, caption := range captions {
+		if end := caption.End.Duration(); end > total {
+			total = end
+		}
+	}
+	count := int(math.Ceil(float64(total) / float64(options.Duration)))
+	if count == 0 {
+		count = 1
+	}
+
+	writer := Writer{header: fmt.Sprintf("X-TIMESTAMP-MAP=MPEGTS:%d,LOCAL:%s", options.MPEGTS, caps.NewTimestamp(0).FormatWebVTT())}
+	segments := []Segment{}
+	for i := 0; i < count; i++ {
+		start := time.Duration(i) * options.Duration
+		duration := options.Duration
+		if i == count-1 && total > start {
+			duration = total - start
+		}
+		segment := caps.NewCaptionSet()
+		segment.Styles = captionSet.Styles
+		segment.Regions = captionSet.Regions
+		segment.SetCaptions(lang, segmentCaptions(captions, start, start+duration))
+		content, err := writer.Write(segment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write segment %d: %w", i, err)
+		}
+		segments = append(segments, Segment{
+			Name:     fmt.Sprintf(nameFormat, i),
+			Start:    caps.TimestampFromDuration(start),
+			Duration: duration,
+			Content:  content,
+		})
+	}
+	return segments, nil
+}
+
+// segmentCaptions returns the captions displayed between start and end.
+func segmentCaptions(captions []*caps.Caption, start, end time.Duration) []*caps.Caption {
+	displayed := []*caps.Caption{}
+	for _, caption := range captions {
+		captionStart, captionEnd := caption.Start.Duration(), caption.End.Duration()
+		if captionStart < end && (captionEnd > start || captionStart >= start) {
+			displayed = append(displayed, caption)
+		}
+	}
+	return displayed
+}
+
+// Playlist returns the HLS media playlist of the segments.
+func Playlist(segments []Segment) []byte {
+	target := 0.0
+	for _, segment := range segments {
+		target = math.Max(target, math.Ceil(segment.Duration.Seconds()))
+	}
+	output := bytes.Buffer{}
+	output.WriteString("#EXTM3U\n")
+	output.WriteString("#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&output, "#EXT-X-TARGETDURATION:%d\n", int(target))
+	output.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	output.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for _, segment := range segments {
+		fmt.Fprintf(&output, "#EXTINF:%.3f,\n%s\n", segment.Duration.Seconds(), segment.Name)
+	}
+	output.WriteString("#EXT-X-ENDLIST\n")
+	return output.Bytes()
+}
+
+// WriteSegments writes the segments of the caption set and their playlist, named
+// playlistName, to dir.
+func WriteSegments(dir, playlistName string, captionSet *caps.CaptionSet, options SegmentOptions) error {
+	segments, err := Segments(captionSet, options)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if err := ioutil.WriteFile(filepath.Join(dir, segment.Name), segment.Content, 0644); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(dir, playlistName), Playlist(segments), 0644)
+}
@@ -0,0 +1,86 @@
+package webvtt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sampleWebVTTSegments = `WEBVTT
+
+00:00:01.000 --> 00:00:03.000
+first
+
+00:00:05.000 --> 00:00:07.000
+across
+
+00:00:13.000 --> 00:00:14.500
+last
+`
+
+func TestSegments(t *testing.T) {
+	captionSet, err := NewReader(false).Read([]byte(sampleWebVTTSegments))
+	assert.Nil(t, err)
+	segments, err := Segments(captionSet, SegmentOptions{Duration: 6 * time.Second, MPEGTS: 900000})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(segments))
+	assert.Equal(t, []string{"segment0.vtt", "segment1.vtt", "segment2.vtt"}, []string{segments[0].Name, segments[1].Name, segments[2].Name})
+	assert.Equal(t, 2500*time.Millisecond, segments[2].Duration)
+	assert.Equal(t, `WEBVTT
+X-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000
+
+00:00:01.000 --> 00:00:03.000
+first
+
+00:00:05.000 --> 00:00:07.000
+across
+`, string(segments[0].Content))
+	assert.Equal(t, `WEBVTT
+X-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000
+
+00:00:05.000 --> 00:00:07.000
+across
+`, string(segments[1].Content))
+
+	// segments are valid WebVTT files
+	segment, err := NewReader(false).Read(segments[2].Content)
+	assert.Nil(t, err)
+	assert.Equal(t, "last", segment.GetCaptions("en-US")[0].Text())
+
+	_, err = Segments(captionSet, SegmentOptions{})
+	assert.Equal(t, errSegmentDuration, err)
+}
+
+func TestWriteSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caps-hls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	captionSet, err := NewReader(false).Read([]byte(sampleWebVTTSegments))
+	assert.Nil(t, err)
+	options := SegmentOptions{Duration: 10 * time.Second, MediaDuration: 25 * time.Second, NameFormat: "subs-%03d.webvtt"}
+	assert.Nil(t, WriteSegments(dir, "subs.m3u8", captionSet, options))
+
+	playlist, err := ioutil.ReadFile(filepath.Join(dir, "subs.m3u8"))
+	assert.Nil(t, err)
+	assert.Equal(t, `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXTINF:10.000,
+subs-000.webvtt
+#EXTINF:10.000,
+subs-001.webvtt
+#EXTINF:5.000,
+subs-002.webvtt
+#EXT-X-ENDLIST
+`, string(playlist))
+	empty, err := ioutil.ReadFile(filepath.Join(dir, "subs-002.webvtt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:0,LOCAL:00:00:00.000\n\n", string(empty))
+}
@@ -0,0 +1,133 @@
+package webvtt
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/vimeo/caps"
+)
+
+var (
+	lineAligns     = []string{"start", "center", "end"}
+	positionAligns = []string{"line-left", "center", "line-right"}
+	textAligns     = []string{"start", "center", "end", "left", "right"}
+)
+
+// parseSettings returns the placement set by the cue settings following the end
+// timestamp of a timing line, e.g. "line:0 position:10% align:start". Invalid
+// settings are ignored, as required by the spec.
+func parseSettings(settings []string) caps.Placement {
+	placement := caps.Placement{}
+	for _, setting := range settings {
+		parts := strings.SplitN(setting, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		name, value := parts[0], parts[1]
+		switch name {
+		case "vertical":
+			if value == "rl" || value == "lr" {
+				placement.Vertical = value
+			}
+		case "line":
+			value, align := splitAlign(value)
+			offset, ok := parseLine(value)
+			if ok && (align == "" || isOneOf(align, lineAligns)) {
+				placement.Line, placement.LineAlign = offset, align
+			}
+		case "position":
+			value, align := splitAlign(value)
+			offset, ok := parsePercent(value)
+			if ok && (align == "" || isOneOf(align, positionAligns)) {
+				placement.Position, placement.PositionAlign = offset, align
+			}
+		case "size":
+			if offset, ok := parsePercent(value); ok {
+				placement.Size = offset
+			}
+		case "region":
+			placement.Region = value
+		case "align":
+			if value == "middle" {
+				// from earlier drafts of the spec
+				value = "center"
+			}
+			if isOneOf(value, textAligns) {
+				placement.Align = value
+			}
+		}
+	}
+	return placement
+}
+
+// formatSettings returns the cue settings of the placement, each preceded by a space.
+func formatSettings(placement caps.Placement) string {
+	settings := strings.Builder{}
+	if placement.Region != "" {
+		settings.WriteString(" region:" + placement.Region)
+	}
+	if placement.Vertical != "" {
+		settings.WriteString(" vertical:" + placement.Vertical)
+	}
+	if placement.Line.IsSet() {
+		settings.WriteString(" line:" + joinAlign(placement.Line.String(), placement.LineAlign))
+	}
+	if placement.Position.IsSet() && placement.Position.IsPercent() {
+		settings.WriteString(" position:" + joinAlign(placement.Position.String(), placement.PositionAlign))
+	}
+	if placement.Size.IsSet() && placement.Size.IsPercent() {
+		settings.WriteString(" size:" + placement.Size.String())
+	}
+	if placement.Align != "" {
+		settings.WriteString(" align:" + placement.Align)
+	}
+	return settings.String()
+}
+
+func splitAlign(value string) (string, string) {
+	parts := strings.SplitN(value, ",", 2)
+	if len(parts) == 1 {
+		return value, ""
+	}
+	return parts[0], parts[1]
+}
+
+func joinAlign(value, align string) string {
+	if align == "" {
+		return value
+	}
+	return value + "," + align
+}
+
+// parseLine parses a line number or a percentage.
+func parseLine(value string) (caps.Offset, bool) {
+	if strings.HasSuffix(value, "%") {
+		return parsePercent(value)
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return caps.Offset{}, false
+	}
+	return caps.NewLineOffset(n), true
+}
+
+// parsePercent parses a percentage between 0% and 100%.
+func parsePercent(value string) (caps.Offset, bool) {
+	if !strings.HasSuffix(value, "%") {
+		return caps.Offset{}, false
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), bitSize64)
+	if err != nil || percent < 0 || percent > 100 {
+		return caps.Offset{}, false
+	}
+	return caps.NewPercentOffset(percent), true
+}
+
+func isOneOf(value string, values []string) bool {
+	for _, v := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
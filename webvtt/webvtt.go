@@ -2,9 +2,13 @@ package webvtt
 
 import "github.com/vimeo/caps"
 
+func init() {
+	caps.Register("webvtt", NewReader(false), NewWriter())
+}
+
 func NewReader(ignoreTimingErrors bool) caps.CaptionReader {
 	return &Reader{
-		ignoreTimingErrors,
+		ignoreTimingErrors: ignoreTimingErrors,
 	}
 }
 
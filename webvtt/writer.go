@@ -1,73 +1,175 @@
 package webvtt
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/vimeo/caps"
 )
 
-type Writer struct{}
+type Writer struct {
+	// header is written on the lines following "WEBVTT", like the X-TIMESTAMP-MAP of HLS segments
+	header string
+}
 
 func (w *Writer) Write(captionSet *caps.CaptionSet) ([]byte, error) {
-	output := bytes.NewBufferString("WEBVTT\n\n")
+	var output bytes.Buffer
+	err := w.WriteStream(&output, captionSet)
+	return output.Bytes(), err
+}
+
+// WriteStream writes the cues of the first language one at a time to out.
+func (w *Writer) WriteStream(out io.Writer, captionSet *caps.CaptionSet) error {
+	output := bufio.NewWriter(out)
+	output.WriteString("WEBVTT\n")
+	if w.header != "" {
+		output.WriteString(w.header + "\n")
+	}
+	output.WriteString("\n")
+	for _, region := range captionSet.GetRegions() {
+		output.WriteString(formatRegion(region) + "\n")
+	}
+	if styles := formatStyles(captionSet.Styles); styles != "" {
+		output.WriteString(styles + "\n")
+	}
 	if captionSet.IsEmpty() || len(captionSet.Languages()) <= 0 {
-		return output.Bytes(), nil
+		return output.Flush()
 	}
 
 	lang := captionSet.Languages()[0]
 	captions := captionSet.GetCaptions(lang)
 
+	// notes are written before the first cue starting at or after their time
+	notes := captionSet.Notes
 	for i, caption := range captions {
+		for len(notes) > 0 && !notes[0].Time.After(caption.Start) {
+			output.WriteString(formatNote(notes[0]) + "\n")
+			notes = notes[1:]
+		}
 		output.WriteString(writeCaption(*caption))
 		if i != len(captions)-1 {
 			output.WriteString("\n")
 		}
 
 	}
+	for _, note := range notes {
+		output.WriteString("\n" + formatNote(note))
+	}
 
-	return output.Bytes(), nil
+	return output.Flush()
 }
 
 func writeCaption(caption caps.Caption) string {
-	start := caption.FormatStart()
-	end := caption.FormatEnd()
-
-	timing := fmt.Sprintf("%s --> %s\n", start, end)
-	output := bytes.NewBufferString(timing)
+	start := caption.Start.FormatWebVTT()
+	end := caption.End.FormatWebVTT()
 
-	if len(caption.Nodes) == 0 {
-		output.WriteString("&nbsp;")
-	} else {
-		output.WriteString(formatNodes(caption.Nodes))
+	output := &bytes.Buffer{}
+	if isValidID(caption.ID) {
+		output.WriteString(caption.ID + "\n")
 	}
-
+	fmt.Fprintf(output, "%s --> %s%s\n", start, end, formatSettings(caption.Placement))
+	output.WriteString(formatText(caption))
 	output.WriteString("\n")
 
 	return output.String()
 }
 
-func formatNodes(nodes []caps.CaptionContent) string {
-	content := ""
+// FormatCue returns the cue text and the cue settings of the caption, for formats
+// carrying WebVTT cues outside of WebVTT files like ISO BMFF 'wvtt' samples.
+func FormatCue(caption caps.Caption) (string, string) {
+	return formatText(caption), strings.TrimSpace(formatSettings(caption.Placement))
+}
+
+func formatText(caption caps.Caption) string {
+	if len(caption.Nodes) == 0 {
+		return "&nbsp;"
+	}
+	return formatNodes(caption.Nodes)
+}
 
+// formatNodes renders the caption nodes as cue text, with the <c>, <i>, <b> and
+// <u> tags of style nodes, the <v>, <lang>, <ruby> and <rt> tags of span nodes and
+// timestamp tags.
+func formatNodes(nodes []caps.CaptionContent) string {
+	content := strings.Builder{}
+	open := caps.MarkupStack{}
 	for i, node := range nodes {
-		if node.Text() {
-			if node.Content() != "" {
-				content += node.Content()
+		switch n := node.(type) {
+		case caps.CaptionStyle:
+			if n.Start {
+				tags := styleTags(n.Props)
+				for _, tag := range tags {
+					content.WriteString(tag.start())
+				}
+				open.Push(closeTags(tags))
 			} else {
-				content += "&nbsp;"
+				content.WriteString(open.Pop())
 			}
-		} else if node.LineBreak() {
-			isFirstNode := i == 0
-			isTrailingBreak := i > 0 && nodes[i-1].LineBreak()
-
-			if isFirstNode || isTrailingBreak {
-				content += "&nbsp;"
+		case caps.CaptionSpan:
+			if n.Start {
+				tag := spanTag(n)
+				content.WriteString(tag.start())
+				open.Push(tag.end())
+			} else {
+				content.WriteString(open.Pop())
+			}
+		case caps.CaptionTimestamp:
+			content.WriteString("<" + n.Time.FormatWebVTT() + ">")
+		default:
+			if node.Text() {
+				if node.Content() != "" {
+					content.WriteString(textEscaper.Replace(node.Content()))
+				} else {
+					content.WriteString("&nbsp;")
+				}
+			} else if node.LineBreak() {
+				isFirstNode := i == 0
+				isTrailingBreak := i > 0 && nodes[i-1].LineBreak()
+
+				if isFirstNode || isTrailingBreak {
+					content.WriteString("&nbsp;")
+				}
+
+				content.WriteString("\n")
 			}
-
-			content += "\n"
 		}
 	}
+	content.WriteString(open.PopAll())
+	return content.String()
+}
+
+// closeTags returns the end tags of the tags, innermost first.
+func closeTags(tags []cueTag) string {
+	closing := ""
+	for i := len(tags) - 1; i >= 0; i-- {
+		closing += tags[i].end()
+	}
+	return closing
+}
+
+// isValidID reports whether the caption ID can be written as a cue identifier,
+// which can't span lines or contain "-->".
+func isValidID(id string) bool {
+	return strings.TrimSpace(id) != "" && !strings.ContainsAny(id, "\r\n") && !strings.Contains(id, webvttTiming)
+}
 
-	return content
+// formatNote returns the NOTE block of the note. Blank lines, which would end the
+// block, are dropped and "-->" is replaced as it can't appear in a note.
+func formatNote(note caps.Note) string {
+	lines := []string{}
+	for _, line := range strings.Split(note.Text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, strings.ReplaceAll(line, webvttTiming, "->"))
+		}
+	}
+	switch len(lines) {
+	case 0:
+		return noteBlock + "\n"
+	case 1:
+		return noteBlock + " " + lines[0] + "\n"
+	}
+	return noteBlock + "\n" + strings.Join(lines, "\n") + "\n"
 }